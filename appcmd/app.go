@@ -3,4 +3,7 @@ package appcmd
 type App interface {
 	FullName() string
 	ProjectDirs() []string
+	// ProjectExts are the file extensions, like ".llsp", of the app's
+	// programs. New programs get the first one.
+	ProjectExts() []string
 }
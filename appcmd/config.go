@@ -0,0 +1,151 @@
+package appcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config is the user's mind-meld settings. It's read from
+// ~/.config/mind-meld/config.json on Linux, or from the path in
+// $MIND_MELD_CONFIG. For example:
+//
+//	{
+//	  "apps": {
+//	    "spike": {
+//	      "project_dirs": ["/mnt/share/LEGO Education SPIKE"],
+//	      "skip_default_dirs": true
+//	    }
+//	  },
+//	  "opcodes": ["~/mind-meld/ev3-opcodes.json"]
+//	}
+type Config struct {
+	// Apps holds settings for each app, keyed by the app's subcommand name,
+	// like "spike".
+	Apps map[string]AppConfig `json:"apps"`
+
+	// Opcodes are opcode catalog files, which add blocks to the built-in
+	// catalog or change how they're dumped. See package opcodes for the
+	// file format.
+	Opcodes []string `json:"opcodes"`
+}
+
+// OpcodeFiles returns the paths of the opcode catalog files.
+func (c Config) OpcodeFiles() []string {
+	paths := make([]string, 0, len(c.Opcodes))
+	for _, path := range c.Opcodes {
+		paths = append(paths, expandHome(path))
+	}
+	return paths
+}
+
+// AppConfig is the settings for one app.
+type AppConfig struct {
+	// ProjectDirs are checked before the app's built-in dirs.
+	ProjectDirs []string `json:"project_dirs"`
+	// SkipDefaultDirs turns off the app's built-in dirs.
+	SkipDefaultDirs bool `json:"skip_default_dirs"`
+}
+
+// ConfigPath returns the path of the config file.
+func ConfigPath() (string, error) {
+	if path := os.Getenv("MIND_MELD_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mind-meld", "config.json"), nil
+}
+
+// LoadConfig reads the config file. It's fine for the file to not exist.
+func LoadConfig() (Config, error) {
+	var cfg Config
+
+	path, err := ConfigPath()
+	if err != nil {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Configured is an App whose project dirs can be changed by the user. The
+// dirs are checked in this order:
+//
+//  1. Dirs, which come from the command line.
+//  2. $MIND_MELD_<NAME>_DIRS, which is a list of dirs like $PATH.
+//  3. The app's project_dirs in Config.
+//  4. The app's built-in dirs, unless the config turns them off.
+type Configured struct {
+	App
+
+	// Name is the app's subcommand name, like "spike".
+	Name string
+	// Config is the user's settings.
+	Config Config
+	// Dirs are the dirs from the command line.
+	Dirs []string
+}
+
+// EnvVar is the name of the environment variable with extra project dirs for
+// the app.
+func (c *Configured) EnvVar() string {
+	name := strings.ToUpper(c.Name)
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	return "MIND_MELD_" + name + "_DIRS"
+}
+
+func (c *Configured) ProjectDirs() []string {
+	var dirs []string
+	dirs = append(dirs, c.Dirs...)
+	dirs = append(dirs, filepath.SplitList(os.Getenv(c.EnvVar()))...)
+
+	appConfig := c.Config.Apps[c.Name]
+	dirs = append(dirs, appConfig.ProjectDirs...)
+	if !appConfig.SkipDefaultDirs {
+		dirs = append(dirs, c.App.ProjectDirs()...)
+	}
+
+	res := make([]string, 0, len(dirs))
+	seen := make(map[string]bool, len(dirs))
+	for _, d := range dirs {
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		res = append(res, expandHome(d))
+	}
+	return res
+}
+
+// expandHome replaces a leading ~ with the user's home dir.
+func expandHome(dir string) string {
+	if dir != "~" && !strings.HasPrefix(dir, "~/") && !strings.HasPrefix(dir, "~"+string(filepath.Separator)) {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return dir
+	}
+	return filepath.Join(home, dir[1:])
+}
@@ -0,0 +1,80 @@
+package appcmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testApp struct{}
+
+func (testApp) FullName() string      { return "Test" }
+func (testApp) ProjectDirs() []string { return []string{"/builtin"} }
+func (testApp) ProjectExts() []string { return []string{".llsp"} }
+
+// setenv sets an environment variable until the test finishes. It's like
+// t.Setenv, which needs a newer Go.
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestConfiguredProjectDirs(t *testing.T) {
+	setenv(t, "MIND_MELD_SPIKE3_DIRS", "/env1"+string(filepath.ListSeparator)+"/env2")
+
+	a := &Configured{
+		App:  testApp{},
+		Name: "spike3",
+		Config: Config{Apps: map[string]AppConfig{
+			"spike3": {ProjectDirs: []string{"/config", "/flag"}},
+			"spike":  {ProjectDirs: []string{"/other"}},
+		}},
+		Dirs: []string{"/flag"},
+	}
+	assert.Equal(t, "MIND_MELD_SPIKE3_DIRS", a.EnvVar())
+	assert.Equal(t, []string{"/flag", "/env1", "/env2", "/config", "/builtin"}, a.ProjectDirs())
+
+	a.Config.Apps["spike3"] = AppConfig{ProjectDirs: []string{"/config"}, SkipDefaultDirs: true}
+	assert.Equal(t, []string{"/flag", "/env1", "/env2", "/config"}, a.ProjectDirs())
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	setenv(t, "MIND_MELD_CONFIG", path)
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Apps)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"apps": {"spike": {"project_dirs": ["/mnt/spike"], "skip_default_dirs": true}}}`), 0o644))
+	cfg, err = LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, AppConfig{ProjectDirs: []string{"/mnt/spike"}, SkipDefaultDirs: true}, cfg.Apps["spike"])
+
+	require.NoError(t, os.WriteFile(path, []byte(`project_dirs = ["/mnt/spike"]`), 0o644))
+	_, err = LoadConfig()
+	assert.Error(t, err)
+}
+
+func TestDefaultDirs(t *testing.T) {
+	assert.Equal(t, []string{
+		filepath.Join("/Users/me", "Library", "Containers", "com.lego.education.spikenext", "Data", "Documents", "LEGO Education SPIKE"),
+		filepath.Join("/Users/me", "Documents", "LEGO Education SPIKE"),
+	}, defaultDirs("darwin", "/Users/me", "com.lego.education.spikenext", "LEGO Education SPIKE"))
+
+	setenv(t, "WINEPREFIX", "/home/me/wine")
+	linux := defaultDirs("linux", "/home/me", "com.lego.education.spikenext", "LEGO Education SPIKE")
+	require.Len(t, linux, 2)
+	assert.Equal(t, filepath.Join("/home/me", "Documents", "LEGO Education SPIKE"), linux[0])
+	assert.Contains(t, linux[1], filepath.Join("/home/me/wine", "drive_c", "users"))
+}
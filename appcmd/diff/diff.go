@@ -24,7 +24,7 @@ func Run(app appcmd.App, baseRev string) error {
 		tb:   fetch.NewTreeBuilder(repo),
 	}
 
-	if _, err := fetch.Run(app, t); err != nil {
+	if _, err := fetch.Run(app, t, fetch.Options{}); err != nil {
 		return err
 	}
 
@@ -0,0 +1,51 @@
+package appcmd
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+)
+
+// DefaultDirs returns the places that an app might keep its programs on this
+// computer. bundleID is the app's macOS bundle ID, like
+// "com.lego.education.spikenext", and docsName is the name of the folder that
+// the app makes in Documents, like "LEGO Education SPIKE".
+func DefaultDirs(bundleID, docsName string) []string {
+	return defaultDirs(runtime.GOOS, homeDir(), bundleID, docsName)
+}
+
+func defaultDirs(goos, home, bundleID, docsName string) []string {
+	switch goos {
+	case "darwin":
+		return []string{
+			filepath.Join(home, "Library", "Containers", bundleID, "Data", "Documents", docsName),
+			filepath.Join(home, "Documents", docsName),
+		}
+	case "windows":
+		dirs := []string{filepath.Join(home, "Documents", docsName)}
+		if oneDrive := os.Getenv("OneDrive"); oneDrive != "" {
+			dirs = append(dirs, filepath.Join(oneDrive, "Documents", docsName))
+		}
+		return dirs
+	default:
+		// The apps don't run on Linux, but the programs may be in a synced
+		// folder or in a Wine prefix.
+		dirs := []string{filepath.Join(home, "Documents", docsName)}
+		prefix := os.Getenv("WINEPREFIX")
+		if prefix == "" {
+			prefix = filepath.Join(home, ".wine")
+		}
+		if u, err := user.Current(); err == nil {
+			dirs = append(dirs, filepath.Join(prefix, "drive_c", "users", u.Username, "Documents", docsName))
+		}
+		return dirs
+	}
+}
+
+func homeDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return home
+	}
+	return os.Getenv("HOME")
+}
@@ -0,0 +1,343 @@
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"github.com/spraints/mind-meld/blockdiff"
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// maxNotes is how many block changes are listed for each program in a commit
+// message.
+const maxNotes = 5
+
+// programChange is how one program changed between two trees.
+type programChange struct {
+	// Name is the program's path without its extension.
+	Name string
+	// Kind is "added", "changed" or "removed".
+	Kind  string
+	Files []fileChange
+	// Notes summarize the changes to a block program.
+	Notes []string
+}
+
+type fileChange struct {
+	Name           string
+	Added, Removed int
+	// Binary is set for copies of program files, which don't have lines.
+	Binary           bool
+	oldData, newData []byte
+}
+
+// summarizeChanges compares the files in two trees, and groups the changes by
+// program. Files that aren't a program's, like the index, are ignored.
+func summarizeChanges(repo *git.Repository, oldFiles, newFiles map[string]plumbing.Hash) ([]programChange, error) {
+	var names []string
+	for name, oid := range oldFiles {
+		if newFiles[name] != oid {
+			names = append(names, name)
+		}
+	}
+	for name := range newFiles {
+		if _, ok := oldFiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	byProgram := map[string]*programChange{}
+	var changes []*programChange
+	for _, name := range names {
+		program, ok := programName(name)
+		if !ok {
+			continue
+		}
+		fc, err := compareFile(repo, name, oldFiles, newFiles)
+		if err != nil {
+			return nil, err
+		}
+		pc := byProgram[program]
+		if pc == nil {
+			pc = &programChange{Name: program}
+			byProgram[program] = pc
+			changes = append(changes, pc)
+		}
+		pc.Files = append(pc.Files, fc)
+	}
+
+	oldPrograms, newPrograms := programNames(oldFiles), programNames(newFiles)
+	res := make([]programChange, 0, len(changes))
+	for _, pc := range changes {
+		switch {
+		case !oldPrograms[pc.Name]:
+			pc.Kind = "added"
+		case !newPrograms[pc.Name]:
+			pc.Kind = "removed"
+		default:
+			pc.Kind = "changed"
+		}
+		pc.Notes = blockNotes(pc.Files)
+		res = append(res, *pc)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return kindOrder(res[i].Kind) < kindOrder(res[j].Kind) })
+	return res, nil
+}
+
+// programName returns the name of the program that a file is from.
+func programName(name string) (string, bool) {
+	if original := strings.TrimPrefix(name, originalsPrefix); original != name {
+		return strings.TrimSuffix(original, path.Ext(original)), true
+	}
+	for _, suffix := range outputSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), true
+		}
+	}
+	return "", false
+}
+
+// originalsPrefix is where copies of program files are in a git tree.
+var originalsPrefix = OriginalName(Project{}, GitPathSeparator)
+
+// programNames returns the names of the programs that have files in a tree.
+func programNames(files map[string]plumbing.Hash) map[string]bool {
+	names := map[string]bool{}
+	for name := range files {
+		if program, ok := programName(name); ok {
+			names[program] = true
+		}
+	}
+	return names
+}
+
+func kindOrder(kind string) int {
+	switch kind {
+	case "added":
+		return 0
+	case "changed":
+		return 1
+	default:
+		return 2
+	}
+}
+
+func compareFile(repo *git.Repository, name string, oldFiles, newFiles map[string]plumbing.Hash) (fileChange, error) {
+	fc := fileChange{Name: name, Binary: strings.HasPrefix(name, originalsPrefix)}
+	if fc.Binary {
+		return fc, nil
+	}
+	var err error
+	if oid, ok := oldFiles[name]; ok {
+		if fc.oldData, err = readBlob(repo, oid); err != nil {
+			return fc, err
+		}
+	}
+	if oid, ok := newFiles[name]; ok {
+		if fc.newData, err = readBlob(repo, oid); err != nil {
+			return fc, err
+		}
+	}
+	for _, d := range diff.Do(string(fc.oldData), string(fc.newData)) {
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			fc.Added += countLines(d.Text)
+		case diffmatchpatch.DiffDelete:
+			fc.Removed += countLines(d.Text)
+		}
+	}
+	return fc, nil
+}
+
+func readBlob(repo *git.Repository, oid plumbing.Hash) ([]byte, error) {
+	blob, err := repo.BlobObject(oid)
+	if err != nil {
+		return nil, err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func countLines(s string) int {
+	n := strings.Count(s, "\n")
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		n++
+	}
+	return n
+}
+
+// blockNotes summarizes the changes to a block program. If both versions of
+// its project.json are there, they're compared with blockdiff. Otherwise, the
+// scripts in the text rendering are counted.
+func blockNotes(files []fileChange) []string {
+	for _, fc := range files {
+		if strings.HasSuffix(fc.Name, ".project.json") && fc.oldData != nil && fc.newData != nil {
+			if notes, ok := compareProjects(fc.oldData, fc.newData); ok {
+				return notes
+			}
+		}
+	}
+	for _, fc := range files {
+		if strings.HasSuffix(fc.Name, ".blocks.txt") {
+			return compareScripts(fc.oldData, fc.newData)
+		}
+	}
+	return nil
+}
+
+func compareProjects(oldData, newData []byte) ([]string, bool) {
+	var oldProj, newProj lmsp.Project
+	if json.Unmarshal(oldData, &oldProj) != nil || json.Unmarshal(newData, &newProj) != nil {
+		return nil, false
+	}
+	var notes []string
+	for _, c := range blockdiff.Compare(oldProj, newProj) {
+		notes = append(notes, c.String())
+	}
+	if len(notes) > maxNotes {
+		more := len(notes) - maxNotes
+		notes = append(notes[:maxNotes], fmt.Sprintf("and %d more", more))
+	}
+	return notes, true
+}
+
+// compareScripts counts the scripts that were added, changed and removed in a
+// text rendering from lmsdump. Scripts are matched by the ID of their first
+// block, which is in the line above each script.
+func compareScripts(oldData, newData []byte) []string {
+	oldScripts, newScripts := dumpedScripts(oldData), dumpedScripts(newData)
+	var added, changed, removed int
+	for id, text := range newScripts {
+		old, ok := oldScripts[id]
+		switch {
+		case !ok:
+			added++
+		case old != text:
+			changed++
+		}
+	}
+	for id := range oldScripts {
+		if _, ok := newScripts[id]; !ok {
+			removed++
+		}
+	}
+
+	var counts []string
+	for _, c := range []struct {
+		n    int
+		verb string
+	}{{added, "added"}, {changed, "changed"}, {removed, "removed"}} {
+		switch {
+		case c.n == 1:
+			counts = append(counts, "1 script "+c.verb)
+		case c.n > 1:
+			counts = append(counts, fmt.Sprintf("%d scripts %s", c.n, c.verb))
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	return []string{strings.Join(counts, ", ")}
+}
+
+// dumpedScripts splits a text rendering from lmsdump into its scripts, keyed
+// by target and the ID of the script's first block.
+func dumpedScripts(data []byte) map[string]string {
+	scripts := map[string]string{}
+	var target, id string
+	var text strings.Builder
+	flush := func() {
+		if id != "" {
+			scripts[target+"\x00"+id] = text.String()
+		}
+		id = ""
+		text.Reset()
+	}
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "target: "):
+			flush()
+			target = strings.TrimSpace(strings.TrimPrefix(line, "target: "))
+		case strings.HasPrefix(trimmed, "----- ") && strings.HasSuffix(trimmed, " -----"):
+			flush()
+			id = strings.TrimSuffix(strings.TrimPrefix(trimmed, "----- "), " -----")
+		default:
+			text.WriteString(line)
+		}
+	}
+	flush()
+	return scripts
+}
+
+// changeMessage builds a commit message from the changes. It returns "" if no
+// programs changed.
+func changeMessage(changes []programChange) string {
+	if len(changes) == 0 {
+		return ""
+	}
+
+	byKind := map[string][]string{}
+	for _, pc := range changes {
+		byKind[pc.Kind] = append(byKind[pc.Kind], pc.Name)
+	}
+	var subject []string
+	for _, k := range []struct{ kind, verb string }{{"added", "add"}, {"changed", "update"}, {"removed", "remove"}} {
+		names := byKind[k.kind]
+		switch {
+		case len(names) == 0:
+			continue
+		case len(names) > 3:
+			subject = append(subject, fmt.Sprintf("%s %d programs", k.verb, len(names)))
+		default:
+			subject = append(subject, k.verb+" "+strings.Join(names, ", "))
+		}
+	}
+
+	var msg strings.Builder
+	s := strings.Join(subject, "; ")
+	msg.WriteString(strings.ToUpper(s[:1]) + s[1:] + "\n")
+	for _, pc := range changes {
+		fmt.Fprintf(&msg, "\n%s %s:\n", pc.Kind, pc.Name)
+		pc.write(&msg, "  ")
+	}
+	return msg.String()
+}
+
+// write writes the line counts of the program's files, and the notes.
+func (pc programChange) write(w io.Writer, indent string) {
+	for _, fc := range pc.Files {
+		if fc.Binary {
+			fmt.Fprintf(w, "%s%s: binary\n", indent, fc.Name)
+			continue
+		}
+		var counts []string
+		if fc.Added > 0 {
+			counts = append(counts, fmt.Sprintf("+%d", fc.Added))
+		}
+		if fc.Removed > 0 {
+			counts = append(counts, fmt.Sprintf("-%d", fc.Removed))
+		}
+		if len(counts) == 0 {
+			counts = append(counts, "no lines changed")
+		}
+		fmt.Fprintf(w, "%s%s: %s\n", indent, fc.Name, strings.Join(counts, " "))
+	}
+	for _, note := range pc.Notes {
+		fmt.Fprintf(w, "%s%s\n", indent, note)
+	}
+}
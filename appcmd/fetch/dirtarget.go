@@ -1,20 +1,53 @@
 package fetch
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
 )
 
-type DirTarget string
+// DirTarget writes programs to a directory. It keeps a list of the files that
+// it wrote in .mind-meld/files.json, so that the next fetch can remove the
+// files of programs that were deleted or renamed in the app. Files that it
+// didn't write are left alone. Programs that were renamed in the app are
+// renamed in the directory too.
+type DirTarget struct {
+	Dir string
+
+	// Trash, if it's set, is a directory that old files are moved to,
+	// instead of being removed. A relative Trash is in Dir. Files that are
+	// already in the trash aren't replaced, so a file that is trashed again
+	// gets a name like "robot (2).py".
+	Trash string
+}
+
+// dirManifestName is where a DirTarget lists the files that it wrote, relative
+// to the directory.
+var dirManifestName = filepath.Join(".mind-meld", "files.json")
+
+type dirManifest struct {
+	// Files are relative to the directory, and use "/" to separate dirs
+	// so that the list is the same on every OS.
+	Files []string `json:"files"`
+}
 
 func (t DirTarget) Open() (TargetInstance, error) {
-	if st, err := os.Stat(string(t)); err != nil {
+	if st, err := os.Stat(t.Dir); err != nil {
 		return nil, err
 	} else if !st.IsDir() {
-		return nil, fmt.Errorf("%s is not a directory", t)
+		return nil, fmt.Errorf("%s is not a directory", t.Dir)
+	}
+	previous, err := t.readManifest()
+	if err != nil {
+		return nil, err
 	}
-	return &dirTargetInstance{t, 0}, nil
+	return &dirTargetInstance{dest: t, previous: previous, written: map[string]bool{}, renamedTo: map[string]bool{}}, nil
 }
 
 func (t DirTarget) PathSeparator() string {
@@ -22,17 +55,154 @@ func (t DirTarget) PathSeparator() string {
 }
 
 func (t DirTarget) path(name string) string {
-	return filepath.Join(string(t), name)
+	return filepath.Join(t.Dir, name)
+}
+
+func (t DirTarget) trashDir() string {
+	if filepath.IsAbs(t.Trash) {
+		return t.Trash
+	}
+	return filepath.Join(t.Dir, t.Trash)
+}
+
+// readManifest returns the names of the files that were written by the last
+// fetch. It's fine for there to not be a list yet.
+func (t DirTarget) readManifest() (map[string]bool, error) {
+	names := map[string]bool{}
+	data, err := os.ReadFile(t.path(dirManifestName))
+	if os.IsNotExist(err) {
+		return names, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var man dirManifest
+	if err := json.Unmarshal(data, &man); err != nil {
+		return nil, fmt.Errorf("%s: %w", t.path(dirManifestName), err)
+	}
+	for _, name := range man.Files {
+		// Don't let a bad list remove files outside of the directory.
+		if name := filepath.FromSlash(name); isLocal(name) {
+			names[name] = true
+		}
+	}
+	return names, nil
+}
+
+// isLocal reports whether name is a relative path that stays in the dir it's
+// relative to. It's like filepath.IsLocal, which needs a newer Go.
+func isLocal(name string) bool {
+	if name == "" || filepath.IsAbs(name) || filepath.VolumeName(name) != "" || strings.HasPrefix(name, string(filepath.Separator)) {
+		return false
+	}
+	clean := filepath.Clean(name)
+	return clean != ".." && !strings.HasPrefix(clean, ".."+string(filepath.Separator))
+}
+
+func (t DirTarget) writeManifest(names map[string]bool) error {
+	man := dirManifest{Files: []string{}}
+	for name := range names {
+		man.Files = append(man.Files, filepath.ToSlash(name))
+	}
+	sort.Strings(man.Files)
+	data, err := json.MarshalIndent(man, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := t.path(dirManifestName)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
 }
 
 type dirTargetInstance struct {
-	dest  DirTarget
-	count int
+	dest DirTarget
+
+	// previous are the files that the last fetch wrote.
+	previous map[string]bool
+	// written are the files that this fetch wrote.
+	written map[string]bool
+	// renamedTo are the new names of the files that Rename moved. They're
+	// only counted as renamed, not again when they're added.
+	renamedTo map[string]bool
+
+	// The counts leave out mind-meld's own files, like the index.
+	added, updated, unchanged, renamed, removed int
+}
+
+// bookkeeping reports whether name is one of the files in .mind-meld, which
+// aren't counted in the summary that Finish returns.
+func bookkeeping(name string) bool {
+	return strings.HasPrefix(name, ".mind-meld"+string(filepath.Separator))
+}
+
+// count adds one to n, unless name is a bookkeeping file.
+func count(n *int, name string) {
+	if !bookkeeping(name) {
+		*n++
+	}
+}
+
+func (d *dirTargetInstance) Previous(name string) ([]byte, error) {
+	data, err := os.ReadFile(d.dest.path(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Rename moves a file that the last fetch wrote. Files that it didn't write
+// are left alone, and so are files that would be replaced.
+func (d *dirTargetInstance) Rename(oldName, newName string) error {
+	if !d.previous[oldName] {
+		return nil
+	}
+	newPath := d.dest.path(newName)
+	if _, err := os.Lstat(newPath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+		return err
+	}
+	err := os.Rename(d.dest.path(oldName), newPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	delete(d.previous, oldName)
+	d.previous[newName] = true
+	d.renamedTo[newName] = true
+	count(&d.renamed, newName)
+	d.removeEmptyDirs(oldName)
+	return nil
 }
 
 func (d *dirTargetInstance) Add(name string, data []byte) error {
-	d.count++
+	d.written[name] = true
 	destFile := d.dest.path(name)
+
+	old, err := os.ReadFile(destFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	unchanged := err == nil && bytes.Equal(old, data)
+	if !d.renamedTo[name] {
+		switch {
+		case unchanged:
+			count(&d.unchanged, name)
+		case err == nil:
+			count(&d.updated, name)
+		default:
+			count(&d.added, name)
+		}
+	}
+	if unchanged {
+		return nil
+	}
+
 	if err := os.MkdirAll(filepath.Dir(destFile), 0o755); err != nil {
 		return err
 	}
@@ -40,5 +210,113 @@ func (d *dirTargetInstance) Add(name string, data []byte) error {
 }
 
 func (d *dirTargetInstance) Finish() (string, error) {
-	return fmt.Sprintf("%s: wrote %d files", d.dest, d.count), nil
+	var stale []string
+	for name := range d.previous {
+		if !d.written[name] {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	for _, name := range stale {
+		if err := d.remove(name); err != nil {
+			return "", err
+		}
+	}
+
+	if err := d.dest.writeManifest(d.written); err != nil {
+		return "", err
+	}
+
+	removed := "removed"
+	if d.dest.Trash != "" {
+		removed = "moved to " + d.dest.trashDir()
+	}
+	return fmt.Sprintf("%s: %d added, %d updated, %d unchanged, %d renamed, %d %s",
+		d.dest.Dir, d.added, d.updated, d.unchanged, d.renamed, d.removed, removed), nil
+}
+
+// remove removes a file that the last fetch wrote, or moves it to the trash.
+// Dirs that are left empty are removed too.
+func (d *dirTargetInstance) remove(name string) error {
+	path := d.dest.path(name)
+	var err error
+	if d.dest.Trash != "" {
+		err = d.trash(path, name)
+	} else {
+		err = os.Remove(path)
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	count(&d.removed, name)
+	d.removeEmptyDirs(name)
+	return nil
+}
+
+// trash moves the file at path to the trash, as name, or as a name like
+// "name (2)" if there's already a file named name there.
+func (d *dirTargetInstance) trash(path, name string) error {
+	if _, err := os.Lstat(path); err != nil {
+		return err
+	}
+	trashPath := filepath.Join(d.dest.trashDir(), name)
+	if err := os.MkdirAll(filepath.Dir(trashPath), 0o755); err != nil {
+		return err
+	}
+	ext := filepath.Ext(trashPath)
+	base := strings.TrimSuffix(trashPath, ext)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(trashPath); os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+		trashPath = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	return moveFile(path, trashPath)
+}
+
+// osRename is os.Rename, except in tests.
+var osRename = os.Rename
+
+// moveFile moves a file from src to dst. If they're on different devices, like
+// when the trash is on another disk, it copies the file and removes src.
+func moveFile(src, dst string) error {
+	err := osRename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	st, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, st.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// removeEmptyDirs removes the dirs that a file was in, if they're empty now.
+func (d *dirTargetInstance) removeEmptyDirs(name string) {
+	for dir := filepath.Dir(name); dir != "."; dir = filepath.Dir(dir) {
+		if os.Remove(d.dest.path(dir)) != nil {
+			break
+		}
+	}
 }
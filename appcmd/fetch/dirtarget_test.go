@@ -0,0 +1,113 @@
+package fetch
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fetchToDir(t *testing.T, target DirTarget, files map[string]string) string {
+	inst, err := target.Open()
+	require.NoError(t, err)
+	for name, data := range files {
+		require.NoError(t, inst.Add(name, []byte(data)))
+	}
+	msg, err := inst.Finish()
+	require.NoError(t, err)
+	return msg
+}
+
+func TestDirTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := DirTarget{Dir: dir}
+	sub := filepath.Join("sub", "b.py")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("mine"), 0o644))
+
+	msg := fetchToDir(t, target, map[string]string{"a.py": "a", sub: "b"})
+	assert.Equal(t, dir+": 2 added, 0 updated, 0 unchanged, 0 renamed, 0 removed", msg)
+
+	msg = fetchToDir(t, target, map[string]string{"a.py": "a2", "c.py": "c"})
+	assert.Equal(t, dir+": 1 added, 1 updated, 0 unchanged, 0 renamed, 1 removed", msg)
+	assert.NoFileExists(t, filepath.Join(dir, sub))
+	assert.NoDirExists(t, filepath.Join(dir, "sub"))
+	assert.FileExists(t, filepath.Join(dir, "README.md"))
+
+	data, err := os.ReadFile(filepath.Join(dir, ".mind-meld", "files.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"files": ["a.py", "c.py"]}`, string(data))
+
+	msg = fetchToDir(t, target, map[string]string{"a.py": "a2", "c.py": "c"})
+	assert.Equal(t, dir+": 0 added, 0 updated, 2 unchanged, 0 renamed, 0 removed", msg)
+}
+
+func TestDirTargetTrash(t *testing.T) {
+	dir := t.TempDir()
+	trash := t.TempDir()
+	target := DirTarget{Dir: dir, Trash: trash}
+	sub := filepath.Join("sub", "b.py")
+
+	fetchToDir(t, target, map[string]string{"a.py": "a", sub: "b"})
+	msg := fetchToDir(t, target, map[string]string{"a.py": "a"})
+	assert.Equal(t, dir+": 0 added, 0 updated, 1 unchanged, 0 renamed, 1 moved to "+trash, msg)
+	assert.NoFileExists(t, filepath.Join(dir, sub))
+
+	data, err := os.ReadFile(filepath.Join(trash, sub))
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(data))
+}
+
+func TestDirTargetTrashAgain(t *testing.T) {
+	dir := t.TempDir()
+	target := DirTarget{Dir: dir, Trash: ".trash"}
+	trash := filepath.Join(dir, ".trash")
+
+	for _, data := range []string{"one", "two", "three"} {
+		fetchToDir(t, target, map[string]string{"a.py": data})
+		msg := fetchToDir(t, target, nil)
+		assert.Equal(t, dir+": 0 added, 0 updated, 0 unchanged, 0 renamed, 1 moved to "+trash, msg)
+	}
+
+	for name, expected := range map[string]string{"a.py": "one", "a (2).py": "two", "a (3).py": "three"} {
+		data, err := os.ReadFile(filepath.Join(trash, name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(data), name)
+	}
+}
+
+func TestDirTargetTrashOtherDevice(t *testing.T) {
+	osRename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	defer func() { osRename = os.Rename }()
+
+	dir := t.TempDir()
+	trash := t.TempDir()
+	target := DirTarget{Dir: dir, Trash: trash}
+
+	fetchToDir(t, target, map[string]string{"a.py": "a"})
+	fetchToDir(t, target, nil)
+	assert.NoFileExists(t, filepath.Join(dir, "a.py"))
+	data, err := os.ReadFile(filepath.Join(trash, "a.py"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(data))
+}
+
+func TestIsLocal(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"a.py":                              true,
+		filepath.Join("sub", "b.py"):        true,
+		filepath.Join("sub", "..", "c"):     true,
+		"":                                  false,
+		"..":                                false,
+		filepath.Join("..", "a.py"):         false,
+		filepath.Join("sub", "..", ".."):    false,
+		string(filepath.Separator) + "a.py": false,
+	} {
+		assert.Equal(t, expected, isLocal(name), name)
+	}
+}
@@ -1,11 +1,14 @@
 package fetch
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spraints/mind-meld/appcmd"
+	"github.com/spraints/mind-meld/lmsdump"
 	"github.com/spraints/mind-meld/lmsp"
 )
 
@@ -19,66 +22,157 @@ type TargetInstance interface {
 	Finish() (string, error)
 }
 
-func Run(app appcmd.App, target Target) (string, error) {
+// ProgramTarget is a TargetInstance that keeps track of which program each
+// file is from.
+type ProgramTarget interface {
+	TargetInstance
+
+	// AddProgramFile is like Add, for one of prog's files. Run uses it
+	// instead of Add for all of the files that it writes for programs.
+	AddProgramFile(prog Program, name string, data []byte) error
+}
+
+// Program is a program file and its manifest.
+type Program struct {
+	Project
+	Manifest lmsp.Manifest
+}
+
+// Options controls which files are written for each program.
+type Options struct {
+	// ProjectJSON, when set, also writes the raw project.json of block
+	// programs next to their text rendering.
+	ProjectJSON bool
+
+	// Originals, when set, also stores a copy of each program file, so that
+	// it can be restored into the app with its icon, block layout and
+	// settings. The copies are named like OriginalName returns.
+	Originals bool
+}
+
+func Run(app appcmd.App, target Target, opts Options) (string, error) {
 	t, err := target.Open()
 	if err != nil {
 		return "", err
 	}
 
-	projects, err := listProjects(app, target)
+	_, projects, err := ListProjects(app, target.PathSeparator())
+	if err != nil {
+		return "", err
+	}
 
+	// Read everything first, so that renamed programs can be moved before
+	// their new content is added.
+	ix := newIndexer(target.PathSeparator())
+	var programs []Program
+	var files [][]file
 	for _, project := range projects {
-		data, err := readPythonProject(project)
+		projectFiles, man, err := readProject(project, opts, target.PathSeparator())
 		if err != nil {
 			return "", fmt.Errorf("%s: %w", project.RelPath, err)
 		}
+		ix.add(man.ID, project, man.Created)
+		programs = append(programs, Program{Project: project, Manifest: man})
+		files = append(files, projectFiles)
+	}
+	index := ix.index()
+
+	var renamed []rename
+	if rt, ok := t.(RenamingTarget); ok {
+		renamed, err = followRenames(rt, target.PathSeparator(), index)
+		if err != nil {
+			return "", fmt.Errorf("error following renamed programs: %w", err)
+		}
+	}
 
-		if data != nil {
-			if err := t.Add(pyName(project), data); err != nil {
-				return "", fmt.Errorf("%s: %w", project.RelPath, err)
+	for i, prog := range programs {
+		for _, f := range files[i] {
+			if pt, ok := t.(ProgramTarget); ok {
+				err = pt.AddProgramFile(prog, f.Name, f.Data)
+			} else {
+				err = t.Add(f.Name, f.Data)
+			}
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", prog.RelPath, err)
 			}
 		}
 	}
 
+	indexData, err := index.encode()
+	if err != nil {
+		return "", err
+	}
+	if err := t.Add(IndexName(target.PathSeparator()), indexData); err != nil {
+		return "", err
+	}
+
 	msg, err := t.Finish()
 	if err != nil {
 		return "", fmt.Errorf("error finishing fetch: %w", err)
 	}
 
+	for _, r := range renamed {
+		msg += fmt.Sprintf("\nrenamed %s -> %s", r.Old, r.New)
+	}
+
 	return msg, nil
 }
 
-func pyName(p project) string {
+// PyName is the name that a python program is stored as.
+func PyName(p Project) string {
+	return outputName(p, ".py")
+}
+
+func blocksName(p Project) string {
+	return outputName(p, ".blocks.txt")
+}
+
+func projectJSONName(p Project) string {
+	return outputName(p, ".project.json")
+}
+
+func outputName(p Project, suffix string) string {
 	ext := filepath.Ext(p.RelPath)
 	bareRelPath := p.RelPath[:len(p.RelPath)-len(ext)]
-	return bareRelPath + ".py"
+	return bareRelPath + suffix
+}
+
+// file is something that will be added to the target.
+type file struct {
+	Name string
+	Data []byte
 }
 
-type project struct {
+// Project is a program file in one of an app's project dirs.
+type Project struct {
 	// RelPath is the dirs + filename, relative to the root of mindstorms's storage dir.
 	RelPath string
 	// Path is the original path to the file.
 	Path string
 }
 
-func listProjects(app appcmd.App, target Target) ([]project, error) {
+// ListProjects finds all of the program files in the first of app's project
+// dirs that exists. It returns the dir that it used along with the programs.
+// Each RelPath uses sep to separate its dirs. Some apps share a dir, so
+// program files that belong to a different app are skipped.
+func ListProjects(app appcmd.App, sep string) (string, []Project, error) {
 	for _, d := range app.ProjectDirs() {
-		found, err := walkProjectDir(d, "", target.PathSeparator(), nil)
+		found, err := walkProjectDir(d, "", sep, app.ProjectExts(), nil)
 		if err == nil {
-			return found, nil
+			return d, found, nil
 		}
 	}
-	return nil, fmt.Errorf("no project dir found (checked %v)", app.ProjectDirs())
+	return "", nil, fmt.Errorf("no project dir found (checked %v)", app.ProjectDirs())
 }
 
-func walkProjectDir(dirname string, relPrefix string, sep string, result []project) ([]project, error) {
+func walkProjectDir(dirname string, relPrefix string, sep string, exts []string, result []Project) ([]Project, error) {
 	entries, err := os.ReadDir(dirname)
 	if err != nil {
 		return nil, err
 	}
 	for _, e := range entries {
 		if e.IsDir() {
-			p, err := walkProjectDir(filepath.Join(dirname, e.Name()), relPrefix+e.Name()+sep, sep, result)
+			p, err := walkProjectDir(filepath.Join(dirname, e.Name()), relPrefix+e.Name()+sep, sep, exts, result)
 			if err != nil {
 				return nil, err
 			}
@@ -86,8 +180,8 @@ func walkProjectDir(dirname string, relPrefix string, sep string, result []proje
 			continue
 		}
 
-		if e.Type().IsRegular() {
-			result = append(result, project{
+		if e.Type().IsRegular() && !otherAppsProgram(e.Name(), exts) {
+			result = append(result, Project{
 				RelPath: relPrefix + e.Name(),
 				Path:    filepath.Join(dirname, e.Name()),
 			})
@@ -96,30 +190,90 @@ func walkProjectDir(dirname string, relPrefix string, sep string, result []proje
 	return result, nil
 }
 
-func readPythonProject(proj project) ([]byte, error) {
-	f, err := os.Open(proj.Path)
+// otherAppsProgram returns true if name is a program file, but not one with
+// any of exts.
+func otherAppsProgram(name string, exts []string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range exts {
+		if strings.EqualFold(ext, e) {
+			return false
+		}
+	}
+	for _, e := range programExts {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// OriginalName is the name that a copy of a program file is stored as, in a
+// target with the given path separator.
+func OriginalName(p Project, sep string) string {
+	return ".mind-meld" + sep + "originals" + sep + p.RelPath
+}
+
+func readProject(proj Project, opts Options, sep string) ([]file, lmsp.Manifest, error) {
+	data, err := os.ReadFile(proj.Path)
 	if err != nil {
-		return nil, err
+		return nil, lmsp.Manifest{}, err
 	}
 
-	l, err := lmsp.ReadFile(f)
+	l, err := lmsp.Read(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
-		return nil, err
+		return nil, lmsp.Manifest{}, err
 	}
 
 	man, err := l.Manifest()
 	if err != nil {
-		return nil, err
+		return nil, lmsp.Manifest{}, err
 	}
 
-	if man.Type != "python" {
-		fmt.Printf("%s: skip %s program\n", proj.RelPath, man.Type)
-		return nil, nil
+	var files []file
+	if man.Type == "python" {
+		program, err := l.Python()
+		if err != nil {
+			return nil, man, err
+		}
+		files = []file{{PyName(proj), []byte(program)}}
+	} else {
+		// A block program that can't be read is skipped, so that the
+		// rest of the programs are still fetched.
+		files, err = readBlocksProject(proj, l, man, opts)
+		if err != nil {
+			fmt.Printf("%s: warning: skip %s program: %v\n", proj.RelPath, man.Type, err)
+			files = nil
+		}
+	}
+
+	if opts.Originals {
+		files = append(files, file{OriginalName(proj, sep), data})
 	}
+	return files, man, nil
+}
 
-	program, err := l.Python()
+func readBlocksProject(proj Project, l *lmsp.Reader, man lmsp.Manifest, opts Options) ([]file, error) {
+	raw, err := l.ProjectJSON()
 	if err != nil {
 		return nil, err
 	}
-	return []byte(program), nil
+
+	p, problems, err := lmsp.DecodeProject(raw, lmsp.DecodeOptions{Lenient: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, problem := range problems {
+		fmt.Printf("%s: warning: %v\n", proj.RelPath, problem)
+	}
+
+	var dumped bytes.Buffer
+	if err := (lmsdump.Options{Manifest: &man}).Dump(&dumped, p); err != nil {
+		return nil, err
+	}
+
+	files := []file{{blocksName(proj), dumped.Bytes()}}
+	if opts.ProjectJSON {
+		files = append(files, file{projectJSONName(proj), raw})
+	}
+	return files, nil
 }
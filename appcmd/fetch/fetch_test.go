@@ -0,0 +1,88 @@
+package fetch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spraints/mind-meld/lmsp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadProjectOriginals(t *testing.T) {
+	path := filepath.Join("..", "..", "lmsdump", "testdata", "project.lms")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	proj := Project{RelPath: "dir/project.lms", Path: path}
+
+	files, man, err := readProject(proj, Options{}, "/")
+	require.NoError(t, err)
+	assert.Equal(t, "Project 1", man.Name)
+	require.Len(t, files, 1)
+	assert.Equal(t, "dir/project.blocks.txt", files[0].Name)
+
+	files, _, err = readProject(proj, Options{Originals: true}, "/")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, ".mind-meld/originals/dir/project.lms", files[1].Name)
+	assert.Equal(t, data, files[1].Data)
+}
+
+func TestReadProjectWithBadBlock(t *testing.T) {
+	f, err := os.Open(filepath.Join("..", "..", "lmsdump", "testdata", "project.lms"))
+	require.NoError(t, err)
+	defer f.Close()
+	l, err := lmsp.ReadFile(f)
+	require.NoError(t, err)
+	proj, err := l.Project()
+	require.NoError(t, err)
+	proj.Targets[1].Blocks["bad"] = &lmsp.ProjectBlockRaw{Raw: []byte(`{"opcode": 5}`)}
+
+	path := filepath.Join(t.TempDir(), "bad.lms")
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	w := lmsp.NewWriter(l)
+	w.SetProject(proj)
+	_, err = w.WriteTo(out)
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+
+	files, _, err := readProject(Project{RelPath: "bad.lms", Path: path}, Options{}, "/")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "bad.blocks.txt", files[0].Name)
+	assert.True(t, strings.Contains(string(files[0].Data), "when I receive"), string(files[0].Data))
+}
+
+type testApp struct {
+	dir  string
+	exts []string
+}
+
+func (testApp) FullName() string        { return "test app" }
+func (a testApp) ProjectDirs() []string { return []string{a.dir} }
+func (a testApp) ProjectExts() []string { return a.exts }
+
+func TestListProjects(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.lms", "b.LMSP", "c.llsp3", "d.llsp", "notes.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	names := func(exts ...string) []string {
+		d, projects, err := ListProjects(testApp{dir, exts}, "/")
+		require.NoError(t, err)
+		assert.Equal(t, dir, d)
+		var names []string
+		for _, p := range projects {
+			names = append(names, p.RelPath)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"a.lms", "b.LMSP", "notes.txt"}, names(".lms", ".lmsp"))
+	assert.Equal(t, []string{"d.llsp", "notes.txt"}, names(".llsp"))
+	assert.Equal(t, []string{"c.llsp3", "notes.txt"}, names(".llsp3"))
+}
@@ -3,7 +3,9 @@ package fetch
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -11,8 +13,18 @@ import (
 )
 
 type GitTarget struct {
-	Ref           string
+	Ref string
+
+	// CommitMessage is the message for the commit, unless it's empty. Then
+	// the message lists the programs that were added, changed and removed.
 	CommitMessage string
+
+	// CommitPerProgram, when set, makes a commit for each program that
+	// changed, dated when the program was last saved in the app. The
+	// commits are made in the order that the programs were saved. Other
+	// changes, like removed programs, are committed after them with
+	// CommitMessage.
+	CommitPerProgram bool
 }
 
 func (t GitTarget) refName() plumbing.ReferenceName {
@@ -22,19 +34,21 @@ func (t GitTarget) refName() plumbing.ReferenceName {
 	return plumbing.ReferenceName("refs/heads/" + string(t.Ref))
 }
 
-func (t GitTarget) commitMessage() string {
-	if t.CommitMessage != "" {
-		return t.CommitMessage
-	}
-	return "Update copy of mindstorms programs"
-}
+// defaultCommitMessage is used when nothing but mind-meld's own files changed.
+const defaultCommitMessage = "Update copy of mindstorms programs"
 
 func (t GitTarget) Open() (TargetInstance, error) {
 	repo, err := git.PlainOpen(".")
 	if err != nil {
 		return nil, err
 	}
-	return &gitTargetInstance{t, repo, NewTreeBuilder(repo)}, nil
+	return &gitTargetInstance{
+		dest:     t,
+		repo:     repo,
+		tt:       NewTreeBuilder(repo),
+		renames:  map[string]string{},
+		programs: map[string]*gitProgram{},
+	}, nil
 }
 
 func (t GitTarget) PathSeparator() string {
@@ -45,32 +59,270 @@ type gitTargetInstance struct {
 	dest GitTarget
 	repo *git.Repository
 	tt   *TreeBuilder
+
+	// renames are files that are moved in a commit of their own, before the
+	// new content is committed, so that "git log --follow" can track them.
+	renames map[string]string
+
+	// programs are the programs that files were added for, by RelPath, in
+	// the order that they were added.
+	programs     map[string]*gitProgram
+	programOrder []*gitProgram
+}
+
+type gitProgram struct {
+	Program
+	files []string
+}
+
+// parentTree returns the tree of the ref's commit, or nil if the ref doesn't
+// exist yet.
+func (g *gitTargetInstance) parentTree() (*object.Tree, error) {
+	ref, err := g.repo.Reference(g.dest.refName(), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, err := g.repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return c.Tree()
+}
+
+// parentFiles returns the files in the ref's tree.
+func (g *gitTargetInstance) parentFiles() (map[string]plumbing.Hash, error) {
+	files := map[string]plumbing.Hash{}
+	tree, err := g.parentTree()
+	if err != nil || tree == nil {
+		return files, err
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		files[f.Name] = f.Hash
+		return nil
+	})
+	return files, err
+}
+
+func (g *gitTargetInstance) Previous(name string) ([]byte, error) {
+	tree, err := g.parentTree()
+	if err != nil || tree == nil {
+		return nil, err
+	}
+	f, err := tree.File(name)
+	if err == object.ErrFileNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.Contents()
+	return []byte(data), err
+}
+
+// Rename moves a file in the ref's tree. Files that aren't there are left
+// alone, and so are files that would be replaced.
+func (g *gitTargetInstance) Rename(oldName, newName string) error {
+	tree, err := g.parentTree()
+	if err != nil || tree == nil {
+		return err
+	}
+	if _, err := tree.File(oldName); err != nil {
+		return nil
+	}
+	if _, err := tree.File(newName); err == nil {
+		return nil
+	}
+	g.renames[oldName] = newName
+	return nil
 }
 
 func (g *gitTargetInstance) Add(name string, data []byte) error {
 	return g.tt.Add(name, data)
 }
 
+func (g *gitTargetInstance) AddProgramFile(prog Program, name string, data []byte) error {
+	p := g.programs[prog.RelPath]
+	if p == nil {
+		p = &gitProgram{Program: prog}
+		g.programs[prog.RelPath] = p
+		g.programOrder = append(g.programOrder, p)
+	}
+	p.files = append(p.files, name)
+	return g.Add(name, data)
+}
+
 func (g *gitTargetInstance) Finish() (string, error) {
+	var commits []plumbing.Hash
+	addCommit := func(commitID plumbing.Hash) {
+		if !commitID.IsZero() {
+			commits = append(commits, commitID)
+		}
+	}
+
+	commitID, err := g.commitRenames()
+	if err != nil {
+		return "", err
+	}
+	addCommit(commitID)
+
+	if g.dest.CommitPerProgram {
+		programCommits, err := g.commitPrograms()
+		if err != nil {
+			return "", err
+		}
+		commits = append(commits, programCommits...)
+	}
+
 	tree, err := g.tt.Finish()
 	if err != nil {
 		return "", err
 	}
 
 	targetRef := g.dest.refName()
-	commitID, err := createCommit(g.repo, targetRef, tree, g.dest.commitMessage())
+	msg, err := g.commitMessage(tree)
 	if err != nil {
 		return "", err
 	}
+	commitID, err = createCommit(g.repo, targetRef, tree, msg, time.Time{})
+	if err != nil {
+		return "", err
+	}
+	addCommit(commitID)
 
-	if commitID.IsZero() {
+	switch len(commits) {
+	case 0:
 		return fmt.Sprintf("%s: no changes found", targetRef), nil
+	case 1:
+		return fmt.Sprintf("%s: created commit %v", targetRef, commits[0]), nil
+	default:
+		return fmt.Sprintf("%s: created %d commits, ending with %v", targetRef, len(commits), commits[len(commits)-1]), nil
 	}
+}
 
-	return fmt.Sprintf("%s: created commit %v", targetRef, commitID), nil
+// commitMessage returns the message for a commit of tree.
+func (g *gitTargetInstance) commitMessage(tree plumbing.Hash) (string, error) {
+	if g.dest.CommitMessage != "" {
+		return g.dest.CommitMessage, nil
+	}
+	oldFiles, err := g.parentFiles()
+	if err != nil {
+		return "", err
+	}
+	changes, err := summarizeChanges(g.repo, oldFiles, g.tt.blobs)
+	if err != nil {
+		return "", err
+	}
+	if msg := changeMessage(changes); msg != "" {
+		return msg, nil
+	}
+	return defaultCommitMessage, nil
 }
 
-func createCommit(g *git.Repository, refName plumbing.ReferenceName, tree plumbing.Hash, commitMsg string) (plumbing.Hash, error) {
+// commitPrograms makes a commit for each program whose files changed, in the
+// order that they were saved.
+func (g *gitTargetInstance) commitPrograms() ([]plumbing.Hash, error) {
+	files, err := g.parentFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []*gitProgram
+	for _, p := range g.programOrder {
+		for _, name := range p.files {
+			if files[name] != g.tt.blobs[name] {
+				changed = append(changed, p)
+				break
+			}
+		}
+	}
+	sort.SliceStable(changed, func(i, j int) bool {
+		return changed[i].Manifest.LastSaved.Before(changed[j].Manifest.LastSaved)
+	})
+
+	var commits []plumbing.Hash
+	for _, p := range changed {
+		oldFiles := map[string]plumbing.Hash{}
+		newFiles := map[string]plumbing.Hash{}
+		for _, name := range p.files {
+			if oid, ok := files[name]; ok {
+				oldFiles[name] = oid
+			}
+			newFiles[name] = g.tt.blobs[name]
+			files[name] = g.tt.blobs[name]
+		}
+		changes, err := summarizeChanges(g.repo, oldFiles, newFiles)
+		if err != nil {
+			return nil, err
+		}
+		tree, err := createTree(g.repo, files)
+		if err != nil {
+			return nil, err
+		}
+		commitID, err := createCommit(g.repo, g.dest.refName(), tree, programCommitMessage(p, changes), p.Manifest.LastSaved)
+		if err != nil {
+			return nil, err
+		}
+		if !commitID.IsZero() {
+			commits = append(commits, commitID)
+		}
+	}
+	return commits, nil
+}
+
+// programCommitMessage names the program and its type, and summarizes the
+// changes to its files.
+func programCommitMessage(p *gitProgram, changes []programChange) string {
+	name := p.Manifest.Name
+	if name == "" {
+		name = outputName(p.Project, "")
+	}
+	verb := "Update"
+	if len(changes) == 1 && changes[0].Kind == "added" {
+		verb = "Add"
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "%s %s (%s)\n\n", verb, name, p.Manifest.Type)
+	for _, pc := range changes {
+		pc.write(&msg, "")
+	}
+	return msg.String()
+}
+
+// commitRenames commits the ref's tree with the renamed files moved, and
+// nothing else changed.
+func (g *gitTargetInstance) commitRenames() (plumbing.Hash, error) {
+	if len(g.renames) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+	files, err := g.parentFiles()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	for oldName, newName := range g.renames {
+		files[newName] = files[oldName]
+		delete(files, oldName)
+	}
+	treeID, err := createTree(g.repo, files)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var lines []string
+	for oldName, newName := range g.renames {
+		lines = append(lines, oldName+" -> "+newName+"\n")
+	}
+	sort.Strings(lines)
+	msg := "Rename mindstorms programs\n\n" + strings.Join(lines, "")
+	return createCommit(g.repo, g.dest.refName(), treeID, msg, time.Time{})
+}
+
+// createCommit commits tree on top of refName, and returns the new commit's ID.
+// The commit's author date is when, unless it's zero. If the tree hasn't
+// changed, nothing is committed, and the ID is zero.
+func createCommit(g *git.Repository, refName plumbing.ReferenceName, tree plumbing.Hash, commitMsg string, when time.Time) (plumbing.Hash, error) {
 	// Check the ref.
 	// If the tree is the same, there's nothing to do.
 	// If the ref is there, use its OID as the parent commit.
@@ -95,6 +347,9 @@ func createCommit(g *git.Repository, refName plumbing.ReferenceName, tree plumbi
 	// Build the commit.
 	var c object.Commit
 	c.Author = *o.Author
+	if !when.IsZero() {
+		c.Author.When = when
+	}
 	c.Committer = *o.Committer
 	c.Message = commitMsg
 	c.TreeHash = tree
@@ -0,0 +1,143 @@
+package fetch
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spraints/mind-meld/lmsp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initGitRepo creates a repository in a temporary directory and changes to
+// it, because GitTarget uses the repository in the current directory.
+func initGitRepo(t *testing.T) *git.Repository {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	cfg, err := repo.Config()
+	require.NoError(t, err)
+	cfg.User.Name = "Test"
+	cfg.User.Email = "test@example.com"
+	require.NoError(t, repo.SetConfig(cfg))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+	return repo
+}
+
+// gitLog returns the commits on ref, newest first.
+func gitLog(t *testing.T, repo *git.Repository, ref string) []*object.Commit {
+	r, err := repo.Reference(GitTarget{Ref: ref}.refName(), true)
+	require.NoError(t, err)
+	commits, err := repo.Log(&git.LogOptions{From: r.Hash()})
+	require.NoError(t, err)
+	var res []*object.Commit
+	require.NoError(t, commits.ForEach(func(c *object.Commit) error {
+		res = append(res, c)
+		return nil
+	}))
+	return res
+}
+
+func testProgram(relPath, name, typ string, lastSaved time.Time) Program {
+	return Program{
+		Project:  Project{RelPath: relPath},
+		Manifest: lmsp.Manifest{Name: name, Type: typ, LastSaved: lastSaved},
+	}
+}
+
+func TestGitTargetCommitPerProgram(t *testing.T) {
+	repo := initGitRepo(t)
+	target := GitTarget{Ref: "programs", CommitMessage: "Update", CommitPerProgram: true}
+
+	jan1 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	jan2 := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	fetch := func(progs ...Program) string {
+		inst, err := target.Open()
+		require.NoError(t, err)
+		for _, prog := range progs {
+			name := outputName(prog.Project, ".py")
+			require.NoError(t, inst.(ProgramTarget).AddProgramFile(prog, name, []byte(prog.Manifest.Name+" "+prog.Manifest.LastSaved.String())))
+		}
+		msg, err := inst.Finish()
+		require.NoError(t, err)
+		return msg
+	}
+
+	fetch(
+		testProgram("drive.llsp", "drive", "python", jan2),
+		testProgram("arm.llsp", "arm", "python", jan1),
+	)
+	log := gitLog(t, repo, "programs")
+	require.Len(t, log, 2)
+	assert.Equal(t, "Add drive (python)\n\ndrive.py: +1\n", log[0].Message)
+	assert.True(t, jan2.Equal(log[0].Author.When))
+	assert.Equal(t, "Add arm (python)\n\narm.py: +1\n", log[1].Message)
+	assert.True(t, jan1.Equal(log[1].Author.When))
+
+	jan3 := time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)
+	msg := fetch(testProgram("drive.llsp", "drive", "python", jan3))
+	assert.True(t, strings.HasPrefix(msg, "refs/heads/programs: created 2 commits"), msg)
+	log = gitLog(t, repo, "programs")
+	require.Len(t, log, 4)
+	assert.Equal(t, "Update", log[0].Message)
+	assert.Equal(t, "Update drive (python)\n\ndrive.py: +1 -1\n", log[1].Message)
+	assert.True(t, jan3.Equal(log[1].Author.When))
+}
+
+func TestGitTargetCommitMessage(t *testing.T) {
+	repo := initGitRepo(t)
+	target := GitTarget{Ref: "programs"}
+	fetch := func(files map[string]string) {
+		inst, err := target.Open()
+		require.NoError(t, err)
+		for name, data := range files {
+			require.NoError(t, inst.Add(name, []byte(data)))
+		}
+		_, err = inst.Finish()
+		require.NoError(t, err)
+	}
+
+	fetch(map[string]string{
+		"drive.py":        "a\nb\n",
+		"arm.py":          "arm\n",
+		"sub/lift.py":     "lift\n",
+		IndexName("/"):    "{}\n",
+		"line.blocks.txt": "target: Stage\n  ----- a -----\n  when program starts:\n    stop()\n",
+	})
+	fetch(map[string]string{
+		"drive.py":        "a\nc\nd\n",
+		"new.py":          "new\n",
+		IndexName("/"):    "{}\n",
+		"line.blocks.txt": "target: Stage\n  ----- a -----\n  when program starts:\n    go()\n  ----- b -----\n  when pressed:\n",
+	})
+
+	log := gitLog(t, repo, "programs")
+	require.Len(t, log, 2)
+	assert.True(t, strings.HasPrefix(log[1].Message, "Add 4 programs\n\n"), log[1].Message)
+	assert.Equal(t, `Add new; update drive, line; remove arm, sub/lift
+
+added new:
+  new.py: +1
+
+changed drive:
+  drive.py: +2 -1
+
+changed line:
+  line.blocks.txt: +3 -1
+  1 script added, 1 script changed
+
+removed arm:
+  arm.py: -1
+
+removed sub/lift:
+  sub/lift.py: -1
+`, log[0].Message)
+}
@@ -0,0 +1,157 @@
+package fetch
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Index maps the IDs of programs to where their files are stored, so that a
+// program that's renamed in the app can be followed. It's stored in the
+// target, in the file that IndexName returns.
+type Index map[string]IndexEntry
+
+type IndexEntry struct {
+	// Name is the program's path without its extension, like "dir/robot".
+	// Dirs are always separated with "/".
+	Name string `json:"name"`
+	// Created is when the program was created in the app.
+	Created time.Time `json:"created"`
+}
+
+// IndexName is the name of the index file in a target with the given path
+// separator.
+func IndexName(sep string) string {
+	return ".mind-meld" + sep + "index.json"
+}
+
+// RenamingTarget is a TargetInstance that can follow programs that are
+// renamed in the app.
+type RenamingTarget interface {
+	TargetInstance
+
+	// Previous returns a file as the last fetch left it, or nil if there
+	// wasn't one.
+	Previous(name string) ([]byte, error)
+
+	// Rename moves a file that the last fetch wrote. It's not an error if
+	// the file doesn't exist.
+	Rename(oldName, newName string) error
+}
+
+// outputSuffixes are the suffixes of the files that can be written for a
+// program.
+var outputSuffixes = []string{".py", ".blocks.txt", ".project.json"}
+
+// programExts are the extensions of the apps' program files, for renaming the
+// copies that Options.Originals stores.
+var programExts = []string{".lms", ".lmsp", ".llsp", ".llsp3"}
+
+func readIndex(data []byte) (Index, error) {
+	index := Index{}
+	if data == nil {
+		return index, nil
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (index Index) encode() ([]byte, error) {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// indexer builds an index of the programs that are being fetched.
+type indexer struct {
+	entries map[string][]IndexEntry
+	sep     string
+}
+
+func newIndexer(sep string) *indexer {
+	return &indexer{entries: map[string][]IndexEntry{}, sep: sep}
+}
+
+// add records that the program with the given ID is stored with the same name
+// as proj.
+func (ix *indexer) add(id string, proj Project, created time.Time) {
+	if id == "" {
+		return
+	}
+	name := strings.ReplaceAll(outputName(proj, ""), ix.sep, "/")
+	ix.entries[id] = append(ix.entries[id], IndexEntry{Name: name, Created: created})
+}
+
+// index returns the index. Programs that share an ID, like copies of a file,
+// are left out, because there's no way to tell which one is the original.
+func (ix *indexer) index() Index {
+	index := Index{}
+	for id, entries := range ix.entries {
+		if len(entries) == 1 {
+			index[id] = entries[0]
+		}
+	}
+	return index
+}
+
+// rename is a program that's been renamed since the last fetch.
+type rename struct {
+	Old, New string
+}
+
+// renames compares the last fetch's index to this one, and finds the programs
+// that were renamed. A program isn't moved onto a name that another program
+// had in the last fetch.
+func renames(previous, current Index) []rename {
+	taken := map[string]bool{}
+	for _, e := range previous {
+		taken[e.Name] = true
+	}
+	var res []rename
+	for id, e := range current {
+		old, ok := previous[id]
+		if !ok || old.Name == e.Name || taken[e.Name] {
+			continue
+		}
+		res = append(res, rename{Old: old.Name, New: e.Name})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Old < res[j].Old })
+	return res
+}
+
+// followRenames moves the files of programs that were renamed since the last
+// fetch, and returns the renames. Names in the index always use "/", so
+// they're changed to use the target's separator.
+func followRenames(t RenamingTarget, sep string, current Index) ([]rename, error) {
+	data, err := t.Previous(IndexName(sep))
+	if err != nil {
+		return nil, err
+	}
+	previous, err := readIndex(data)
+	if err != nil {
+		return nil, err
+	}
+	found := renames(previous, current)
+	for _, r := range found {
+		oldName := strings.ReplaceAll(r.Old, "/", sep)
+		newName := strings.ReplaceAll(r.New, "/", sep)
+		for _, suffix := range outputSuffixes {
+			if err := t.Rename(oldName+suffix, newName+suffix); err != nil {
+				return nil, err
+			}
+		}
+		for _, ext := range programExts {
+			oldOriginal := OriginalName(Project{RelPath: oldName + ext}, sep)
+			newOriginal := OriginalName(Project{RelPath: newName + ext}, sep)
+			if err := t.Rename(oldOriginal, newOriginal); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,132 @@
+package fetch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexer(t *testing.T) {
+	ix := newIndexer("\\")
+	ix.add("a", Project{RelPath: `dir\robot.llsp`}, time.Time{})
+	ix.add("b", Project{RelPath: "copy 1.llsp"}, time.Time{})
+	ix.add("b", Project{RelPath: "copy 2.llsp"}, time.Time{})
+	ix.add("", Project{RelPath: "old.lms"}, time.Time{})
+
+	assert.Equal(t, Index{"a": {Name: "dir/robot"}}, ix.index())
+}
+
+func TestRenames(t *testing.T) {
+	previous := Index{
+		"a": {Name: "robot"},
+		"b": {Name: "arm"},
+		"c": {Name: "same"},
+		"d": {Name: "gone"},
+	}
+	current := Index{
+		"a": {Name: "sub/robot"},
+		"b": {Name: "gone"}, // "gone" belonged to another program
+		"c": {Name: "same"},
+		"e": {Name: "new"},
+	}
+	assert.Equal(t, []rename{{Old: "robot", New: "sub/robot"}}, renames(previous, current))
+}
+
+func TestFollowRenamesInDir(t *testing.T) {
+	dir := t.TempDir()
+	target := DirTarget{Dir: dir}
+	sep := target.PathSeparator()
+
+	index := Index{"a": {Name: "robot"}}
+	indexData, err := index.encode()
+	require.NoError(t, err)
+	msg := fetchToDir(t, target, map[string]string{
+		"robot.blocks.txt": "blocks",
+		IndexName(sep):     string(indexData),
+	})
+	assert.Equal(t, dir+": 1 added, 0 updated, 0 unchanged, 0 renamed, 0 removed", msg)
+
+	inst, err := target.Open()
+	require.NoError(t, err)
+	found, err := followRenames(inst.(RenamingTarget), sep, Index{"a": {Name: "sub/robot"}})
+	require.NoError(t, err)
+	assert.Equal(t, []rename{{Old: "robot", New: "sub/robot"}}, found)
+
+	newName := filepath.Join("sub", "robot.blocks.txt")
+	require.NoError(t, inst.Add(newName, []byte("blocks")))
+	indexData, err = Index{"a": {Name: "sub/robot"}}.encode()
+	require.NoError(t, err)
+	require.NoError(t, inst.Add(IndexName(sep), indexData))
+	msg, err = inst.Finish()
+	require.NoError(t, err)
+	assert.Equal(t, dir+": 0 added, 0 updated, 0 unchanged, 1 renamed, 0 removed", msg)
+
+	assert.NoFileExists(t, filepath.Join(dir, "robot.blocks.txt"))
+	data, err := os.ReadFile(filepath.Join(dir, newName))
+	require.NoError(t, err)
+	assert.Equal(t, "blocks", string(data))
+}
+
+// TestFollowRenamesInGit makes sure that a renamed program is moved in a
+// commit of its own, which git log --follow can see as a rename.
+func TestFollowRenamesInGit(t *testing.T) {
+	repo := initGitRepo(t)
+	target := GitTarget{Ref: "programs"}
+	sep := target.PathSeparator()
+
+	fetch := func(index Index, files map[string]string) {
+		inst, err := target.Open()
+		require.NoError(t, err)
+		_, err = followRenames(inst.(RenamingTarget), sep, index)
+		require.NoError(t, err)
+		for name, data := range files {
+			require.NoError(t, inst.Add(name, []byte(data)))
+		}
+		indexData, err := index.encode()
+		require.NoError(t, err)
+		require.NoError(t, inst.Add(IndexName(sep), indexData))
+		_, err = inst.Finish()
+		require.NoError(t, err)
+	}
+
+	blocks := "target: Stage\n  ----- a -----\n  when program starts:\n    stop()\n"
+	fetch(Index{"a": {Name: "robot"}}, map[string]string{"robot.blocks.txt": blocks})
+	fetch(Index{"a": {Name: "sub/robot"}}, map[string]string{"sub/robot.blocks.txt": blocks + "    go()\n"})
+
+	log := gitLog(t, repo, "programs")
+	require.Len(t, log, 3)
+	assert.Equal(t, "Rename mindstorms programs\n\nrobot.blocks.txt -> sub/robot.blocks.txt\n", log[1].Message)
+
+	// The rename commit only moves the file, so git sees it as a rename
+	// no matter how much the program changed.
+	before, err := log[2].Tree()
+	require.NoError(t, err)
+	after, err := log[1].Tree()
+	require.NoError(t, err)
+	changes, err := object.DiffTreeWithOptions(context.Background(), before, after, object.DefaultDiffTreeOptions)
+	require.NoError(t, err)
+	var renamed []string
+	for _, c := range changes {
+		if c.From.Name != c.To.Name {
+			renamed = append(renamed, c.From.Name+" -> "+c.To.Name)
+		}
+	}
+	assert.Equal(t, []string{"robot.blocks.txt -> sub/robot.blocks.txt"}, renamed)
+
+	// The next commit changes the file where it is now.
+	latest, err := log[0].Tree()
+	require.NoError(t, err)
+	f, err := latest.File("sub/robot.blocks.txt")
+	require.NoError(t, err)
+	data, err := f.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, blocks+"    go()\n", data)
+	_, err = latest.File("robot.blocks.txt")
+	assert.Error(t, err)
+}
@@ -32,7 +32,13 @@ func (tt *TreeBuilder) Finish() (plumbing.Hash, error) {
 	return createTree(tt.repo, tt.blobs)
 }
 
+// createBlob stores data as a blob, unless the repository already has it.
 func createBlob(g *git.Repository, data []byte) (plumbing.Hash, error) {
+	oid := plumbing.ComputeHash(plumbing.BlobObject, data)
+	if g.Storer.HasEncodedObject(oid) == nil {
+		return oid, nil
+	}
+
 	obj := g.Storer.NewEncodedObject()
 	obj.SetType(plumbing.BlobObject)
 
@@ -0,0 +1,45 @@
+package push
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirSource pushes the .py files in a directory.
+type DirSource string
+
+func (s DirSource) PathSeparator() string {
+	return string(filepath.Separator)
+}
+
+func (s DirSource) Programs() ([]Program, error) {
+	var programs []Program
+	err := filepath.WalkDir(string(s), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != string(s) && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || filepath.Ext(path) != ".py" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(string(s), path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		programs = append(programs, Program{Name: rel, Data: data})
+		return nil
+	})
+	return programs, err
+}
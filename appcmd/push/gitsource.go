@@ -0,0 +1,55 @@
+package push
+
+import (
+	"path"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/spraints/mind-meld/appcmd/fetch"
+)
+
+// GitSource pushes the .py files in a commit in the current git repository.
+type GitSource struct {
+	// Ref is anything that resolves to a commit, like a branch name.
+	Ref string
+}
+
+func (s GitSource) PathSeparator() string {
+	return fetch.GitPathSeparator
+}
+
+func (s GitSource) Programs() ([]Program, error) {
+	repo, err := git.PlainOpen(".")
+	if err != nil {
+		return nil, err
+	}
+
+	commitID, err := repo.ResolveRevision(plumbing.Revision(s.Ref))
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.CommitObject(*commitID)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var programs []Program
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if path.Ext(f.Name) != ".py" {
+			return nil
+		}
+		data, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		programs = append(programs, Program{Name: f.Name, Data: []byte(data)})
+		return nil
+	})
+	return programs, err
+}
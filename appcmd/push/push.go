@@ -0,0 +1,171 @@
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spraints/mind-meld/appcmd"
+	"github.com/spraints/mind-meld/appcmd/fetch"
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// Source is somewhere that python programs are pushed from.
+type Source interface {
+	Programs() ([]Program, error)
+	PathSeparator() string
+}
+
+// Program is a python program from a Source.
+type Program struct {
+	// Name is the path of the .py file, relative to the root of the Source.
+	// It's the same name that fetch stores the program as.
+	Name string
+	Data []byte
+}
+
+// Run writes each python program from src into the matching program file in
+// app's project dir. Programs that don't match an existing file are added as
+// new programs. Every program is checked before any file is written, so a
+// program that can't be pushed doesn't leave the app half-updated.
+func Run(app appcmd.App, src Source) (string, error) {
+	programs, err := src.Programs()
+	if err != nil {
+		return "", err
+	}
+
+	dir, projects, err := fetch.ListProjects(app, src.PathSeparator())
+	if err != nil {
+		return "", err
+	}
+
+	existing := map[string]fetch.Project{}
+	for _, p := range projects {
+		existing[fetch.PyName(p)] = p
+	}
+
+	now := time.Now()
+	var writes []write
+	var updated, created, unchanged int
+	for _, prog := range programs {
+		if p, ok := existing[prog.Name]; ok {
+			w, err := update(p.Path, prog, now)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", prog.Name, err)
+			}
+			if w == nil {
+				unchanged++
+				continue
+			}
+			writes = append(writes, write{p.Path, w})
+			updated++
+			continue
+		}
+
+		path := newProjectPath(dir, prog.Name, src.PathSeparator(), app.ProjectExts()[0])
+		writes = append(writes, write{path, create(path, prog, now)})
+		created++
+	}
+
+	for _, w := range writes {
+		if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+			return "", err
+		}
+		if err := writeFile(w.path, w.w); err != nil {
+			return "", fmt.Errorf("%s: %w", w.path, err)
+		}
+	}
+
+	return fmt.Sprintf("%s: updated %d, created %d, unchanged %d", dir, updated, created, unchanged), nil
+}
+
+// write is a program file that Run will write.
+type write struct {
+	path string
+	w    *lmsp.Writer
+}
+
+// update returns a Writer that replaces the python program in the file at
+// path, or nil if the program didn't change.
+func update(path string, prog Program, now time.Time) (*lmsp.Writer, error) {
+	// Read the whole file now, because it isn't written until every
+	// program has been checked.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := lmsp.Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	man, err := l.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	if man.Type != "python" {
+		return nil, fmt.Errorf("%s is a %s program, not python", path, man.Type)
+	}
+
+	old, err := l.Python()
+	if err != nil {
+		return nil, err
+	}
+	if old == string(prog.Data) {
+		return nil, nil
+	}
+
+	man.LastSaved = now.UTC().Truncate(time.Millisecond)
+
+	w := lmsp.NewWriter(l)
+	w.SetManifest(man)
+	w.SetPython(string(prog.Data))
+	return w, nil
+}
+
+// create returns a Writer for a new python program at path.
+func create(path string, prog Program, now time.Time) *lmsp.Writer {
+	name := filepath.Base(path)
+	name = name[:len(name)-len(filepath.Ext(name))]
+
+	man := lmsp.NewPythonManifest(name, now)
+	man.AppType = lmsp.FormatForExt(filepath.Ext(path)).AppType()
+
+	w := lmsp.NewWriter(nil)
+	w.SetManifest(man)
+	w.SetPython(string(prog.Data))
+	return w
+}
+
+// writeFile writes to a temp file and then renames it, so that the app never
+// sees a partially written program.
+func writeFile(path string, w *lmsp.Writer) error {
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".mind-meld-push-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func newProjectPath(dir, name, sep, ext string) string {
+	name = strings.TrimSuffix(name, ".py")
+	return filepath.Join(dir, filepath.Join(strings.Split(name, sep)...)+ext)
+}
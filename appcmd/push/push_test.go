@@ -0,0 +1,116 @@
+package push
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+type testApp string
+
+func (testApp) FullName() string        { return "test app" }
+func (a testApp) ProjectDirs() []string { return []string{string(a)} }
+func (testApp) ProjectExts() []string   { return []string{".llsp"} }
+
+func TestPush(t *testing.T) {
+	projectDir := t.TempDir()
+	srcDir := t.TempDir()
+
+	hello, err := ioutil.ReadFile("../../lmsp/testdata/hello.llsp")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(projectDir, "hello.llsp"), hello, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(projectDir, "same.llsp"), hello, 0o644))
+
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "hello.py"), []byte("print('changed')\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "same.py"), []byte("from spike import PrimeHub\n\nhub = PrimeHub()\nhub.light_matrix.write('Hi')\n"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "new.py"), []byte("print('new')\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "notes.txt"), []byte("not a program"), 0o644))
+
+	msg, err := Run(testApp(projectDir), DirSource(srcDir))
+	require.NoError(t, err)
+	assert.Equal(t, projectDir+": updated 1, created 1, unchanged 1", msg)
+
+	man, program := readPython(t, filepath.Join(projectDir, "hello.llsp"))
+	assert.Equal(t, "print('changed')\n", program)
+	assert.Equal(t, "pyXk2h0Lq9Tz", man.ID)
+	assert.Equal(t, "Hello python", man.Name)
+
+	same, err := ioutil.ReadFile(filepath.Join(projectDir, "same.llsp"))
+	require.NoError(t, err)
+	assert.Equal(t, hello, same)
+
+	man, program = readPython(t, filepath.Join(projectDir, "sub", "new.llsp"))
+	assert.Equal(t, "print('new')\n", program)
+	assert.Equal(t, "python", man.Type)
+	assert.Equal(t, "new", man.Name)
+	assert.Len(t, man.ID, 12)
+	assert.Equal(t, man.Created, man.LastSaved)
+}
+
+func TestPushBlocksProgram(t *testing.T) {
+	projectDir := t.TempDir()
+	srcDir := t.TempDir()
+
+	blocks, err := ioutil.ReadFile("../../lmsp/testdata/Gyro drive.lmsp")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(projectDir, "Gyro drive.llsp"), blocks, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "Gyro drive.py"), []byte("print('hi')\n"), 0o644))
+
+	// Programs that sort before the blocks program aren't pushed either.
+	hello, err := ioutil.ReadFile("../../lmsp/testdata/hello.llsp")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(projectDir, "A hello.llsp"), hello, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "A hello.py"), []byte("print('changed')\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "A new.py"), []byte("print('new')\n"), 0o644))
+
+	_, err = Run(testApp(projectDir), DirSource(srcDir))
+	assert.Error(t, err)
+
+	same, err := ioutil.ReadFile(filepath.Join(projectDir, "A hello.llsp"))
+	require.NoError(t, err)
+	assert.Equal(t, hello, same)
+	assert.NoFileExists(t, filepath.Join(projectDir, "A new.llsp"))
+}
+
+// TestPushSharedDir makes sure that programs from another app that uses the
+// same dir, like SPIKE 3, aren't matched.
+func TestPushSharedDir(t *testing.T) {
+	projectDir := t.TempDir()
+	srcDir := t.TempDir()
+
+	other, err := ioutil.ReadFile("../../lmsp/testdata/hello.llsp3")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(projectDir, "hello.llsp3"), other, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "hello.py"), []byte("print('hi')\n"), 0o644))
+
+	msg, err := Run(testApp(projectDir), DirSource(srcDir))
+	require.NoError(t, err)
+	assert.Equal(t, projectDir+": updated 0, created 1, unchanged 0", msg)
+
+	unchanged, err := ioutil.ReadFile(filepath.Join(projectDir, "hello.llsp3"))
+	require.NoError(t, err)
+	assert.Equal(t, other, unchanged)
+	_, program := readPython(t, filepath.Join(projectDir, "hello.llsp"))
+	assert.Equal(t, "print('hi')\n", program)
+}
+
+func readPython(t *testing.T, path string) (lmsp.Manifest, string) {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	l, err := lmsp.ReadFile(f)
+	require.NoError(t, err)
+	man, err := l.Manifest()
+	require.NoError(t, err)
+	program, err := l.Python()
+	require.NoError(t, err)
+	return man, program
+}
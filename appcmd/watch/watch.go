@@ -12,7 +12,7 @@ import (
 	"github.com/spraints/mind-meld/recnotify"
 )
 
-func Run(ctx context.Context, a appcmd.App, t fetch.Target) error {
+func Run(ctx context.Context, a appcmd.App, t fetch.Target, opts fetch.Options) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
@@ -53,7 +53,7 @@ func Run(ctx context.Context, a appcmd.App, t fetch.Target) error {
 		case <-trigger.C:
 			trigger.Ack()
 			fmt.Printf("fetching new programs...\n")
-			if msg, err := fetch.Run(a, t); err != nil {
+			if msg, err := fetch.Run(a, t, opts); err != nil {
 				return err
 			} else {
 				fmt.Printf("%s.\n", msg)
@@ -1,9 +1,6 @@
 package mindstormsapp
 
-import (
-	"os"
-	"path/filepath"
-)
+import "github.com/spraints/mind-meld/appcmd"
 
 type App struct {
 }
@@ -17,9 +14,10 @@ func (*App) FullName() string {
 }
 
 func (*App) ProjectDirs() []string {
-	home := os.Getenv("HOME")
-	return []string{
-		filepath.Join(home, "Library/Containers/com.lego.retail.mindstorms.robotinventor/Data/Documents/LEGO MINDSTORMS"),
-		filepath.Join(home, "Documents/LEGO MINDSTORMS"),
-	}
+	return appcmd.DefaultDirs("com.lego.retail.mindstorms.robotinventor", "LEGO MINDSTORMS")
+}
+
+// ProjectExts has both extensions that MINDSTORMS programs are saved with.
+func (*App) ProjectExts() []string {
+	return []string{".lms", ".lmsp"}
 }
@@ -1,9 +1,6 @@
 package spike
 
-import (
-	"os"
-	"path/filepath"
-)
+import "github.com/spraints/mind-meld/appcmd"
 
 type App struct {
 }
@@ -17,8 +14,9 @@ func (*App) FullName() string {
 }
 
 func (*App) ProjectDirs() []string {
-	home := os.Getenv("HOME")
-	return []string{
-		filepath.Join(home, "Library/Containers/com.lego.education.spikenext/Data/Documents/LEGO Education SPIKE"),
-	}
+	return appcmd.DefaultDirs("com.lego.education.spikenext", "LEGO Education SPIKE")
+}
+
+func (*App) ProjectExts() []string {
+	return []string{".llsp"}
 }
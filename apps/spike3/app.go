@@ -0,0 +1,23 @@
+package spike3
+
+import "github.com/spraints/mind-meld/appcmd"
+
+// App is SPIKE App 3, which saves programs as .llsp3 files.
+type App struct {
+}
+
+func New() *App {
+	return &App{}
+}
+
+func (*App) FullName() string {
+	return "SPIKE 3"
+}
+
+func (*App) ProjectDirs() []string {
+	return appcmd.DefaultDirs("com.lego.education.spike", "LEGO Education SPIKE")
+}
+
+func (*App) ProjectExts() []string {
+	return []string{".llsp3"}
+}
@@ -0,0 +1,454 @@
+// Package blockdiff compares two versions of a block program by what the
+// blocks do, instead of by the text that lmsdump prints for them.
+package blockdiff
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+type Kind int
+
+const (
+	Added Kind = iota
+	Removed
+	Moved
+	Changed
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Moved:
+		return "moved"
+	case Changed:
+		return "changed"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// Change is one difference between two versions of a project.
+type Change struct {
+	Kind Kind
+
+	// Target is the name of the sprite or stage that the change is in.
+	Target string
+
+	// Script describes the script that the change is in, e.g. "when
+	// program starts". For a block that moved between scripts, this is
+	// the script it moved to.
+	Script string
+
+	// FromScript is the script that a block moved out of. It's only set
+	// when a block moved from one script to another.
+	FromScript string
+
+	// Block describes the block that changed. It is empty when a whole
+	// script was added or removed.
+	Block string
+
+	// Param is the name of the input or field that changed.
+	Param string
+
+	// Old and New are the values of Param before and after the change.
+	Old, New string
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Block == "":
+		return fmt.Sprintf("%s script %q", c.Kind, c.Script)
+	case c.Kind == Changed:
+		return fmt.Sprintf("changed %s %s %s → %s in %q", c.Block, c.Param, c.Old, c.New, c.Script)
+	case c.Kind == Moved && c.FromScript != "" && c.FromScript != c.Script:
+		return fmt.Sprintf("moved %s from %q to %q", c.Block, c.FromScript, c.Script)
+	default:
+		return fmt.Sprintf("%s %s in %q", c.Kind, c.Block, c.Script)
+	}
+}
+
+// Compare finds the differences between two versions of a project.
+func Compare(a, b lmsp.Project) []Change {
+	var changes []Change
+	for _, pair := range matchTargets(a.Targets, b.Targets) {
+		changes = append(changes, compareTargets(pair[0], pair[1])...)
+	}
+	return changes
+}
+
+// matchTargets pairs up the targets of two projects. Targets are matched by
+// name. LEGO's apps name sprites with random IDs, so any sprites that are left
+// over are matched in order.
+func matchTargets(a, b []lmsp.ProjectTarget) [][2]*lmsp.ProjectTarget {
+	var pairs [][2]*lmsp.ProjectTarget
+	usedB := make([]bool, len(b))
+	var leftA []*lmsp.ProjectTarget
+	for i := range a {
+		found := false
+		for j := range b {
+			if !usedB[j] && a[i].Name == b[j].Name {
+				pairs = append(pairs, [2]*lmsp.ProjectTarget{&a[i], &b[j]})
+				usedB[j] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			leftA = append(leftA, &a[i])
+		}
+	}
+	for _, ta := range leftA {
+		var tb *lmsp.ProjectTarget
+		for j := range b {
+			if !usedB[j] && b[j].IsStage == ta.IsStage {
+				tb = &b[j]
+				usedB[j] = true
+				break
+			}
+		}
+		pairs = append(pairs, [2]*lmsp.ProjectTarget{ta, tb})
+	}
+	for j := range b {
+		if !usedB[j] {
+			pairs = append(pairs, [2]*lmsp.ProjectTarget{nil, &b[j]})
+		}
+	}
+	return pairs
+}
+
+func compareTargets(ta, tb *lmsp.ProjectTarget) []Change {
+	var name string
+	var scriptsA, scriptsB []*script
+	if ta != nil {
+		name = ta.Name
+		scriptsA = readScripts(*ta)
+	}
+	if tb != nil {
+		name = tb.Name
+		scriptsB = readScripts(*tb)
+	}
+
+	c := &comparison{target: name}
+
+	// Remember where each block was, so that blocks that move between
+	// scripts can be reported as moves.
+	c.scriptOfA = map[lmsp.ProjectBlockID]*script{}
+	for _, s := range scriptsA {
+		for _, st := range s.stmts {
+			c.scriptOfA[st.id] = s
+		}
+	}
+	c.scriptOfB = map[lmsp.ProjectBlockID]*script{}
+	for _, s := range scriptsB {
+		for _, st := range s.stmts {
+			c.scriptOfB[st.id] = s
+		}
+	}
+
+	pairs, onlyA, onlyB := matchScripts(scriptsA, scriptsB)
+	for _, s := range onlyA {
+		c.add(Change{Kind: Removed, Script: s.label})
+	}
+	for _, s := range onlyB {
+		c.add(Change{Kind: Added, Script: s.label})
+		for _, st := range s.stmts {
+			if from, ok := c.scriptOfA[st.id]; ok {
+				c.add(Change{Kind: Moved, Script: s.label, FromScript: from.label, Block: st.label})
+			}
+		}
+	}
+	for _, pair := range pairs {
+		c.compareScripts(pair[0], pair[1])
+	}
+	return c.changes
+}
+
+type comparison struct {
+	target    string
+	scriptOfA map[lmsp.ProjectBlockID]*script
+	scriptOfB map[lmsp.ProjectBlockID]*script
+	changes   []Change
+}
+
+func (c *comparison) add(change Change) {
+	change.Target = c.target
+	c.changes = append(c.changes, change)
+}
+
+func (c *comparison) compareScripts(sa, sb *script) {
+	matchA, matchB := matchStmts(sa.stmts, sb.stmts)
+
+	// Blocks that are in both versions of the script but in a different
+	// order than their neighbors have moved.
+	var order []int
+	for _, j := range matchA {
+		if j >= 0 {
+			order = append(order, j)
+		}
+	}
+	inOrder := longestIncreasing(order)
+
+	for i, st := range sa.stmts {
+		j := matchA[i]
+		if j < 0 {
+			if _, ok := c.scriptOfB[st.id]; ok {
+				// This block moved to another script, it is
+				// reported from that side.
+				continue
+			}
+			c.add(Change{Kind: Removed, Script: sa.label, Block: st.label})
+			continue
+		}
+		other := sb.stmts[j]
+		if st.container != other.container || !inOrder[j] {
+			c.add(Change{Kind: Moved, Script: sb.label, Block: other.label})
+		}
+		for _, name := range paramNames(st.params, other.params) {
+			oldVal, newVal := st.params[name], other.params[name]
+			if oldVal != newVal {
+				c.add(Change{
+					Kind:   Changed,
+					Script: sb.label,
+					Block:  st.name,
+					Param:  name,
+					Old:    describeValue(oldVal),
+					New:    describeValue(newVal),
+				})
+			}
+		}
+	}
+
+	for j, st := range sb.stmts {
+		if matchB[j] >= 0 {
+			continue
+		}
+		if from, ok := c.scriptOfA[st.id]; ok && from != sa {
+			c.add(Change{Kind: Moved, Script: sb.label, FromScript: from.label, Block: st.label})
+			continue
+		}
+		c.add(Change{Kind: Added, Script: sb.label, Block: st.label})
+	}
+}
+
+func paramNames(a, b map[string]string) []string {
+	var names []string
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func describeValue(v string) string {
+	if v == "" {
+		return "(empty)"
+	}
+	return v
+}
+
+// matchScripts pairs up scripts from two versions of a target. Scripts are
+// matched by the ID of their first block, then by an identical hat block, then
+// by how many of their blocks they have in common.
+func matchScripts(a, b []*script) (pairs [][2]*script, onlyA, onlyB []*script) {
+	usedA := make([]bool, len(a))
+	usedB := make([]bool, len(b))
+	pair := func(i, j int) {
+		pairs = append(pairs, [2]*script{a[i], b[j]})
+		usedA[i] = true
+		usedB[j] = true
+	}
+
+	for i := range a {
+		for j := range b {
+			if !usedB[j] && a[i].id == b[j].id {
+				pair(i, j)
+				break
+			}
+		}
+	}
+
+	for i := range a {
+		if usedA[i] {
+			continue
+		}
+		for j := range b {
+			if !usedB[j] && a[i].key == b[j].key {
+				pair(i, j)
+				break
+			}
+		}
+	}
+
+	for i := range a {
+		if usedA[i] {
+			continue
+		}
+		best, bestScore := -1, 0.5
+		for j := range b {
+			if usedB[j] || a[i].hat != b[j].hat {
+				continue
+			}
+			if score := similarity(a[i], b[j]); score >= bestScore {
+				best, bestScore = j, score
+			}
+		}
+		if best >= 0 {
+			pair(i, best)
+		}
+	}
+
+	for i, s := range a {
+		if !usedA[i] {
+			onlyA = append(onlyA, s)
+		}
+	}
+	for j, s := range b {
+		if !usedB[j] {
+			onlyB = append(onlyB, s)
+		}
+	}
+	return pairs, onlyA, onlyB
+}
+
+func similarity(a, b *script) float64 {
+	seen := map[string]int{}
+	for _, st := range a.stmts {
+		seen[st.sig]++
+	}
+	common := 0
+	for _, st := range b.stmts {
+		if seen[st.sig] > 0 {
+			seen[st.sig]--
+			common++
+		}
+	}
+	total := len(a.stmts)
+	if len(b.stmts) > total {
+		total = len(b.stmts)
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(common) / float64(total)
+}
+
+// matchStmts matches the blocks in two versions of a script. Blocks keep their
+// IDs when they're edited in the app, so blocks are first matched by ID. The
+// rest are matched by opcode and parameters, in order.
+//
+// The results map indexes in one list to indexes in the other, or -1 for
+// blocks with no match.
+func matchStmts(a, b []*stmt) (matchA, matchB []int) {
+	matchA = make([]int, len(a))
+	matchB = make([]int, len(b))
+	for i := range matchA {
+		matchA[i] = -1
+	}
+	for j := range matchB {
+		matchB[j] = -1
+	}
+
+	indexB := map[lmsp.ProjectBlockID]int{}
+	for j, st := range b {
+		indexB[st.id] = j
+	}
+	for i, st := range a {
+		if j, ok := indexB[st.id]; ok {
+			matchA[i] = j
+			matchB[j] = i
+		}
+	}
+
+	var restA, restB []int
+	for i := range a {
+		if matchA[i] < 0 {
+			restA = append(restA, i)
+		}
+	}
+	for j := range b {
+		if matchB[j] < 0 {
+			restB = append(restB, j)
+		}
+	}
+	for _, m := range lcs(len(restA), len(restB), func(x, y int) bool {
+		return a[restA[x]].sig == b[restB[y]].sig
+	}) {
+		i, j := restA[m[0]], restB[m[1]]
+		matchA[i] = j
+		matchB[j] = i
+	}
+
+	return matchA, matchB
+}
+
+// lcs returns the index pairs of a longest common subsequence of two lists.
+func lcs(n, m int, eq func(x, y int) bool) [][2]int {
+	lengths := make([][]int, n+1)
+	for x := range lengths {
+		lengths[x] = make([]int, m+1)
+	}
+	for x := n - 1; x >= 0; x-- {
+		for y := m - 1; y >= 0; y-- {
+			switch {
+			case eq(x, y):
+				lengths[x][y] = lengths[x+1][y+1] + 1
+			case lengths[x+1][y] >= lengths[x][y+1]:
+				lengths[x][y] = lengths[x+1][y]
+			default:
+				lengths[x][y] = lengths[x][y+1]
+			}
+		}
+	}
+	var res [][2]int
+	for x, y := 0, 0; x < n && y < m; {
+		switch {
+		case eq(x, y):
+			res = append(res, [2]int{x, y})
+			x++
+			y++
+		case lengths[x+1][y] >= lengths[x][y+1]:
+			x++
+		default:
+			y++
+		}
+	}
+	return res
+}
+
+// longestIncreasing returns the set of values that are in a longest
+// increasing subsequence of seq.
+func longestIncreasing(seq []int) map[int]bool {
+	if len(seq) == 0 {
+		return map[int]bool{}
+	}
+	lengths := make([]int, len(seq))
+	prev := make([]int, len(seq))
+	best := 0
+	for i := range seq {
+		lengths[i], prev[i] = 1, -1
+		for k := 0; k < i; k++ {
+			if seq[k] < seq[i] && lengths[k]+1 > lengths[i] {
+				lengths[i], prev[i] = lengths[k]+1, k
+			}
+		}
+		if lengths[i] > lengths[best] {
+			best = i
+		}
+	}
+	res := map[int]bool{}
+	for i := best; i >= 0; i = prev[i] {
+		res[seq[i]] = true
+	}
+	return res
+}
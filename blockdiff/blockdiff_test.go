@@ -0,0 +1,60 @@
+package blockdiff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+const before = `{"targets": [
+  {"isStage": true, "name": "Stage", "blocks": {}},
+  {"isStage": false, "name": "sprite-before", "blocks": {
+    "hat": {"opcode": "flipperevents_whenProgramStarts", "next": "speed", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+    "speed": {"opcode": "flippermotor_motorSetSpeed", "next": "wait", "parent": "hat", "inputs": {"PORT": [1, "port"], "SPEED": [1, [4, "50"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "port": {"opcode": "flippermotor_single-motor-selector", "next": null, "parent": "speed", "inputs": {}, "fields": {"field_flippermotor_single-motor-selector": ["A", null]}, "shadow": true, "topLevel": false},
+    "wait": {"opcode": "control_wait", "next": "stop", "parent": "speed", "inputs": {"DURATION": [1, [5, "1"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "stop": {"opcode": "flippermove_stopMove", "next": null, "parent": "wait", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false},
+    "gone": {"opcode": "flipperevents_whenTimer", "next": null, "parent": null, "inputs": {"VALUE": [1, [4, "10"]]}, "fields": {}, "shadow": false, "topLevel": true, "x": 300, "y": 0}
+  }}
+]}`
+
+const after = `{"targets": [
+  {"isStage": true, "name": "Stage", "blocks": {}},
+  {"isStage": false, "name": "sprite-after", "blocks": {
+    "hat": {"opcode": "flipperevents_whenProgramStarts", "next": "stop", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 50, "y": 50},
+    "stop": {"opcode": "flippermove_stopMove", "next": "speed", "parent": "hat", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false},
+    "speed": {"opcode": "flippermotor_motorSetSpeed", "next": "wait", "parent": "stop", "inputs": {"PORT": [1, "port"], "SPEED": [1, [4, "75"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "port": {"opcode": "flippermotor_single-motor-selector", "next": null, "parent": "speed", "inputs": {}, "fields": {"field_flippermotor_single-motor-selector": ["A", null]}, "shadow": true, "topLevel": false},
+    "wait": {"opcode": "control_wait", "next": "beep", "parent": "speed", "inputs": {"DURATION": [1, [5, "1"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "beep": {"opcode": "flippersound_beep", "next": null, "parent": "wait", "inputs": {"NOTE": [1, [4, "60"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "new": {"opcode": "flipperevents_whenGesture", "next": null, "parent": null, "inputs": {}, "fields": {"EVENT": ["shake", null]}, "shadow": false, "topLevel": true, "x": 300, "y": 0}
+  }}
+]}`
+
+func TestCompare(t *testing.T) {
+	var a, b lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(before), &a))
+	require.NoError(t, json.Unmarshal([]byte(after), &b))
+
+	var actual []string
+	for _, c := range Compare(a, b) {
+		actual = append(actual, c.String())
+	}
+	assert.Equal(t, []string{
+		`removed script "when timer(value: 10)"`,
+		`added script "when gesture(event: shake)"`,
+		`changed motorSetSpeed speed 50 → 75 in "when program starts"`,
+		`moved stopMove in "when program starts"`,
+		`added beep(note: 60) in "when program starts"`,
+	}, actual)
+}
+
+func TestCompareSame(t *testing.T) {
+	var a lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(before), &a))
+	assert.Empty(t, Compare(a, a))
+}
@@ -0,0 +1,238 @@
+package blockdiff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// script is a stack of blocks, flattened so that it can be compared with
+// another version of itself.
+type script struct {
+	id lmsp.ProjectBlockID
+
+	// hat is the opcode of the first block.
+	hat lmsp.ProjectOpcode
+
+	// label describes the script for people, e.g. "when program starts".
+	label string
+
+	// key identifies the script by its first block's opcode and
+	// parameters.
+	key string
+
+	// stmts has every block in the script, in the order they appear.
+	stmts []*stmt
+}
+
+// stmt is a block in a script, along with the values of its parameters.
+type stmt struct {
+	id     lmsp.ProjectBlockID
+	opcode lmsp.ProjectOpcode
+
+	// name is the name of the block, without its parameters.
+	name string
+
+	// label describes the block and its parameters for people.
+	label string
+
+	// params has the rendered value of each input and field that isn't a
+	// C mouth.
+	params map[string]string
+
+	// container identifies the C mouth that this block is in, or is empty
+	// if the block isn't in one.
+	container string
+
+	// sig identifies the block by its opcode and parameters.
+	sig string
+}
+
+func readScripts(target lmsp.ProjectTarget) []*script {
+	var scripts []*script
+	for it := target.Scripts(); it.Next(); {
+		top := it.Script()
+		s := &script{id: top.ID, hat: top.Top.Opcode}
+		lmsp.Walk(&scriptReader{s: s}, target, top.ID)
+		if len(s.stmts) > 0 {
+			s.label = s.stmts[0].label
+			s.key = s.stmts[0].sig
+		}
+		scripts = append(scripts, s)
+	}
+	return scripts
+}
+
+// scriptReader adds each statement in a script to s.
+type scriptReader struct {
+	lmsp.BaseVisitor
+	s *script
+
+	// mouths are the C mouths that the current block is in.
+	mouths []string
+}
+
+func (r *scriptReader) EnterStatement(target lmsp.ProjectTarget, id lmsp.ProjectBlockID, block *lmsp.ProjectBlockObject) bool {
+	st := &stmt{
+		id:     id,
+		opcode: block.Opcode,
+		params: params(target, block),
+	}
+	if len(r.mouths) > 0 {
+		st.container = r.mouths[len(r.mouths)-1]
+	}
+	st.name = blockName(target, block)
+	st.label = describeBlock(target, block, st.params)
+	st.sig = string(block.Opcode) + " " + formatParams(st.params)
+	r.s.stmts = append(r.s.stmts, st)
+	return true
+}
+
+// EnterReporter skips reporters, because they're part of their statement's
+// params.
+func (r *scriptReader) EnterReporter(lmsp.ProjectTarget, lmsp.ProjectBlockID, lmsp.ProjectInputID, lmsp.ProjectBlockID, *lmsp.ProjectBlockObject) bool {
+	return false
+}
+
+func (r *scriptReader) EnterMouth(_ lmsp.ProjectTarget, id lmsp.ProjectBlockID, _ *lmsp.ProjectBlockObject, input lmsp.ProjectInputID) bool {
+	r.mouths = append(r.mouths, string(id)+"/"+string(input))
+	return true
+}
+
+func (r *scriptReader) LeaveMouth(lmsp.ProjectTarget, lmsp.ProjectBlockID, *lmsp.ProjectBlockObject, lmsp.ProjectInputID) {
+	r.mouths = r.mouths[:len(r.mouths)-1]
+}
+
+// params renders the inputs and fields of a block.
+func params(target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) map[string]string {
+	res := map[string]string{}
+	for name, field := range block.Fields {
+		res[paramName(string(name))] = field.Value
+	}
+	for _, name := range block.InputNames() {
+		if lmsp.IsSubstack(name) || (block.Opcode == "procedures_definition" && name == "custom_block") {
+			continue
+		}
+		res[paramName(string(name))] = inputValue(target, block, name)
+	}
+	return res
+}
+
+func paramName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "field_"))
+}
+
+func formatParams(params map[string]string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+": "+params[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+func inputBlockID(block *lmsp.ProjectBlockObject, name lmsp.ProjectInputID) lmsp.ProjectBlockID {
+	id, _ := block.Inputs[name].BlockID()
+	return id
+}
+
+// inputValue renders the value of a block's input. Literal values and menus
+// are rendered as their values, and reporter blocks are rendered like
+// function calls.
+func inputValue(target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, name lmsp.ProjectInputID) string {
+	input := block.Inputs[name]
+	switch {
+	case input == nil:
+		return ""
+	case input.Value.Block != nil:
+		return blockValue(target, *input.Value.Block)
+	case input.Value.Primitive != nil:
+		return primitiveValue(input.Value.Primitive)
+	default:
+		return ""
+	}
+}
+
+func blockValue(target lmsp.ProjectTarget, id lmsp.ProjectBlockID) string {
+	switch block := target.Blocks[id].(type) {
+	case *lmsp.ProjectBlockObject:
+		p := params(target, block)
+		if block.Shadow && len(p) == 1 {
+			for _, v := range p {
+				return v
+			}
+		}
+		return describeBlock(target, block, p)
+	case nil:
+		return ""
+	default:
+		return block.Description()
+	}
+}
+
+func primitiveValue(val *lmsp.ProjectPrimitive) string {
+	if val.Kind == lmsp.PrimitiveString {
+		return fmt.Sprintf("%q", val.Value)
+	}
+	return val.Value
+}
+
+// describeBlock describes a block like a function call, for example
+// "motorSetSpeed(port: A, speed: 75)".
+func describeBlock(target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, params map[string]string) string {
+	name := blockName(target, block)
+	if len(params) == 0 {
+		return name
+	}
+	return name + "(" + formatParams(params) + ")"
+}
+
+func blockName(target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) string {
+	switch {
+	case block.Opcode == "procedures_call" && block.Mutation != nil:
+		return block.Mutation.ProcCode
+	case block.Opcode == "procedures_definition":
+		if proto, ok := target.Blocks[inputBlockID(block, "custom_block")].(*lmsp.ProjectBlockObject); ok && proto.Mutation != nil {
+			return "define " + proto.Mutation.ProcCode
+		}
+		return "define"
+	default:
+		return opcodeName(block.Opcode)
+	}
+}
+
+// opcodeName turns an opcode into something readable. Hat blocks are spelled
+// out, e.g. "flipperevents_whenProgramStarts" becomes "when program starts".
+// Other blocks drop the extension prefix, e.g. "flippermotor_motorSetSpeed"
+// becomes "motorSetSpeed".
+func opcodeName(opcode lmsp.ProjectOpcode) string {
+	name := string(opcode)
+	if i := strings.Index(name, "_"); i >= 0 {
+		name = name[i+1:]
+	}
+	if !strings.HasPrefix(name, "when") {
+		return name
+	}
+	var words strings.Builder
+	prev := 'x'
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			if !unicode.IsUpper(prev) {
+				words.WriteRune(' ')
+			}
+			prev = r
+			r = unicode.ToLower(r)
+		} else {
+			prev = r
+		}
+		words.WriteRune(r)
+	}
+	return words.String()
+}
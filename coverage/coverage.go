@@ -0,0 +1,201 @@
+// Package coverage counts the opcodes that are used in a set of block
+// programs, and finds the ones that lmsdump doesn't know how to draw. Real
+// programs use blocks that the opcode catalog is missing, and this is how to
+// find them.
+package coverage
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spraints/mind-meld/lmsdump"
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// Usage is how much one opcode is used.
+type Usage struct {
+	Opcode lmsp.ProjectOpcode `json:"opcode"`
+
+	// Count is the number of blocks with the opcode.
+	Count int `json:"count"`
+	// Programs is the number of programs that have the opcode.
+	Programs int `json:"programs"`
+
+	// Handled is true if lmsdump knows how to draw the opcode. Blocks that
+	// aren't handled are drawn with their inputs and fields in alphabetical
+	// order.
+	Handled bool `json:"handled"`
+
+	// Example is set for opcodes that aren't handled. It's the JSON of one of
+	// the blocks and of the blocks in its inputs, like the "blocks" in a
+	// project.json.
+	Example json.RawMessage `json:"example,omitempty"`
+	// ExampleProgram is the name of the program that Example is from.
+	ExampleProgram string `json:"example_program,omitempty"`
+}
+
+// Skipped is a file that couldn't be read.
+type Skipped struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// Report is what a Scanner found.
+type Report struct {
+	// Programs is the number of block programs that were scanned. Copies
+	// of a program with the same content are only counted once.
+	Programs int `json:"programs"`
+
+	// Opcodes are ordered from most used to least used.
+	Opcodes []Usage `json:"opcodes"`
+
+	Skipped []Skipped `json:"skipped,omitempty"`
+}
+
+// Unhandled returns the opcodes that lmsdump doesn't know how to draw.
+func (r Report) Unhandled() []Usage {
+	var res []Usage
+	for _, u := range r.Opcodes {
+		if !u.Handled {
+			res = append(res, u)
+		}
+	}
+	return res
+}
+
+// Scanner collects opcodes from programs.
+type Scanner struct {
+	programs int
+	seen     map[[sha1.Size]byte]bool
+	usage    map[lmsp.ProjectOpcode]*Usage
+	skipped  []Skipped
+}
+
+func NewScanner() *Scanner {
+	return &Scanner{
+		seen:  map[[sha1.Size]byte]bool{},
+		usage: map[lmsp.ProjectOpcode]*Usage{},
+	}
+}
+
+// IsProgram returns true if name looks like a program file from one of the
+// apps.
+func IsProgram(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".lms", ".lmsp", ".llsp", ".llsp3":
+		return true
+	}
+	return false
+}
+
+// AddFile scans the program file named name, whose content is data. Python
+// programs are ignored, and files that can't be read are listed in the
+// report's Skipped.
+func (s *Scanner) AddFile(name string, data []byte) {
+	sum := sha1.Sum(data)
+	if s.seen[sum] {
+		return
+	}
+	s.seen[sum] = true
+
+	r, err := lmsp.Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		s.skip(name, err)
+		return
+	}
+	proj, _, err := r.DecodeProject(lmsp.DecodeOptions{Lenient: true})
+	if errors.Is(err, lmsp.ErrNoScratch) {
+		return
+	}
+	if err != nil {
+		s.skip(name, err)
+		return
+	}
+	s.AddProject(name, proj)
+}
+
+func (s *Scanner) skip(name string, err error) {
+	s.skipped = append(s.skipped, Skipped{Name: name, Error: err.Error()})
+}
+
+// AddProject scans a program's blocks.
+func (s *Scanner) AddProject(name string, proj lmsp.Project) {
+	s.programs++
+	inProgram := map[lmsp.ProjectOpcode]bool{}
+	for _, target := range proj.Targets {
+		for _, id := range blockIDs(target) {
+			block, ok := target.Block(id)
+			if !ok {
+				continue
+			}
+			u := s.usage[block.Opcode]
+			if u == nil {
+				u = &Usage{Opcode: block.Opcode, Handled: lmsdump.Handled(block.Opcode)}
+				s.usage[block.Opcode] = u
+			}
+			u.Count++
+			if !inProgram[block.Opcode] {
+				inProgram[block.Opcode] = true
+				u.Programs++
+			}
+			if !u.Handled && u.Example == nil {
+				u.Example = example(target, id)
+				u.ExampleProgram = name
+			}
+		}
+	}
+}
+
+// blockIDs returns the target's block IDs in order, so that the same example
+// is picked every time.
+func blockIDs(target lmsp.ProjectTarget) []lmsp.ProjectBlockID {
+	ids := make([]lmsp.ProjectBlockID, 0, len(target.Blocks))
+	for id := range target.Blocks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// example returns the JSON of a block and of the blocks in its inputs, which
+// are usually its menus.
+func example(target lmsp.ProjectTarget, id lmsp.ProjectBlockID) json.RawMessage {
+	block, _ := target.Block(id)
+	blocks := lmsp.ProjectBlocks{id: block}
+	for _, name := range block.InputNames() {
+		if lmsp.IsSubstack(name) {
+			continue
+		}
+		if child, ok := block.Inputs[name].BlockID(); ok {
+			if b, ok := target.Blocks[child]; ok {
+				blocks[child] = b
+			}
+		}
+	}
+	data, err := json.Marshal(blocks)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// Report returns what's been scanned so far.
+func (s *Scanner) Report() Report {
+	res := Report{Programs: s.programs, Opcodes: []Usage{}, Skipped: s.skipped}
+	for _, u := range s.usage {
+		res.Opcodes = append(res.Opcodes, *u)
+	}
+	sort.Slice(res.Opcodes, func(i, j int) bool {
+		a, b := res.Opcodes[i], res.Opcodes[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Opcode < b.Opcode
+	})
+	return res
+}
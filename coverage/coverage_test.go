@@ -0,0 +1,154 @@
+package coverage
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spraints/mind-meld/internal/sampletest"
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+const project = `{"targets": [{"isStage": false, "name": "sprite", "blocks": {
+  "hat": {"opcode": "flipperevents_whenProgramStarts", "next": "stop", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+  "stop": {"opcode": "ev3motor_motorStop", "next": "stop2", "parent": "hat", "inputs": {"PORT": [1, "port"]}, "fields": {}, "shadow": false, "topLevel": false},
+  "port": {"opcode": "ev3motor_menu_outputPort", "next": null, "parent": "stop", "inputs": {}, "fields": {"outputPort": ["A", null]}, "shadow": true, "topLevel": false},
+  "stop2": {"opcode": "ev3motor_motorStop", "next": null, "parent": "stop", "inputs": {"PORT": [1, [10, "B"]]}, "fields": {}, "shadow": false, "topLevel": false}
+}}]}`
+
+func TestScanner(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(project), &proj))
+
+	s := NewScanner()
+	s.AddProject("a.lms", proj)
+	s.AddProject("b.lms", proj)
+	report := s.Report()
+
+	assert.Equal(t, 2, report.Programs)
+	var counts []string
+	for _, u := range report.Opcodes {
+		counts = append(counts, string(u.Opcode))
+		if u.Opcode == "ev3motor_motorStop" {
+			assert.Equal(t, 4, u.Count)
+			assert.Equal(t, 2, u.Programs)
+		}
+	}
+	assert.Equal(t, []string{"ev3motor_motorStop", "ev3motor_menu_outputPort", "flipperevents_whenProgramStarts"}, counts)
+
+	unhandled := report.Unhandled()
+	require.Len(t, unhandled, 2)
+	assert.Equal(t, "a.lms", unhandled[0].ExampleProgram)
+	assert.JSONEq(t, `{
+	  "port": {"opcode": "ev3motor_menu_outputPort", "next": null, "parent": "stop", "inputs": {}, "fields": {"outputPort": ["A", null]}, "shadow": true, "topLevel": false},
+	  "stop": {"opcode": "ev3motor_motorStop", "next": "stop2", "parent": "hat", "inputs": {"PORT": [1, "port"]}, "fields": {}, "shadow": false, "topLevel": false}
+	}`, string(unhandled[0].Example))
+}
+
+func TestScannerSample(t *testing.T) {
+	s := NewScanner()
+	s.AddProject("project.lms", sampletest.Read(t).Project)
+	report := s.Report()
+
+	assert.Equal(t, 1, report.Programs)
+	assert.Empty(t, report.Unhandled())
+	usage := map[lmsp.ProjectOpcode]Usage{}
+	for _, u := range report.Opcodes {
+		usage[u.Opcode] = u
+	}
+	assert.Equal(t, Usage{Opcode: "flippermoremotor_multiple-port-selector", Count: 8, Programs: 1, Handled: true}, report.Opcodes[0])
+	assert.Equal(t, Usage{Opcode: "radiobroadcast_broadcast-signal", Count: 3, Programs: 1, Handled: true}, usage["radiobroadcast_broadcast-signal"])
+	assert.Equal(t, Usage{Opcode: "flippermotor_motorTurnForDirection", Count: 1, Programs: 1, Handled: true}, usage["flippermotor_motorTurnForDirection"])
+	assert.Equal(t, Usage{Opcode: "radiobroadcast_whenIReceiveRadioSignalHat", Count: 1, Programs: 1, Handled: true}, usage["radiobroadcast_whenIReceiveRadioSignalHat"])
+}
+
+func TestAddFile(t *testing.T) {
+	data, err := ioutil.ReadFile(sampletest.Path())
+	require.NoError(t, err)
+	python, err := ioutil.ReadFile("../lmsp/testdata/hello.llsp")
+	require.NoError(t, err)
+
+	s := NewScanner()
+	s.AddFile("project.lms", data)
+	s.AddFile("copy.lms", data)
+	s.AddFile("hello.llsp", python)
+	s.AddFile("broken.lms", []byte("not a zip"))
+	report := s.Report()
+
+	assert.Equal(t, 1, report.Programs)
+	assert.Empty(t, report.Unhandled())
+	assert.Equal(t, []Skipped{{Name: "broken.lms", Error: "zip: not a valid zip file"}}, report.Skipped)
+}
+
+func TestWriteText(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(project), &proj))
+	s := NewScanner()
+	s.AddProject("a.lms", proj)
+
+	var buf bytes.Buffer
+	require.NoError(t, s.Report().Write(&buf, "text"))
+	assert.Equal(t, `programs: 1
+
+COUNT  PROGRAMS  OPCODE
+2      1         ev3motor_motorStop (not handled)
+1      1         ev3motor_menu_outputPort (not handled)
+1      1         flipperevents_whenProgramStarts
+
+ev3motor_motorStop, in a.lms:
+  {
+    "port": {
+      "opcode": "ev3motor_menu_outputPort",
+      "next": null,
+      "parent": "stop",
+      "inputs": {},
+      "fields": {
+        "outputPort": [
+          "A",
+          null
+        ]
+      },
+      "shadow": true,
+      "topLevel": false
+    },
+    "stop": {
+      "opcode": "ev3motor_motorStop",
+      "next": "stop2",
+      "parent": "hat",
+      "inputs": {
+        "PORT": [
+          1,
+          "port"
+        ]
+      },
+      "fields": {},
+      "shadow": false,
+      "topLevel": false
+    }
+  }
+
+ev3motor_menu_outputPort, in a.lms:
+  {
+    "port": {
+      "opcode": "ev3motor_menu_outputPort",
+      "next": null,
+      "parent": "stop",
+      "inputs": {},
+      "fields": {
+        "outputPort": [
+          "A",
+          null
+        ]
+      },
+      "shadow": true,
+      "topLevel": false
+    }
+  }
+`, buf.String())
+
+	assert.EqualError(t, s.Report().Write(&buf, "csv"), `unknown format "csv" (expected text or json)`)
+}
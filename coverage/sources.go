@@ -0,0 +1,77 @@
+package coverage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ScanPath scans a program file, or all of the program files under a
+// directory.
+func (s *Scanner) ScanPath(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !IsProgram(path) && path != root {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			s.skip(path, err)
+			return nil
+		}
+		s.AddFile(path, data)
+		return nil
+	})
+}
+
+// ScanGit scans every version of every program file in the history of rev,
+// in the git repository at repoPath. Files are named like "abc1234:dir/file.lms"
+// in the report, after the newest commit that has that version of the file.
+func (s *Scanner) ScanGit(repoPath, rev string) error {
+	repo, err := git.PlainOpenWithOptions(repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return err
+	}
+	commitID, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return err
+	}
+	commits, err := repo.Log(&git.LogOptions{From: *commitID})
+	if err != nil {
+		return err
+	}
+
+	seen := map[plumbing.Hash]bool{}
+	return commits.ForEach(func(c *object.Commit) error {
+		tree, err := c.Tree()
+		if err != nil {
+			return err
+		}
+		return tree.Files().ForEach(func(f *object.File) error {
+			if !IsProgram(f.Name) || seen[f.Hash] {
+				return nil
+			}
+			seen[f.Hash] = true
+			name := c.Hash.String()[:7] + ":" + f.Name
+			r, err := f.Reader()
+			if err != nil {
+				s.skip(name, err)
+				return nil
+			}
+			defer r.Close()
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				s.skip(name, err)
+				return nil
+			}
+			s.AddFile(name, data)
+			return nil
+		})
+	})
+}
@@ -0,0 +1,59 @@
+package coverage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Write writes the report to w. format is "text" or "json".
+func (r Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "text":
+		return r.writeText(w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	return fmt.Errorf("unknown format %q (expected text or json)", format)
+}
+
+func (r Report) writeText(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "programs: %d\n\n", r.Programs)
+
+	tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COUNT\tPROGRAMS\tOPCODE")
+	for _, u := range r.Opcodes {
+		note := ""
+		if !u.Handled {
+			note = " (not handled)"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s%s\n", u.Count, u.Programs, u.Opcode, note)
+	}
+	tw.Flush()
+
+	for _, u := range r.Unhandled() {
+		fmt.Fprintf(&buf, "\n%s, in %s:\n", u.Opcode, u.ExampleProgram)
+		var example bytes.Buffer
+		if err := json.Indent(&example, u.Example, "  ", "  "); err != nil {
+			example.Reset()
+			example.Write(u.Example)
+		}
+		fmt.Fprintf(&buf, "  %s\n", example.String())
+	}
+
+	if len(r.Skipped) > 0 {
+		fmt.Fprintln(&buf)
+	}
+	for _, s := range r.Skipped {
+		fmt.Fprintf(&buf, "skipped %s: %s\n", s.Name, strings.TrimSpace(s.Error))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -19,7 +19,7 @@ const (
 	UpdateCache
 )
 
-func RunPreCommit(mode PreCommitMode) error {
+func RunPreCommit(mode PreCommitMode, opts lmsdump.Options) error {
 	root, err := git.GetRepoRoot()
 	if err != nil {
 		return err
@@ -33,7 +33,7 @@ func RunPreCommit(mode PreCommitMode) error {
 	for _, file := range files {
 		if strings.HasSuffix(file.Path, ".lms") {
 			dumpPath := file.Path + ".dump"
-			if err := createDumpFile(root, file, dumpPath, mode); err != nil {
+			if err := createDumpFile(root, file, dumpPath, mode, opts); err != nil {
 				fmt.Printf("%s: %v\n", dumpPath, err)
 			} else {
 				fmt.Printf("%s: OK\n", dumpPath)
@@ -44,7 +44,7 @@ func RunPreCommit(mode PreCommitMode) error {
 	return nil
 }
 
-func createDumpFile(repoRoot string, file git.IndexEntry, dumpPath string, mode PreCommitMode) error {
+func createDumpFile(repoRoot string, file git.IndexEntry, dumpPath string, mode PreCommitMode, opts lmsdump.Options) error {
 	tmp, err := os.CreateTemp("", "mind-meld-pre-commit-*")
 	if err != nil {
 		return err
@@ -61,6 +61,13 @@ func createDumpFile(repoRoot string, file git.IndexEntry, dumpPath string, mode
 	if err != nil {
 		return err
 	}
+	for _, p := range lmsfile.Problems {
+		fmt.Printf("%s: warning: %v\n", file.Path, p)
+	}
+	for _, w := range lmsfile.Warnings {
+		fmt.Printf("%s: warning: %v\n", file.Path, w)
+	}
+	opts.Manifest = lmsfile.Manifest
 
 	switch mode {
 	case UpdateWorkingCopy:
@@ -69,7 +76,7 @@ func createDumpFile(repoRoot string, file git.IndexEntry, dumpPath string, mode
 			return err
 		}
 
-		if err := lmsdump.Dump(dumped, lmsfile.Project); err != nil {
+		if err := opts.Dump(dumped, lmsfile.Project); err != nil {
 			return err
 		}
 
@@ -79,7 +86,7 @@ func createDumpFile(repoRoot string, file git.IndexEntry, dumpPath string, mode
 
 	case UpdateCache:
 		dumpOID, err := git.HashObject(repoRoot, func(w io.Writer) error {
-			return lmsdump.Dump(w, lmsfile.Project)
+			return opts.Dump(w, lmsfile.Project)
 		})
 		if err != nil {
 			return err
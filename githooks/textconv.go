@@ -0,0 +1,59 @@
+package githooks
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spraints/mind-meld/lmsdump"
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// TextConv writes a plain text version of the .lms, .lmsp, .llsp, or .llsp3
+// file at path to w. Block programs are rendered with lmsdump and python
+// programs are written as-is.
+//
+// This is meant to be used as a git textconv filter, e.g.
+//
+//	git config diff.mind-meld.textconv 'mind-meld git-diff'
+func TextConv(w io.Writer, path string, opts lmsdump.Options) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unable to render program: %v", r)
+		}
+	}()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	l, err := lmsp.ReadFile(f)
+	if err != nil {
+		return err
+	}
+
+	if man, err := l.Manifest(); err == nil {
+		if man.Type == "python" {
+			program, err := l.Python()
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, program)
+			return err
+		}
+		opts.Manifest = &man
+	}
+
+	// Show as much of the program as possible, so that 'git diff' is still
+	// useful when a block can't be decoded.
+	proj, problems, err := l.DecodeProject(lmsp.DecodeOptions{Lenient: true})
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "mind-meld: %s: warning: %v\n", path, p)
+	}
+	return opts.Dump(w, proj)
+}
@@ -0,0 +1,32 @@
+package githooks
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spraints/mind-meld/lmsdump"
+)
+
+func TestTextConvBlocks(t *testing.T) {
+	expected, err := ioutil.ReadFile("../lmsdump/testdata/project.lms.dump")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, TextConv(&buf, "../lmsdump/testdata/project.lms", lmsdump.Options{}))
+	assert.Equal(t, string(expected), buf.String())
+}
+
+func TestTextConvPython(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, TextConv(&buf, "../lmsp/testdata/hello.llsp", lmsdump.Options{}))
+	assert.Equal(t, "from spike import PrimeHub\n\nhub = PrimeHub()\nhub.light_matrix.write('Hi')\n", buf.String())
+}
+
+func TestTextConvNotAProgram(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Error(t, TextConv(&buf, "textconv.go", lmsdump.Options{}))
+}
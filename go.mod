@@ -1,12 +1,14 @@
 module github.com/spraints/mind-meld
 
-go 1.15
+go 1.16
 
 require (
 	github.com/charmbracelet/bubbletea v0.16.0
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-git/go-git/v5 v5.12.0
 	github.com/pkg/errors v0.9.1
+	github.com/sergi/go-diff v1.3.2-0.20230802210424-5b0b94c5c0d3
 	github.com/spf13/cobra v1.8.1
 	github.com/stretchr/testify v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
 )
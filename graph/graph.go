@@ -0,0 +1,248 @@
+// Package graph shows how the scripts in a block program start each other,
+// through broadcasts, radio signals, and custom blocks.
+package graph
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/spraints/mind-meld/lmsdump"
+	"github.com/spraints/mind-meld/lmsp"
+	"github.com/spraints/mind-meld/opcodes"
+)
+
+type NodeKind string
+
+const (
+	// ScriptNode is a script that starts with a hat block, including the
+	// definition of a custom block.
+	ScriptNode NodeKind = "script"
+	// BroadcastNode is a broadcast message.
+	BroadcastNode NodeKind = "broadcast"
+	// SignalNode is a radio signal, which can be sent between hubs.
+	SignalNode NodeKind = "signal"
+)
+
+type EdgeKind string
+
+const (
+	// Broadcast goes from a script to a message that it broadcasts.
+	Broadcast EdgeKind = "broadcast"
+	// BroadcastAndWait goes from a script to a message that it broadcasts
+	// and then waits for the receivers to finish.
+	BroadcastAndWait EdgeKind = "broadcast and wait"
+	// Transmit goes from a script to a radio signal that it sends.
+	Transmit EdgeKind = "transmit"
+	// Starts goes from a message or signal to a script that receives it.
+	Starts EdgeKind = "starts"
+	// Calls goes from a script to the definition of a custom block that it
+	// uses.
+	Calls EdgeKind = "calls"
+)
+
+type Node struct {
+	// ID is unique in the graph, e.g. "broadcast:message1" or
+	// "script:robot:a1b2".
+	ID    string   `json:"id"`
+	Kind  NodeKind `json:"kind"`
+	Label string   `json:"label"`
+
+	// Target and Block are set for scripts. Block is the ID of the hat
+	// block.
+	Target string              `json:"target,omitempty"`
+	Block  lmsp.ProjectBlockID `json:"block,omitempty"`
+}
+
+type Edge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+// Graph has a node for each script, broadcast message, and radio signal.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Build makes a graph of proj. Scripts are in the same order as
+// ProjectTarget.Scripts, followed by the broadcasts and then the radio
+// signals, ordered by name. Scripts that don't start with a hat block never
+// run, so they're left out.
+func Build(proj lmsp.Project) *Graph {
+	b := &builder{
+		g:          &Graph{},
+		broadcasts: map[string]bool{},
+		signals:    map[string]bool{},
+		edges:      map[Edge]bool{},
+	}
+	for _, t := range proj.Targets {
+		for _, name := range t.Broadcasts {
+			b.broadcasts[string(name)] = true
+		}
+	}
+
+	for _, t := range proj.Targets {
+		b.procs = map[string]string{}
+		var scripts []lmsp.Script
+		for it := t.Scripts(); it.Next(); {
+			s := it.Script()
+			if !opcodes.IsHat(s.Top) {
+				continue
+			}
+			scripts = append(scripts, s)
+			label := scriptLabel(t, s.ID)
+			if proc, ok := procCode(t, s.Top); ok {
+				b.procs[proc] = scriptID(t, s.ID)
+				label = "define " + proc
+			}
+			b.g.Nodes = append(b.g.Nodes, Node{
+				ID:     scriptID(t, s.ID),
+				Kind:   ScriptNode,
+				Label:  label,
+				Target: t.Name,
+				Block:  s.ID,
+			})
+		}
+		for _, s := range scripts {
+			b.hat(t, s)
+			lmsp.Walk(&edgeFinder{b: b, from: scriptID(t, s.ID)}, t, s.ID)
+		}
+	}
+
+	b.messageNodes(BroadcastNode, b.broadcasts)
+	b.messageNodes(SignalNode, b.signals)
+	return b.g
+}
+
+type builder struct {
+	g          *Graph
+	broadcasts map[string]bool
+	signals    map[string]bool
+	edges      map[Edge]bool
+	// procs maps the proccodes of the current target's custom blocks to
+	// the IDs of their definitions.
+	procs map[string]string
+}
+
+func (b *builder) edge(from, to string, kind EdgeKind) {
+	e := Edge{From: from, To: to, Kind: kind}
+	if !b.edges[e] {
+		b.edges[e] = true
+		b.g.Edges = append(b.g.Edges, e)
+	}
+}
+
+func (b *builder) messageNodes(kind NodeKind, names map[string]bool) {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		b.g.Nodes = append(b.g.Nodes, Node{ID: messageID(kind, name), Kind: kind, Label: name})
+	}
+}
+
+// hat adds the edge for the message or signal that starts a script.
+func (b *builder) hat(t lmsp.ProjectTarget, s lmsp.Script) {
+	switch s.Top.Opcode {
+	case "event_whenbroadcastreceived":
+		name := s.Top.FieldValue("BROADCAST_OPTION")
+		b.broadcasts[name] = true
+		b.edge(messageID(BroadcastNode, name), scriptID(t, s.ID), Starts)
+	case "radiobroadcast_whenIReceiveRadioSignalHat":
+		if name, ok := inputName(t, s.Top, "SIGNAL"); ok {
+			b.signals[name] = true
+			b.edge(messageID(SignalNode, name), scriptID(t, s.ID), Starts)
+		}
+	}
+}
+
+// edgeFinder adds edges for the blocks in a script that start other scripts.
+type edgeFinder struct {
+	lmsp.BaseVisitor
+	b    *builder
+	from string
+}
+
+func (f *edgeFinder) EnterStatement(t lmsp.ProjectTarget, _ lmsp.ProjectBlockID, block *lmsp.ProjectBlockObject) bool {
+	switch {
+	case block.Opcode == "event_broadcast" || block.Opcode == "event_broadcastandwait":
+		kind := Broadcast
+		if block.Opcode == "event_broadcastandwait" {
+			kind = BroadcastAndWait
+		}
+		if name, ok := inputName(t, block, "BROADCAST_INPUT"); ok {
+			f.b.broadcasts[name] = true
+			f.b.edge(f.from, messageID(BroadcastNode, name), kind)
+		}
+	case strings.HasPrefix(string(block.Opcode), "radiobroadcast_broadcastRadioSignal"):
+		if name, ok := inputName(t, block, "SIGNAL"); ok {
+			f.b.signals[name] = true
+			f.b.edge(f.from, messageID(SignalNode, name), Transmit)
+		}
+	case block.Opcode == "procedures_call" && block.Mutation != nil:
+		if to, ok := f.b.procs[block.Mutation.ProcCode]; ok {
+			f.b.edge(f.from, to, Calls)
+		}
+	}
+	return true
+}
+
+// inputName returns the name of the broadcast or radio signal in one of a
+// block's inputs. It returns false if the name comes from a reporter, so it
+// isn't known until the program runs.
+func inputName(t lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, name lmsp.ProjectInputID) (string, bool) {
+	input := block.Inputs[name]
+	if input == nil {
+		return "", false
+	}
+	if p := input.Value.Primitive; p != nil {
+		return p.Value, true
+	}
+	id, ok := input.BlockID()
+	if !ok {
+		return "", false
+	}
+	menu, ok := t.Block(id)
+	if !ok || !menu.Shadow {
+		return "", false
+	}
+	for _, field := range menu.Fields {
+		return field.Value, true
+	}
+	return "", false
+}
+
+func procCode(t lmsp.ProjectTarget, def *lmsp.ProjectBlockObject) (string, bool) {
+	if def.Opcode != "procedures_definition" {
+		return "", false
+	}
+	id, ok := def.Inputs["custom_block"].BlockID()
+	if !ok {
+		return "", false
+	}
+	proto, ok := t.Block(id)
+	if !ok || proto.Mutation == nil {
+		return "", false
+	}
+	return proto.Mutation.ProcCode, true
+}
+
+// scriptLabel describes a script by its hat block, the same way that
+// lmsdump does.
+func scriptLabel(t lmsp.ProjectTarget, id lmsp.ProjectBlockID) string {
+	var buf bytes.Buffer
+	lmsdump.Block(&buf, t, id)
+	return strings.TrimSuffix(strings.TrimSpace(buf.String()), ":")
+}
+
+func scriptID(t lmsp.ProjectTarget, id lmsp.ProjectBlockID) string {
+	return "script:" + t.Name + ":" + string(id)
+}
+
+func messageID(kind NodeKind, name string) string {
+	return string(kind) + ":" + name
+}
@@ -0,0 +1,142 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spraints/mind-meld/internal/sampletest"
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+const project = `{"targets": [
+  {"isStage": true, "name": "Stage", "broadcasts": {"b1": "go", "b2": "unused"}, "blocks": {}},
+  {"isStage": false, "name": "robot", "blocks": {
+    "start": {"opcode": "flipperevents_whenProgramStarts", "next": "send", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+    "send": {"opcode": "event_broadcast", "next": "call", "parent": "start", "inputs": {"BROADCAST_INPUT": [1, [11, "go", "b1"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "call": {"opcode": "procedures_call", "next": null, "parent": "send", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false, "mutation": {"tagName": "mutation", "children": [], "proccode": "spin", "argumentids": "[]", "warp": "false"}},
+    "recv": {"opcode": "event_whenbroadcastreceived", "next": "radio", "parent": null, "inputs": {}, "fields": {"BROADCAST_OPTION": ["go", "b1"]}, "shadow": false, "topLevel": true, "x": 300, "y": 0},
+    "radio": {"opcode": "radiobroadcast_broadcastRadioSignalWithValueCommand", "next": null, "parent": "recv", "inputs": {"SIGNAL": [1, "signal"], "VALUE": [1, [10, "hi"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "signal": {"opcode": "radiobroadcast_broadcast-signal", "next": null, "parent": "radio", "inputs": {}, "fields": {"field_radiobroadcast_broadcast-signal": ["ping", null]}, "shadow": true, "topLevel": false},
+    "def": {"opcode": "procedures_definition", "next": null, "parent": null, "inputs": {"custom_block": [1, "proto"]}, "fields": {}, "shadow": false, "topLevel": true, "x": 600, "y": 0},
+    "proto": {"opcode": "procedures_prototype", "next": null, "parent": "def", "inputs": {}, "fields": {}, "shadow": true, "topLevel": false, "mutation": {"tagName": "mutation", "children": [], "proccode": "spin", "argumentids": "[]", "argumentnames": "[]", "argumentdefaults": "[]", "warp": "false"}},
+    "loose": {"opcode": "event_broadcast", "next": null, "parent": null, "inputs": {"BROADCAST_INPUT": [1, [11, "go", "b1"]]}, "fields": {}, "shadow": false, "topLevel": true, "x": 900, "y": 0}
+  }}
+]}`
+
+func build(t *testing.T) *Graph {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(project), &proj))
+	return Build(proj)
+}
+
+func TestBuild(t *testing.T) {
+	g := build(t)
+
+	var nodes []string
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n.ID+" "+n.Label)
+	}
+	assert.Equal(t, []string{
+		"script:robot:def define spin",
+		"script:robot:recv when I receive \"go\"",
+		"script:robot:start when program starts",
+		"broadcast:go go",
+		"broadcast:unused unused",
+		"signal:ping ping",
+	}, nodes)
+
+	assert.Equal(t, []Edge{
+		{From: "broadcast:go", To: "script:robot:recv", Kind: Starts},
+		{From: "script:robot:recv", To: "signal:ping", Kind: Transmit},
+		{From: "script:robot:start", To: "broadcast:go", Kind: Broadcast},
+		{From: "script:robot:start", To: "script:robot:def", Kind: Calls},
+	}, g.Edges)
+}
+
+func TestBuildSample(t *testing.T) {
+	g := Build(sampletest.Read(t).Project)
+
+	labels := map[string]string{}
+	var nodes []string
+	for _, n := range g.Nodes {
+		labels[n.ID] = n.Label
+		nodes = append(nodes, string(n.Kind)+" "+n.Label)
+	}
+	assert.Equal(t, []string{
+		"script when program starts",
+		"script when gesture \"shake\" occurs",
+		"script radiobroadcast_whenIReceiveRadioSignalHat(signal: signal171)",
+		"script [port A] when pressed",
+		"script when timer > 10",
+		"script when \"front\" is up",
+		"script when \"space\" key pressed",
+		"script when (reflectivity(port: A) < 50)",
+		"script when \"left\" button \"pressed\"",
+		"script when I receive \"message1\"",
+		"script [port A] when distance < 8 %",
+		"script [port A] when color is 9",
+		"broadcast message1",
+		"signal signal171",
+	}, nodes)
+
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, labels[e.From]+" -> "+labels[e.To]+" ("+string(e.Kind)+")")
+	}
+	assert.Equal(t, []string{
+		"when program starts -> message1 (broadcast)",
+		"signal171 -> radiobroadcast_whenIReceiveRadioSignalHat(signal: signal171) (starts)",
+		"message1 -> when I receive \"message1\" (starts)",
+		"[port A] when color is 9 -> message1 (broadcast and wait)",
+	}, edges)
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, build(t).Write(&buf, "dot"))
+	assert.Equal(t, `digraph program {
+  rankdir=LR;
+  subgraph cluster_0 {
+    label="robot";
+    n0 [label="define spin", shape=box];
+    n1 [label="when I receive \"go\"", shape=box];
+    n2 [label="when program starts", shape=box];
+  }
+  n3 [label="go", shape=ellipse];
+  n4 [label="unused", shape=ellipse];
+  n5 [label="ping", shape=hexagon];
+  n3 -> n1 [label="starts"];
+  n1 -> n5 [label="transmit"];
+  n2 -> n3 [label="broadcast"];
+  n2 -> n0 [label="calls"];
+}
+`, buf.String())
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, build(t).Write(&buf, "mermaid"))
+	assert.Equal(t, `flowchart LR
+  subgraph t0["robot"]
+    n0["define spin"]
+    n1["when I receive #quot;go#quot;"]
+    n2["when program starts"]
+  end
+  n3(["go"])
+  n4(["unused"])
+  n5{{"ping"}}
+  n3 -->|"starts"| n1
+  n1 -->|"transmit"| n5
+  n2 -->|"broadcast"| n3
+  n2 -->|"calls"| n0
+`, buf.String())
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	assert.EqualError(t, build(t).Write(&buf, "png"), `unknown format "png" (expected one of dot, json, mermaid)`)
+}
@@ -0,0 +1,140 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var writers = map[string]func(w *bufio.Writer, g *Graph){
+	"dot":     writeDOT,
+	"json":    writeJSON,
+	"mermaid": writeMermaid,
+}
+
+// Formats returns the names of the formats that Write can use.
+func Formats() []string {
+	var names []string
+	for name := range writers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write writes the graph to w. format is one of Formats.
+func (g *Graph) Write(w io.Writer, format string) error {
+	write, ok := writers[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q (expected one of %s)", format, strings.Join(Formats(), ", "))
+	}
+	bw := bufio.NewWriter(w)
+	write(bw, g)
+	return bw.Flush()
+}
+
+func writeJSON(w *bufio.Writer, g *Graph) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(g)
+}
+
+// groups returns the names of the nodes' targets, in order, and the nodes in
+// each. Broadcasts and signals are shared by all targets, so they're in a
+// group named "".
+func (g *Graph) groups() ([]string, map[string][]int) {
+	var names []string
+	nodes := map[string][]int{}
+	for i, n := range g.Nodes {
+		if _, ok := nodes[n.Target]; !ok && n.Target != "" {
+			names = append(names, n.Target)
+		}
+		nodes[n.Target] = append(nodes[n.Target], i)
+	}
+	return names, nodes
+}
+
+// shortIDs gives each node an ID like "n0", because node IDs have characters
+// that Mermaid can't use.
+func (g *Graph) shortIDs() map[string]string {
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+	return ids
+}
+
+var dotShapes = map[NodeKind]string{
+	ScriptNode:    "box",
+	BroadcastNode: "ellipse",
+	SignalNode:    "hexagon",
+}
+
+func writeDOT(w *bufio.Writer, g *Graph) {
+	ids := g.shortIDs()
+	node := func(indent string, n Node) {
+		fmt.Fprintf(w, "%s%s [label=%s, shape=%s];\n", indent, ids[n.ID], dotQuote(n.Label), dotShapes[n.Kind])
+	}
+
+	w.WriteString("digraph program {\n")
+	w.WriteString("  rankdir=LR;\n")
+	targets, nodes := g.groups()
+	for i, target := range targets {
+		fmt.Fprintf(w, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(w, "    label=%s;\n", dotQuote(target))
+		for _, j := range nodes[target] {
+			node("    ", g.Nodes[j])
+		}
+		w.WriteString("  }\n")
+	}
+	for _, j := range nodes[""] {
+		node("  ", g.Nodes[j])
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(w, "  %s -> %s [label=%s];\n", ids[e.From], ids[e.To], dotQuote(string(e.Kind)))
+	}
+	w.WriteString("}\n")
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+var mermaidShapes = map[NodeKind][2]string{
+	ScriptNode:    {"[", "]"},
+	BroadcastNode: {"([", "])"},
+	SignalNode:    {"{{", "}}"},
+}
+
+func writeMermaid(w *bufio.Writer, g *Graph) {
+	ids := g.shortIDs()
+	node := func(indent string, n Node) {
+		shape := mermaidShapes[n.Kind]
+		fmt.Fprintf(w, "%s%s%s%s%s\n", indent, ids[n.ID], shape[0], mermaidQuote(n.Label), shape[1])
+	}
+
+	w.WriteString("flowchart LR\n")
+	targets, nodes := g.groups()
+	for i, target := range targets {
+		fmt.Fprintf(w, "  subgraph t%d[%s]\n", i, mermaidQuote(target))
+		for _, j := range nodes[target] {
+			node("    ", g.Nodes[j])
+		}
+		w.WriteString("  end\n")
+	}
+	for _, j := range nodes[""] {
+		node("  ", g.Nodes[j])
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(w, "  %s -->|%s| %s\n", ids[e.From], mermaidQuote(string(e.Kind)), ids[e.To])
+	}
+}
+
+// mermaidQuote quotes a label. Mermaid labels can't have quotes in them, so
+// they're written as entities.
+func mermaidQuote(s string) string {
+	return `"` + strings.NewReplacer(`"`, "#quot;", "\n", " ").Replace(s) + `"`
+}
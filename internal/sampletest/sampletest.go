@@ -0,0 +1,27 @@
+// Package sampletest gives tests the sample MINDSTORMS program that lmsdump's
+// tests use, which has most of the blocks that the apps have.
+package sampletest
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spraints/mind-meld/lmsp/lmspsimple"
+)
+
+// Path returns the path of the sample program.
+func Path() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "lmsdump", "testdata", "project.lms")
+}
+
+// Read reads the sample program, and fails t if it can't.
+func Read(t testing.TB) *lmspsimple.File {
+	t.Helper()
+	f, err := lmspsimple.Read(Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
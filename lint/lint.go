@@ -0,0 +1,154 @@
+// Package lint finds mistakes in block programs, like empty inputs, variables
+// that are never used, and blocks that can never run.
+package lint
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// Diagnostic is one problem that a rule found.
+type Diagnostic struct {
+	// Target is the name of the sprite or stage that the problem is in.
+	Target string
+
+	// Block is the ID of the block with the problem. It's empty for
+	// problems that aren't about one block, like an unused variable.
+	Block lmsp.ProjectBlockID
+
+	// Rule is the ID of the rule that found the problem.
+	Rule string
+
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	loc := d.Target
+	if d.Block != "" {
+		loc += ":" + string(d.Block)
+	}
+	return fmt.Sprintf("%s: %s (%s)", loc, d.Message, d.Rule)
+}
+
+// Rule is one kind of problem that Lint looks for.
+type Rule struct {
+	ID          string
+	Description string
+
+	check func(l *linter)
+}
+
+var rules = []Rule{
+	{ID: "empty-input", Description: "inputs that were left empty", check: checkEmptyInputs},
+	{ID: "forever-no-wait", Description: "forever loops that never wait", check: checkForeverNoWait},
+	{ID: "loose-block", Description: "blocks that aren't attached to a hat block, so they never run", check: checkLooseBlocks},
+	{ID: "unreachable", Description: "blocks after a stop block", check: checkUnreachable},
+	{ID: "unreceived-broadcast", Description: "broadcasts that no script receives", check: checkUnreceivedBroadcasts},
+	{ID: "unused-broadcast", Description: "broadcast messages that are never sent or received", check: checkUnusedBroadcasts},
+	{ID: "unused-custom-block", Description: "custom blocks that are never used", check: checkUnusedCustomBlocks},
+	{ID: "unused-list", Description: "lists that are never used", check: checkUnusedLists},
+	{ID: "unused-variable", Description: "variables that are never used", check: checkUnusedVariables},
+}
+
+// Rules returns all of the rules, ordered by ID.
+func Rules() []Rule {
+	return append([]Rule(nil), rules...)
+}
+
+// Options changes what Lint reports.
+type Options struct {
+	// Disable has the IDs of rules that shouldn't be checked.
+	Disable []string
+}
+
+// Lint checks a project with each rule that isn't disabled. The diagnostics
+// are ordered by target, then by block.
+func Lint(proj lmsp.Project, opts Options) ([]Diagnostic, error) {
+	disabled := map[string]bool{}
+	for _, id := range opts.Disable {
+		if !isRule(id) {
+			return nil, fmt.Errorf("unknown lint rule %q", id)
+		}
+		disabled[id] = true
+	}
+
+	l := newLinter(proj)
+	for _, r := range rules {
+		if !disabled[r.ID] {
+			l.rule = r.ID
+			r.check(l)
+		}
+	}
+
+	targetOrder := map[string]int{}
+	for i, t := range proj.Targets {
+		targetOrder[t.Name] = i
+	}
+	sort.Slice(l.diags, func(i, j int) bool {
+		a, b := l.diags[i], l.diags[j]
+		if a.Target != b.Target {
+			return targetOrder[a.Target] < targetOrder[b.Target]
+		}
+		if a.Block != b.Block {
+			return a.Block < b.Block
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Message < b.Message
+	})
+	return l.diags, nil
+}
+
+func isRule(id string) bool {
+	for _, r := range rules {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+type linter struct {
+	proj  lmsp.Project
+	rule  string
+	diags []Diagnostic
+
+	// refs has everything that the project's blocks refer to.
+	refs refs
+}
+
+func newLinter(proj lmsp.Project) *linter {
+	return &linter{proj: proj, refs: findRefs(proj)}
+}
+
+func (l *linter) report(target string, block lmsp.ProjectBlockID, format string, args ...interface{}) {
+	l.diags = append(l.diags, Diagnostic{
+		Target:  target,
+		Block:   block,
+		Rule:    l.rule,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// eachBlock calls fn for each block object in each target, ordered by ID.
+func (l *linter) eachBlock(fn func(target lmsp.ProjectTarget, id lmsp.ProjectBlockID, block *lmsp.ProjectBlockObject)) {
+	for _, t := range l.proj.Targets {
+		for _, id := range blockIDs(t) {
+			if block, ok := t.Block(id); ok {
+				fn(t, id, block)
+			}
+		}
+	}
+}
+
+func blockIDs(t lmsp.ProjectTarget) []lmsp.ProjectBlockID {
+	ids := make([]lmsp.ProjectBlockID, 0, len(t.Blocks))
+	for id := range t.Blocks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
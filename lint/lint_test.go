@@ -0,0 +1,134 @@
+package lint
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spraints/mind-meld/internal/sampletest"
+	"github.com/spraints/mind-meld/lmsp"
+	"github.com/spraints/mind-meld/opcodes"
+)
+
+const project = `{"targets": [
+  {"isStage": true, "name": "Stage",
+    "variables": {"v1": ["used", 0], "v2": ["unused", 0]},
+    "lists": {"l1": ["todo", []]},
+    "broadcasts": {"b1": "go", "b2": "nobody", "b3": "forgotten"},
+    "blocks": {}},
+  {"isStage": false, "name": "robot", "blocks": {
+    "start": {"opcode": "flipperevents_whenProgramStarts", "next": "set", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+    "set": {"opcode": "data_setvariableto", "next": "send", "parent": "start", "inputs": {"VALUE": [1, [10, "1"]]}, "fields": {"VARIABLE": ["used", "v1"]}, "shadow": false, "topLevel": false},
+    "send": {"opcode": "event_broadcast", "next": "send2", "parent": "set", "inputs": {"BROADCAST_INPUT": [1, [11, "go", "b1"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "send2": {"opcode": "event_broadcast", "next": "if", "parent": "send", "inputs": {"BROADCAST_INPUT": [1, [11, "nobody", "b2"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "if": {"opcode": "control_if", "next": "loop", "parent": "send2", "inputs": {"SUBSTACK": [2, "turn"]}, "fields": {}, "shadow": false, "topLevel": false},
+    "turn": {"opcode": "flippermotor_motorTurnForDirection", "next": null, "parent": "if", "inputs": {"VALUE": [1, [4, ""]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "loop": {"opcode": "control_forever", "next": null, "parent": "if", "inputs": {"SUBSTACK": [2, "beep"]}, "fields": {}, "shadow": false, "topLevel": false},
+    "beep": {"opcode": "flippersound_beep", "next": "stop", "parent": "loop", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false},
+    "stop": {"opcode": "flippercontrol_stop", "next": "dead", "parent": "beep", "inputs": {}, "fields": {"STOP_OPTION": ["this script", null]}, "shadow": false, "topLevel": false},
+    "dead": {"opcode": "flippersound_beep", "next": null, "parent": "stop", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false},
+    "recv": {"opcode": "event_whenbroadcastreceived", "next": "loop2", "parent": null, "inputs": {}, "fields": {"BROADCAST_OPTION": ["go", "b1"]}, "shadow": false, "topLevel": true, "x": 300, "y": 0},
+    "loop2": {"opcode": "control_forever", "next": null, "parent": "recv", "inputs": {"SUBSTACK": [2, "if2"]}, "fields": {}, "shadow": false, "topLevel": false},
+    "if2": {"opcode": "control_if", "next": null, "parent": "loop2", "inputs": {"CONDITION": [2, "lt"], "SUBSTACK": [2, "wait"]}, "fields": {}, "shadow": false, "topLevel": false},
+    "lt": {"opcode": "operator_lt", "next": null, "parent": "if2", "inputs": {"OPERAND1": [3, [12, "used", "v1"], [10, ""]], "OPERAND2": [1, [10, "5"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "wait": {"opcode": "control_wait", "next": null, "parent": "if2", "inputs": {"DURATION": [1, [5, "1"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "def": {"opcode": "procedures_definition", "next": null, "parent": null, "inputs": {"custom_block": [1, "proto"]}, "fields": {}, "shadow": false, "topLevel": true, "x": 600, "y": 0},
+    "proto": {"opcode": "procedures_prototype", "next": null, "parent": "def", "inputs": {}, "fields": {}, "shadow": true, "topLevel": false, "mutation": {"tagName": "mutation", "children": [], "proccode": "spin", "argumentids": "[]", "argumentnames": "[]", "argumentdefaults": "[]", "warp": "false"}},
+    "loose": {"opcode": "flippersound_beep", "next": null, "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 900, "y": 0},
+    "var": [12, "used", "v1", 900, 100]
+  }}
+]}`
+
+func readProject(t *testing.T) lmsp.Project {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(project), &proj))
+	return proj
+}
+
+func TestLint(t *testing.T) {
+	diags, err := Lint(readProject(t), Options{})
+	require.NoError(t, err)
+
+	var actual []string
+	for _, d := range diags {
+		actual = append(actual, d.String())
+	}
+	assert.Equal(t, []string{
+		`Stage: broadcast "forgotten" is never sent or received (unused-broadcast)`,
+		`Stage: list "todo" is never used (unused-list)`,
+		`Stage: variable "unused" is never used (unused-variable)`,
+		`robot:dead: blocks after stop "this script" never run (unreachable)`,
+		`robot:def: custom block "spin" is never used (unused-custom-block)`,
+		`robot:if: input CONDITION of control_if is empty (empty-input)`,
+		`robot:loop: forever loop never waits, so other scripts may not get a chance to run (forever-no-wait)`,
+		`robot:loose: flippersound_beep isn't attached to a hat block, so it never runs (loose-block)`,
+		`robot:send2: nothing receives broadcast "nobody" (unreceived-broadcast)`,
+		`robot:turn: input VALUE of flippermotor_motorTurnForDirection is empty (empty-input)`,
+		`robot:var: variable "used" isn't in a script (loose-block)`,
+	}, actual)
+}
+
+func TestLintSample(t *testing.T) {
+	f := sampletest.Read(t)
+	diags, err := Lint(f.Project, Options{})
+	require.NoError(t, err)
+
+	rules := map[string]bool{}
+	var actual []string
+	for _, d := range diags {
+		rules[d.Rule] = true
+		actual = append(actual, d.String())
+	}
+	// The sample is a palette of blocks, so most of them aren't in scripts
+	// and have empty inputs, and nothing else is wrong with it.
+	assert.Equal(t, map[string]bool{"empty-input": true, "loose-block": true}, rules)
+	assert.Contains(t, actual, "j2kW7HqkRlyqy4KHAyn6:o)~F4xg^gRW@4aJuFmW2: input CONDITION of control_wait_until is empty (empty-input)")
+	assert.Contains(t, actual, "j2kW7HqkRlyqy4KHAyn6:ZJDc.g9Y5VFkje6F{N:|: input NUM1 of operator_divide is empty (empty-input)")
+	assert.Contains(t, actual, "j2kW7HqkRlyqy4KHAyn6:ZJDc.g9Y5VFkje6F{N:|: input NUM2 of operator_divide is empty (empty-input)")
+	assert.Contains(t, actual, "j2kW7HqkRlyqy4KHAyn6:vCgCL_#_[PvTNrt|=8TR: sensing_keypressed isn't attached to a hat block, so it never runs (loose-block)")
+	assert.Contains(t, actual, "j2kW7HqkRlyqy4KHAyn6:GT?eYv0rK|FcmnQ^oLp=: radiobroadcast_broadcastRadioSignalWithValueCommand isn't attached to a hat block, so it never runs (loose-block)")
+}
+
+func TestLintCatalog(t *testing.T) {
+	more, err := opcodes.Parse([]byte(`{
+	  "flippersound_beep": {"name": "beep", "shape": "stack", "family": "lego", "waits": true},
+	  "flippermotor_motorTurnForDirection": {"name": "run", "shape": "stack", "family": "lego", "args": [
+	    {"kind": "input", "input": "PORT", "required": true}
+	  ]}
+	}`))
+	require.NoError(t, err)
+	opcodes.SetDefault(opcodes.Builtin().Extend(more))
+	defer opcodes.SetDefault(nil)
+
+	diags, err := Lint(readProject(t), Options{})
+	require.NoError(t, err)
+	var actual []string
+	for _, d := range diags {
+		actual = append(actual, d.String())
+	}
+	assert.NotContains(t, actual, `robot:loop: forever loop never waits, so other scripts may not get a chance to run (forever-no-wait)`)
+	assert.Contains(t, actual, `robot:turn: input PORT of flippermotor_motorTurnForDirection is empty (empty-input)`)
+}
+
+func TestLintDisable(t *testing.T) {
+	var all []string
+	for _, r := range Rules() {
+		all = append(all, r.ID)
+	}
+	diags, err := Lint(readProject(t), Options{Disable: all})
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+
+	diags, err = Lint(readProject(t), Options{Disable: []string{"empty-input", "loose-block"}})
+	require.NoError(t, err)
+	for _, d := range diags {
+		assert.NotEqual(t, "empty-input", d.Rule)
+		assert.NotEqual(t, "loose-block", d.Rule)
+	}
+	assert.NotEmpty(t, diags)
+
+	_, err = Lint(readProject(t), Options{Disable: []string{"no-such-rule"}})
+	assert.EqualError(t, err, `unknown lint rule "no-such-rule"`)
+}
@@ -0,0 +1,105 @@
+package lint
+
+import "github.com/spraints/mind-meld/lmsp"
+
+// refs has the variables, lists, broadcasts, and custom blocks that a
+// project's blocks use.
+type refs struct {
+	// variables and lists have the IDs and the names of the variables and
+	// lists that blocks use. Old projects don't always have IDs in fields,
+	// so names are checked too.
+	variables map[string]bool
+	lists     map[string]bool
+
+	// sent maps the name of each broadcast to the blocks that send it.
+	sent map[string][]blockRef
+	// received has the names of the broadcasts that a script starts on.
+	received map[string]bool
+
+	// calls has the proccodes of the custom blocks that each target uses.
+	calls map[string]map[string]bool
+}
+
+type blockRef struct {
+	target string
+	id     lmsp.ProjectBlockID
+}
+
+func findRefs(proj lmsp.Project) refs {
+	r := refs{
+		variables: map[string]bool{},
+		lists:     map[string]bool{},
+		sent:      map[string][]blockRef{},
+		received:  map[string]bool{},
+		calls:     map[string]map[string]bool{},
+	}
+	for _, t := range proj.Targets {
+		r.calls[t.Name] = map[string]bool{}
+		for _, id := range blockIDs(t) {
+			if block, ok := t.Block(id); ok {
+				r.addBlock(t, id, block)
+			}
+		}
+	}
+	return r
+}
+
+func (r refs) addBlock(t lmsp.ProjectTarget, id lmsp.ProjectBlockID, block *lmsp.ProjectBlockObject) {
+	// A broadcast menu is a shadow block, so the block that sends the
+	// message is its parent.
+	sender := blockRef{target: t.Name, id: id}
+	if block.Shadow && block.Parent != nil {
+		sender.id = *block.Parent
+	}
+
+	for name, field := range block.Fields {
+		switch name {
+		case "VARIABLE":
+			addRef(r.variables, field.Value, field.ID)
+		case "LIST":
+			addRef(r.lists, field.Value, field.ID)
+		case "BROADCAST_OPTION":
+			if block.Opcode == "event_whenbroadcastreceived" {
+				r.received[field.Value] = true
+			} else {
+				r.sent[field.Value] = append(r.sent[field.Value], sender)
+			}
+		}
+	}
+
+	for _, name := range block.InputNames() {
+		input := block.Inputs[name]
+		if input == nil {
+			continue
+		}
+		r.addPrimitive(sender, input.Value.Primitive)
+		if input.Obscured != nil {
+			r.addPrimitive(sender, input.Obscured.Primitive)
+		}
+	}
+
+	if block.Opcode == "procedures_call" && block.Mutation != nil {
+		r.calls[t.Name][block.Mutation.ProcCode] = true
+	}
+}
+
+func (r refs) addPrimitive(sender blockRef, p *lmsp.ProjectPrimitive) {
+	if p == nil {
+		return
+	}
+	switch p.Kind {
+	case lmsp.PrimitiveVariable:
+		addRef(r.variables, p.Value, &p.ID)
+	case lmsp.PrimitiveList:
+		addRef(r.lists, p.Value, &p.ID)
+	case lmsp.PrimitiveBroadcast:
+		r.sent[p.Value] = append(r.sent[p.Value], sender)
+	}
+}
+
+func addRef(set map[string]bool, name string, id *string) {
+	set[name] = true
+	if id != nil && *id != "" {
+		set[*id] = true
+	}
+}
@@ -0,0 +1,202 @@
+package lint
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spraints/mind-meld/lmsp"
+	"github.com/spraints/mind-meld/opcodes"
+)
+
+// requiredInputs lists the inputs that the opcode catalog marks as required,
+// which the app leaves out of a block's JSON when they're empty.
+func requiredInputs(opcode lmsp.ProjectOpcode) []lmsp.ProjectInputID {
+	entry, _ := opcodes.Default().Lookup(opcode)
+	var names []lmsp.ProjectInputID
+	for _, a := range entry.Args {
+		if a.Required {
+			names = append(names, a.Input)
+		}
+	}
+	return names
+}
+
+func checkEmptyInputs(l *linter) {
+	l.eachBlock(func(t lmsp.ProjectTarget, id lmsp.ProjectBlockID, block *lmsp.ProjectBlockObject) {
+		if block.Shadow {
+			return
+		}
+		var empty []lmsp.ProjectInputID
+		for _, name := range requiredInputs(block.Opcode) {
+			if _, ok := block.Inputs[name]; !ok {
+				empty = append(empty, name)
+			}
+		}
+		for _, name := range block.InputNames() {
+			if !lmsp.IsSubstack(name) && isEmpty(block.Inputs[name]) {
+				empty = append(empty, name)
+			}
+		}
+		sort.Slice(empty, func(i, j int) bool { return empty[i] < empty[j] })
+		for _, name := range empty {
+			l.report(t.Name, id, "input %s of %s is empty", name, block.Opcode)
+		}
+	})
+}
+
+func isEmpty(input *lmsp.ProjectInput) bool {
+	if input == nil {
+		return true
+	}
+	if _, ok := input.BlockID(); ok {
+		return false
+	}
+	p := input.Value.Primitive
+	return p == nil || (p.Kind.IsNumber() && strings.TrimSpace(p.Value) == "")
+}
+
+func checkUnusedVariables(l *linter) {
+	for _, t := range l.proj.Targets {
+		var names []string
+		for id, v := range t.Variables {
+			if !l.refs.variables[string(id)] && !l.refs.variables[v.Name] {
+				names = append(names, v.Name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			l.report(t.Name, "", "variable %q is never used", name)
+		}
+	}
+}
+
+func checkUnusedLists(l *linter) {
+	for _, t := range l.proj.Targets {
+		var names []string
+		for id, list := range t.Lists {
+			if !l.refs.lists[string(id)] && !l.refs.lists[list.Name] {
+				names = append(names, list.Name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			l.report(t.Name, "", "list %q is never used", name)
+		}
+	}
+}
+
+func checkUnusedBroadcasts(l *linter) {
+	for _, t := range l.proj.Targets {
+		var names []string
+		for _, name := range t.Broadcasts {
+			name := string(name)
+			if len(l.refs.sent[name]) == 0 && !l.refs.received[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			l.report(t.Name, "", "broadcast %q is never sent or received", name)
+		}
+	}
+}
+
+func checkUnreceivedBroadcasts(l *linter) {
+	for name, senders := range l.refs.sent {
+		if l.refs.received[name] {
+			continue
+		}
+		for _, s := range senders {
+			l.report(s.target, s.id, "nothing receives broadcast %q", name)
+		}
+	}
+}
+
+func checkLooseBlocks(l *linter) {
+	for _, t := range l.proj.Targets {
+		for _, id := range blockIDs(t) {
+			switch block := t.Blocks[id].(type) {
+			case *lmsp.ProjectBlockObject:
+				if block.TopLevel && !block.Shadow && !opcodes.IsHat(block) {
+					l.report(t.Name, id, "%s isn't attached to a hat block, so it never runs", block.Opcode)
+				}
+			case *lmsp.ProjectBlockVariable:
+				l.report(t.Name, id, "variable %q isn't in a script", block.Name)
+			case *lmsp.ProjectBlockList:
+				l.report(t.Name, id, "list %q isn't in a script", block.Name)
+			}
+		}
+	}
+}
+
+// waits is true if a block takes time to finish, which gives other scripts a
+// chance to run. Blocks that aren't in the opcode catalog wait if their names
+// say so.
+func waits(opcode lmsp.ProjectOpcode) bool {
+	if entry, ok := opcodes.Default().Lookup(opcode); ok {
+		return entry.Waits
+	}
+	return strings.HasSuffix(string(opcode), "UntilDone") ||
+		strings.HasSuffix(string(opcode), "ForTime")
+}
+
+type waitFinder struct {
+	lmsp.BaseVisitor
+	found bool
+}
+
+func (w *waitFinder) EnterStatement(_ lmsp.ProjectTarget, _ lmsp.ProjectBlockID, block *lmsp.ProjectBlockObject) bool {
+	if waits(block.Opcode) {
+		w.found = true
+	}
+	return !w.found
+}
+
+func checkForeverNoWait(l *linter) {
+	l.eachBlock(func(t lmsp.ProjectTarget, id lmsp.ProjectBlockID, block *lmsp.ProjectBlockObject) {
+		if block.Opcode != "control_forever" {
+			return
+		}
+		w := &waitFinder{}
+		if first, ok := t.InputBlock(id, "SUBSTACK"); ok {
+			lmsp.Walk(w, t, first)
+		}
+		if !w.found {
+			l.report(t.Name, id, "forever loop never waits, so other scripts may not get a chance to run")
+		}
+	})
+}
+
+func checkUnreachable(l *linter) {
+	l.eachBlock(func(t lmsp.ProjectTarget, id lmsp.ProjectBlockID, block *lmsp.ProjectBlockObject) {
+		if block.Opcode != "flippercontrol_stop" && block.Opcode != "control_stop" {
+			return
+		}
+		option := block.FieldValue("STOP_OPTION")
+		if option != "all" && option != "this script" {
+			return
+		}
+		if next, ok := t.Next(id); ok {
+			l.report(t.Name, next, "blocks after stop %q never run", option)
+		}
+	})
+}
+
+func checkUnusedCustomBlocks(l *linter) {
+	l.eachBlock(func(t lmsp.ProjectTarget, id lmsp.ProjectBlockID, block *lmsp.ProjectBlockObject) {
+		if block.Opcode != "procedures_definition" {
+			return
+		}
+		protoID, ok := t.InputBlock(id, "custom_block")
+		if !ok {
+			return
+		}
+		proto, ok := t.Block(protoID)
+		if !ok || proto.Mutation == nil {
+			return
+		}
+		if !l.refs.calls[t.Name][proto.Mutation.ProcCode] {
+			l.report(t.Name, id, "custom block %q is never used", proto.Mutation.ProcCode)
+		}
+	})
+}
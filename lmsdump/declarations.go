@@ -0,0 +1,152 @@
+package lmsdump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// renderHeader writes what the program is and what it runs on. Things that
+// change every time the program is saved, like the save time and the
+// browser's user agent, are left out.
+func renderHeader(w io.Writer, proj lmsp.Project, man *lmsp.Manifest) {
+	if man != nil {
+		fmt.Fprintf(w, "program: %s\n", man.Name)
+		fmt.Fprintf(w, "type: %s\n", man.Type)
+		if man.AppType != "" {
+			fmt.Fprintf(w, "app type: %s\n", man.AppType)
+		}
+		ids := make([]string, 0, len(man.Hardware))
+		for id := range man.Hardware {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			hw := man.Hardware[id]
+			if hw.Name != "" {
+				fmt.Fprintf(w, "hub: %s %q\n", hw.Type, hw.Name)
+			} else {
+				fmt.Fprintf(w, "hub: %s\n", hw.Type)
+			}
+		}
+	}
+
+	var exts []string
+	for _, ext := range proj.Extensions {
+		exts = append(exts, string(ext))
+	}
+	if len(exts) == 0 && man != nil {
+		exts = append(exts, man.Extensions...)
+	}
+	if len(exts) > 0 {
+		sort.Strings(exts)
+		fmt.Fprintf(w, "extensions: %s\n", strings.Join(exts, ", "))
+	}
+
+	if meta, ok := proj.Meta.(map[string]interface{}); ok {
+		if semver, ok := meta["semver"].(string); ok {
+			fmt.Fprintf(w, "scratch: %s", semver)
+			if vm, ok := meta["vm"].(string); ok {
+				fmt.Fprintf(w, " (vm %s)", vm)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// renderDeclarations writes the target's variables, lists, broadcasts,
+// monitors, costumes and sounds. Variables, lists, and broadcasts are ordered
+// by name. Costumes and sounds are kept in the project's order, because the
+// order matters to the program.
+func renderDeclarations(w io.Writer, proj lmsp.Project, target lmsp.ProjectTarget) {
+	var lines []string
+	for _, v := range target.Variables {
+		lines = append(lines, fmt.Sprintf("variable %s = %s", v.Name, jsonValue(v.Value)))
+	}
+	for _, l := range target.Lists {
+		lines = append(lines, fmt.Sprintf("list %s = %s", l.Name, jsonValue(l.Values)))
+	}
+	for _, name := range target.Broadcasts {
+		lines = append(lines, fmt.Sprintf("broadcast %q", name))
+	}
+	sort.Strings(lines)
+
+	var monitors []string
+	for _, m := range proj.Monitors {
+		if line, ok := monitorLine(m, target); ok {
+			monitors = append(monitors, line)
+		}
+	}
+	sort.Strings(monitors)
+	lines = append(lines, monitors...)
+
+	for _, c := range target.Costumes {
+		lines = append(lines, "costume "+assetLine(c))
+	}
+	for _, s := range target.Sounds {
+		lines = append(lines, "sound "+assetLine(s))
+	}
+
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// monitorLine describes a monitor that's shown on the stage for a target's
+// variable or sensor. Its value and position are left out, because they change
+// whenever the program runs.
+func monitorLine(m lmsp.ProjectMonitor, target lmsp.ProjectTarget) (string, bool) {
+	obj, ok := m.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	sprite, _ := obj["spriteName"].(string)
+	if target.IsStage && sprite != "" || !target.IsStage && sprite != target.Name {
+		return "", false
+	}
+
+	var params []string
+	if p, ok := obj["params"].(map[string]interface{}); ok {
+		for _, name := range sortedKeys(p) {
+			params = append(params, fmt.Sprintf("%s: %v", strings.ToLower(name), p[name]))
+		}
+	}
+	line := fmt.Sprintf("monitor %v(%s)", obj["opcode"], strings.Join(params, ", "))
+	if mode, ok := obj["mode"].(string); ok && mode != "default" {
+		line += " " + mode
+	}
+	if visible, ok := obj["visible"].(bool); ok && !visible {
+		line += " hidden"
+	}
+	return line, true
+}
+
+// assetLine describes a costume or sound by its name and its file type.
+func assetLine(asset interface{}) string {
+	obj, ok := asset.(map[string]interface{})
+	if !ok {
+		return jsonValue(asset)
+	}
+	return fmt.Sprintf("%q %v", obj["name"], obj["dataFormat"])
+}
+
+func jsonValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
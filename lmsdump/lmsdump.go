@@ -1,6 +1,7 @@
 package lmsdump
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -8,15 +9,32 @@ import (
 	"strings"
 
 	"github.com/spraints/mind-meld/lmsp"
+	"github.com/spraints/mind-meld/opcodes"
 )
 
+// Options controls how a project is dumped.
+type Options struct {
+	// OmitBlockIDs leaves block IDs out of the dump, so that the dump only
+	// changes when the program does.
+	OmitBlockIDs bool
+
+	// Manifest, if it's set, is described at the top of the dump.
+	Manifest *lmsp.Manifest
+}
+
 func Dump(w io.Writer, proj lmsp.Project) error {
+	return Options{}.Dump(w, proj)
+}
+
+func (o Options) Dump(w io.Writer, proj lmsp.Project) error {
+	// TODO check for errors in renderHeader.
+	renderHeader(w, proj, o.Manifest)
 	for _, target := range proj.Targets {
 		if _, err := fmt.Fprintf(w, "target: %s\n", target.Name); err != nil {
 			return err
 		}
 		// TODO check for errors in renderTarget.
-		renderTarget(indentStartingNow(w), target)
+		renderTarget(indentStartingNow(w), proj, target, o)
 	}
 	return nil
 }
@@ -25,378 +43,226 @@ func Dump(w io.Writer, proj lmsp.Project) error {
 // + visit* are the generic funcs for walking the data structure.
 //   - These will eventually be able to change from renderX(w,target,block) to w.visitBlock(target,block).
 // + render* are the visitor that writes pseudocode to a Writer.
-
-func renderTarget(w io.Writer, target lmsp.ProjectTarget) {
-	for _, id := range target.GetRootBlockIDs() {
-		fmt.Fprintf(w, "----- %s -----\n", id)
+// Code that only needs to walk the blocks should use lmsp.Walk instead.
+
+func renderTarget(w io.Writer, proj lmsp.Project, target lmsp.ProjectTarget, opts Options) {
+	renderDeclarations(w, proj, target)
+	for _, id := range scriptIDs(target) {
+		if opts.OmitBlockIDs {
+			fmt.Fprintln(w, "-----")
+		} else {
+			fmt.Fprintf(w, "----- %s -----\n", id)
+		}
 		visitBlock(w, target, id)
 		fmt.Fprintln(w)
 	}
 	first := true
-	for _, id := range target.GetStandaloneCommentIDs() {
+	for _, id := range commentIDs(target) {
 		renderComment(w, target, id)
 		if first {
 			fmt.Fprintln(w, "--------------------------------")
 			first = false
 		}
 	}
-	// todo - other fields of ProjectTarget.
+}
+
+// scriptIDs returns the IDs of the first block in each script, ordered by the
+// type of the first block and then by where the script is on the canvas. Block
+// IDs are random, so they're only used to break ties.
+func scriptIDs(target lmsp.ProjectTarget) []lmsp.ProjectBlockID {
+	ids := target.GetRootBlockIDs()
+	sort.SliceStable(ids, func(i, j int) bool {
+		a := target.Blocks[ids[i]].(*lmsp.ProjectBlockObject)
+		b := target.Blocks[ids[j]].(*lmsp.ProjectBlockObject)
+		if a.Opcode != b.Opcode {
+			return a.Opcode < b.Opcode
+		}
+		if ay, by := coord(a.Y), coord(b.Y); ay != by {
+			return ay < by
+		}
+		return coord(a.X) < coord(b.X)
+	})
+	return ids
+}
+
+// commentIDs returns the IDs of the comments that aren't attached to blocks,
+// ordered by where they are on the canvas.
+func commentIDs(target lmsp.ProjectTarget) []lmsp.ProjectCommentID {
+	ids := target.GetStandaloneCommentIDs()
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, b := target.Comments[ids[i]], target.Comments[ids[j]]
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		return a.Text < b.Text
+	})
+	return ids
+}
+
+func coord(c *int) int {
+	if c == nil {
+		return 0
+	}
+	return *c
+}
+
+// Block writes the pseudocode for one block, without the blocks that come after
+// it in its script.
+func Block(w io.Writer, target lmsp.ProjectTarget, id lmsp.ProjectBlockID) {
+	block, ok := target.Blocks[id].(*lmsp.ProjectBlockObject)
+	if !ok {
+		renderNonObject(w, target, id)
+		return
+	}
+	visitOneBlock(w, target, block)
 }
 
 func visitBlock(w io.Writer, target lmsp.ProjectTarget, id lmsp.ProjectBlockID) {
-	block := target.Blocks[id].(*lmsp.ProjectBlockObject)
+	block, ok := target.Blocks[id].(*lmsp.ProjectBlockObject)
+	if !ok {
+		renderNonObject(w, target, id)
+		return
+	}
 	if block.Comment != "" {
 		renderComment(w, target, block.Comment)
 	}
-	switch block.Opcode {
-	case "flippercontrol_stopOtherStacks",
-		"flipperdisplay_displayOff",
-		"flippermoremove_moveDidMovement",
-		"flippermove_stopMove",
-		"flippersensors_motion",
-		"flippersensors_orientation",
-		"flippersensors_resetTimer",
-		"flippersensors_resetYaw",
-		"flippersensors_timer",
-		"flippersound_stopSound",
-		"sound_cleareffects",
-		"sound_volume":
-		renderAction(w, target, block)
-
-	case "argument_reporter_string_number":
-		renderFieldSelector(w, target, block, "VALUE")
-	case "flipperdisplay_menu_ledMatrixIndex":
-		renderMenu(w, target, block, "ledMatrixIndex")
-	case "sensing_keyoptions":
-		renderFieldSelector(w, target, block, "KEY_OPTION")
-	case "flipperdisplay_color-selector-vertical",
-		"flipperdisplay_custom-animate-matrix",
-		"flipperdisplay_custom-icon-direction",
-		"flipperdisplay_custom-matrix",
-		"flipperdisplay_distance-sensor-selector",
-		"flipperdisplay_led-selector",
-		"flipperevents_color-selector",
-		"flipperevents_color-sensor-selector",
-		"flipperevents_distance-sensor-selector",
-		"flipperevents_force-sensor-selector",
-		"flippermoremotor_multiple-port-selector",
-		"flippermoremotor_single-motor-selector",
-		"flippermoremove_rotation-wheel",
-		"flippermoresensors_color-sensor-selector",
-		"flippermoresensors_force-sensor-selector",
-		"flippermotor_custom-angle",
-		"flippermotor_custom-icon-direction",
-		"flippermotor_multiple-port-selector",
-		"flippermotor_single-motor-selector",
-		"flippermove_custom-icon-direction",
-		"flippermove_movement-port-selector",
-		"flippermove_rotation-wheel",
-		"flippersensors_color-selector",
-		"flippersensors_color-sensor-selector",
-		"flippersensors_distance-sensor-selector",
-		"flippersound_custom-piano",
-		"flippersound_sound-selector",
-		"radiobroadcast_broadcast-signal":
-		renderFieldSelector(w, target, block, lmsp.ProjectFieldName("field_"+block.Opcode))
-
-	case "control_forever":
-		renderForever(w, target, block)
-	case "control_if":
-		renderControl(w, target, block, "if")
-	case "control_if_else":
-		renderIfElse(w, target, block)
-	case "control_repeat":
-		renderControlRepeat(w, target, block)
-	case "control_repeat_until":
-		renderControl(w, target, block, "until")
-	case "control_wait_until":
-		renderWaitUntil(w, target, block)
-	case "control_wait":
-		renderWait(w, target, block)
-
-	case "data_changevariableby":
-		renderChangeVariableBy(w, target, block)
-	case "data_setvariableto":
-		renderSetVariableTo(w, target, block)
-
-	case "event_broadcast":
-		renderAction(w, target, block, inputArg("BROADCAST_INPUT"))
-	case "event_broadcastandwait":
-		renderAction(w, target, block, inputArg("BROADCAST_INPUT"))
-	case "event_whenbroadcastreceived":
-		renderWhenBroadcastReceived(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-	case "event_whenkeypressed":
-		renderWhenKeyPressed(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-
-	case "flippercontrol_stop":
-		renderAction(w, target, block, fieldArg("STOP_OPTION"))
-
-	case "flipperdisplay_centerButtonLight":
-		renderAction(w, target, block, namedInputArg("COLOR"))
-	case "flipperdisplay_ledAnimation":
-		renderAction(w, target, block, namedInputArg("MATRIX"))
-	case "flipperdisplay_ledAnimationUntilDone":
-		renderAction(w, target, block, namedInputArg("MATRIX"))
-	case "flipperdisplay_ledImage":
-		renderAction(w, target, block, namedInputArg("MATRIX"))
-	case "flipperdisplay_ledImageFor":
-		renderAction(w, target, block, namedInputArg("MATRIX"), namedInputArg("VALUE"))
-	case "flipperdisplay_ledOn":
-		renderAction(w, target, block, namedInputArg("BRIGHTNESS"), namedInputArg("X"), namedInputArg("Y"))
-	case "flipperdisplay_ledRotateDirection":
-		renderAction(w, target, block, namedInputArg("DIRECTION"))
-	case "flipperdisplay_ledRotateOrientation":
-		renderAction(w, target, block, namedInputArg("ORIENTATION"))
-	case "flipperdisplay_ledSetBrightness":
-		renderAction(w, target, block, namedInputArg("BRIGHTNESS"))
-	case "flipperdisplay_ledText":
-		renderAction(w, target, block, namedInputArg("TEXT"))
-	case "flipperdisplay_menu_orientation":
-		renderMenu(w, target, block, "orientation")
-	case "flipperdisplay_ultrasonicLightUp":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("VALUE"))
-
-	case "flipperevents_whenButton":
-		renderWhenButton(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-	case "flipperevents_whenColor":
-		renderWhenColor(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-	case "flipperevents_whenCondition":
-		renderWhenCondition(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-	case "flipperevents_whenDistance":
-		renderWhenDistance(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-	case "flipperevents_whenGesture":
-		renderWhenGesture(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-	case "flipperevents_whenOrientation":
-		renderWhenOrientation(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-	case "flipperevents_whenPressed":
-		renderWhenPressed(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-	case "flipperevents_whenProgramStarts":
-		renderWhenProgramStarts(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-	case "flipperevents_whenTimer":
-		renderWhenTimer(w, target, block)
-		w = indent(w) // TODO - move this to a renderX func.
-
-	case "flippermoremotor_menu_acceleration":
-		renderMenu(w, target, block, "acceleration")
-	case "flippermoremotor_motorDidMovement":
-		renderAction(w, target, block, namedInputArg("PORT"))
-	case "flippermoremotor_motorGoToRelativePosition":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("POSITION"), namedInputArg("SPEED"))
-	case "flippermoremotor_motorSetAcceleration":
-		renderAction(w, target, block, namedInputArg("ACCELERATION"), namedInputArg("PORT"))
-	case "flippermoremotor_motorSetDegreeCounted":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("VALUE"))
-	case "flippermoremotor_motorSetStallDetection":
-		renderAction(w, target, block, namedFieldArg("ENABLED"), namedInputArg("PORT"))
-	case "flippermoremotor_motorSetStopMethod":
-		renderAction(w, target, block, namedInputArg("PORT"), namedFieldArg("STOP"))
-	case "flippermoremotor_motorStartPower":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("POWER"))
-	case "flippermoremotor_motorStartSpeed":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("SPEED"))
-	case "flippermoremotor_motorTurnForSpeed":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("SPEED"), fieldInputArg("UNIT", "VALUE"))
-	case "flippermoremotor_position":
-		renderAction(w, target, block, namedInputArg("PORT"))
-	case "flippermoremotor_power":
-		renderAction(w, target, block, namedInputArg("PORT"))
-
-	case "flippermoremove_menu_acceleration":
-		renderMenu(w, target, block, "acceleration")
-	case "flippermoremove_moveDistanceAtSpeed":
-		renderAction(w, target, block, namedInputArg("LEFT"), namedInputArg("RIGHT"), namedInputArg("DISTANCE"), namedFieldArg("UNIT"))
-	case "flippermoremove_movementSetAcceleration":
-		renderAction(w, target, block, inputArg("ACCELERATION"))
-	case "flippermoremove_movementSetStopMethod":
-		renderAction(w, target, block, namedFieldArg("STOP"))
-	case "flippermoremove_startDualPower":
-		renderAction(w, target, block, namedInputArg("LEFT"), namedInputArg("RIGHT"))
-	case "flippermoremove_startDualSpeed":
-		renderAction(w, target, block, namedInputArg("LEFT"), namedInputArg("RIGHT"))
-	case "flippermoremove_startSteerAtSpeed":
-		renderAction(w, target, block, namedInputArg("STEERING"), namedInputArg("SPEED"))
-	case "flippermoremove_steerDistanceAtSpeed":
-		renderAction(w, target, block, namedInputArg("STEERING"), namedInputArg("SPEED"), namedInputArg("DISTANCE"), namedFieldArg("UNIT"))
-
-	case "flippermoresensors_acceleration":
-		renderAction(w, target, block, namedFieldArg("AXIS"))
-	case "flippermoresensors_angularVelocity":
-		renderAction(w, target, block, namedFieldArg("AXIS"))
-	case "flippermoresensors_force":
-		renderAction(w, target, block, namedInputArg("PORT"), namedFieldArg("UNIT"))
-	case "flippermoresensors_isPressed":
-		renderAction(w, target, block, namedInputArg("PORT"), namedFieldArg("OPTION"))
-	case "flippermoresensors_rawColor":
-		renderAction(w, target, block, namedFieldArg("COLOR"), namedInputArg("PORT"))
-
-	case "flippermotor_absolutePosition":
-		renderAction(w, target, block, namedInputArg("PORT"))
-	case "flippermotor_motorGoDirectionToPosition":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("POSITION"), namedFieldArg("DIRECTION"))
-	case "flippermotor_motorSetSpeed":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("SPEED"))
-	case "flippermotor_motorStartDirection":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("DIRECTION"))
-	case "flippermotor_motorStop":
-		renderAction(w, target, block, namedInputArg("PORT"))
-	case "flippermotor_motorTurnForDirection":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("DIRECTION"), fieldInputArg("UNIT", "VALUE"))
-	case "flippermotor_speed":
-		renderAction(w, target, block, namedInputArg("PORT"))
-
-	case "flippermove_move":
-		renderAction(w, target, block, namedInputArg("DIRECTION"), fieldInputArg("UNIT", "VALUE"))
-	case "flippermove_movementSpeed":
-		renderAction(w, target, block, namedInputArg("SPEED"))
-	case "flippermove_setDistance":
-		renderAction(w, target, block, namedInputArg("DISTANCE"), namedFieldArg("UNIT"))
-	case "flippermove_setMovementPair":
-		renderAction(w, target, block, namedInputArg("PAIR"))
-	case "flippermove_startSteer":
-		renderAction(w, target, block, namedInputArg("STEERING"))
-	case "flippermove_steer":
-		renderAction(w, target, block, namedInputArg("STEERING"), fieldInputArg("UNIT", "VALUE"))
-
-	case "flipperoperator_isInBetween":
-		renderBetween(w, target, block)
-
-	case "flippersensors_buttonIsPressed":
-		renderAction(w, target, block, namedFieldArg("BUTTON"), namedFieldArg("EVENT"))
-	case "flippersensors_color":
-		renderAction(w, target, block, namedInputArg("PORT"))
-	case "flippersensors_distance":
-		renderAction(w, target, block, namedInputArg("PORT"), namedFieldArg("UNIT"))
-	case "flippersensors_isColor":
-		renderAction(w, target, block, namedInputArg("PORT"), namedInputArg("VALUE"))
-	case "flippersensors_isDistance":
-		renderIsDistance(w, target, block)
-	case "flippersensors_ismotion":
-		renderAction(w, target, block, namedFieldArg("MOTION"))
-	case "flippersensors_isorientation":
-		renderAction(w, target, block, namedFieldArg("ORIENTATION"))
-	case "flippersensors_isReflectivity":
-		renderIsReflectivity(w, target, block)
-	case "flippersensors_reflectivity":
-		renderAction(w, target, block, namedInputArg("PORT"))
-	case "flippersensors_orientationAxis":
-		renderAction(w, target, block, fieldArg("AXIS"))
-
-	case "flippersound_beep":
-		renderAction(w, target, block, namedInputArg("NOTE"))
-	case "flippersound_beepForTime":
-		renderAction(w, target, block, namedInputArg("DURATION"), namedInputArg("NOTE"))
-	case "flippersound_playSound":
-		renderAction(w, target, block, namedInputArg("SOUND"))
-	case "flippersound_playSoundUntilDone":
-		renderAction(w, target, block, namedInputArg("SOUND"))
-	case "sound_setvolumeto":
-		renderAction(w, target, block, namedInputArg("VOLUME"))
-
-	case "operator_add":
-		renderBinaryOperator(w, target, block, "+", "NUM1", "NUM2")
-	case "operator_and":
-		renderBinaryOperator(w, target, block, "AND", "OPERAND1", "OPERAND2")
-	case "operator_contains":
-		renderAction(w, target, block, namedInputArg("STRING1"), namedInputArg("STRING2"))
-	case "operator_divide":
-		renderBinaryOperator(w, target, block, "/", "NUM1", "NUM2")
-	case "operator_equals":
-		renderBinaryOperator(w, target, block, "==", "OPERAND1", "OPERAND2")
-	case "operator_gt":
-		renderBinaryOperator(w, target, block, ">", "OPERAND1", "OPERAND2")
-	case "operator_join":
-		renderAction(w, target, block, inputArg("STRING1"), inputArg("STRING2"))
-	case "operator_length":
-		renderAction(w, target, block, namedInputArg("STRING"))
-	case "operator_letter_of":
-		renderAction(w, target, block, inputArg("STRING"), inputArg("LETTER"))
-	case "operator_lt":
-		renderBinaryOperator(w, target, block, "<", "OPERAND1", "OPERAND2")
-	case "operator_mathop":
-		renderMathOp(w, target, block)
-	case "operator_mod":
-		renderBinaryOperator(w, target, block, "mod", "NUM1", "NUM2")
-	case "operator_multiply":
-		renderBinaryOperator(w, target, block, "*", "NUM1", "NUM2")
-	case "operator_not":
-		renderUnaryOperator(w, target, block, "NOT", "OPERAND")
-	case "operator_or":
-		renderBinaryOperator(w, target, block, "OR", "OPERAND1", "OPERAND2")
-	case "operator_random":
-		renderAction(w, target, block, namedInputArg("FROM"), namedInputArg("TO"))
-	case "operator_round":
-		renderUnaryOperator(w, target, block, "round", "NUM")
-	case "operator_subtract":
-		renderBinaryOperator(w, target, block, "-", "NUM1", "NUM2")
-
-	case "procedures_call":
-		renderProcedureCall(w, target, block)
-	case "procedures_definition":
-		renderProcedureDefinition(w, target, block)
-		w = indent(w) // TODO - move this to a 'renderX' func.
-	case "procedures_prototype":
-		renderProcedurePrototype(w, target, block)
-
-	case "radiobroadcast_radioSignalReporter":
-		renderAction(w, target, block, namedInputArg("SIGNAL"))
-	case "radiobroadcast_broadcastRadioSignalWithValueCommand":
-		renderAction(w, target, block, namedInputArg("SIGNAL"), namedInputArg("VALUE"))
-	case "radiobroadcast_whenIReceiveRadioSignalHat":
-		renderAction(w, target, block, namedInputArg("SIGNAL"))
-
-	case "sensing_keypressed":
-		renderAction(w, target, block, inputArg("KEY_OPTION"))
-
-	case "sound_changeeffectby":
-		renderAction(w, target, block, namedFieldArg("EFFECT"), namedInputArg("VALUE"))
-	case "sound_changevolumeby":
-		renderAction(w, target, block, namedInputArg("VOLUME"))
-	case "sound_seteffectto":
-		renderAction(w, target, block, namedFieldArg("EFFECT"), namedInputArg("VALUE"))
+	w = visitOneBlock(w, target, block)
+	if block.Next != nil {
+		fmt.Fprintln(w) // TODO - move this to a 'renderX' func.
+		visitBlock(w, target, *block.Next)
+	}
+}
 
+// visitOneBlock renders block and returns the writer to use for the blocks
+// after it, which are indented after a hat block. An entry from the user's
+// catalog files is used instead of the block's renderer.
+func visitOneBlock(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) io.Writer {
+	entry, ok := opcodes.Default().Lookup(block.Opcode)
+	switch {
+	case renderers[block.Opcode] != nil && (!ok || entry.Builtin):
+		renderers[block.Opcode](w, target, block)
+	case ok:
+		renderEntry(w, target, block, entry)
 	default:
 		visitOtherBlock(w, target, block)
 	}
-	if block.Next != nil {
-		fmt.Fprintln(w) // TODO - move this to a 'renderX' func.
-		visitBlock(w, target, *block.Next)
+	if opcodes.IsHat(block) {
+		w = indent(w)
+	}
+	return w
+}
+
+type renderFn func(io.Writer, lmsp.ProjectTarget, *lmsp.ProjectBlockObject)
+
+// renderers draw the blocks that don't look like a function call. Every other
+// block is drawn from its entry in the opcode catalog. The renderers visit
+// other blocks, so the map is filled in by init.
+var renderers map[lmsp.ProjectOpcode]renderFn
+
+func init() {
+	renderers = map[lmsp.ProjectOpcode]renderFn{
+		"flipperdisplay_custom-matrix":         renderMatrix,
+		"flipperdisplay_custom-animate-matrix": renderAnimation,
+
+		"flipperlight_matrix-5x5-brightness-image": renderMatrix,
+
+		"control_forever":      renderForever,
+		"control_if":           renderControl,
+		"control_if_else":      renderIfElse,
+		"control_repeat":       renderControlRepeat,
+		"control_repeat_until": renderControl,
+		"control_wait_until":   renderWaitUntil,
+
+		"data_changevariableby": renderChangeVariableBy,
+		"data_setvariableto":    renderSetVariableTo,
+
+		"event_whenbroadcastreceived": renderWhenBroadcastReceived,
+		"event_whenkeypressed":        renderWhenKeyPressed,
+
+		"flipperevents_whenButton":        renderWhenButton,
+		"flipperevents_whenColor":         renderWhenColor,
+		"flipperevents_whenCondition":     renderWhenCondition,
+		"flipperevents_whenDistance":      renderWhenDistance,
+		"flipperevents_whenGesture":       renderWhenGesture,
+		"flipperevents_whenOrientation":   renderWhenOrientation,
+		"flipperevents_whenPressed":       renderWhenPressed,
+		"flipperevents_whenProgramStarts": renderWhenProgramStarts,
+		"flipperevents_whenTimer":         renderWhenTimer,
+
+		"flipperoperator_isInBetween":   renderBetween,
+		"flippersensors_isDistance":     renderIsDistance,
+		"flippersensors_isReflectivity": renderIsReflectivity,
+
+		"operator_add":      renderBinaryOperator,
+		"operator_and":      renderBinaryOperator,
+		"operator_divide":   renderBinaryOperator,
+		"operator_equals":   renderBinaryOperator,
+		"operator_gt":       renderBinaryOperator,
+		"operator_lt":       renderBinaryOperator,
+		"operator_mathop":   renderMathOp,
+		"operator_mod":      renderBinaryOperator,
+		"operator_multiply": renderBinaryOperator,
+		"operator_or":       renderBinaryOperator,
+		"operator_subtract": renderBinaryOperator,
+
+		"procedures_call":       renderProcedureCall,
+		"procedures_definition": renderProcedureDefinition,
+		"procedures_prototype":  renderProcedurePrototype,
 	}
 }
 
+// Handled returns true if blocks with the opcode are drawn from the opcode
+// catalog or by a renderer of their own. Other blocks are drawn with their
+// inputs and fields in alphabetical order.
+func Handled(opcode lmsp.ProjectOpcode) bool {
+	_, ok := opcodes.Default().Lookup(opcode)
+	return ok || renderers[opcode] != nil
+}
+
+// visitOtherBlock renders a block that isn't in the opcode catalog, with its
+// inputs and fields in alphabetical order. With $SUGGEST set, it also prints a
+// catalog entry for the block, to fill in and add to a catalog file.
 func visitOtherBlock(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
-	type sortableArg struct {
-		name string
-		a    argFn
-		code string
+	entry := opcodes.Entry{Opcode: block.Opcode, Name: string(block.Opcode), Shape: opcodes.Stack}
+	switch {
+	case opcodes.IsHat(block):
+		entry.Shape = opcodes.Hat
+	case block.Shadow:
+		entry.Shape = opcodes.Reporter
 	}
-	argSorter := make([]sortableArg, 0, len(block.Inputs)+len(block.Fields))
 	for input := range block.Inputs {
-		argSorter = append(argSorter, sortableArg{string(input), namedInputArg(input), fmt.Sprintf("namedInputArg(%q)", input)})
+		entry.Args = append(entry.Args, opcodes.Arg{Kind: opcodes.InputArg, Input: input, Label: strings.ToLower(string(input))})
 	}
 	for field := range block.Fields {
-		argSorter = append(argSorter, sortableArg{string(field), namedFieldArg(field), fmt.Sprintf("namedFieldArg(%q)", field)})
+		entry.Args = append(entry.Args, opcodes.Arg{Kind: opcodes.FieldArg, Field: field, Label: strings.ToLower(string(field))})
 	}
-	sort.Slice(argSorter, func(i, j int) bool { return argSorter[i].name < argSorter[j].name })
-	args := make([]argFn, 0, len(argSorter))
-	argCode := make([]string, 0, len(argSorter))
-	for _, sa := range argSorter {
-		args = append(args, sa.a)
-		argCode = append(argCode, sa.code)
+	sort.Slice(entry.Args, func(i, j int) bool { return argName(entry.Args[i]) < argName(entry.Args[j]) })
+	if suggestionsEnabled {
+		if data, err := json.Marshal(map[lmsp.ProjectOpcode]opcodes.Entry{block.Opcode: entry}); err == nil {
+			suggestf("%s\n", data)
+		}
+	}
+	renderEntry(w, target, block, entry)
+}
+
+func argName(a opcodes.Arg) string {
+	if a.Kind == opcodes.FieldArg {
+		return string(a.Field)
+	}
+	return string(a.Input)
+}
+
+// renderNonObject renders a block that's missing, or that isn't a block
+// object. Blocks that couldn't be decoded end up here.
+func renderNonObject(w io.Writer, target lmsp.ProjectTarget, id lmsp.ProjectBlockID) {
+	if block := target.Blocks[id]; block != nil {
+		fmt.Fprint(w, block.Description())
+	} else {
+		fmt.Fprintf(w, "[missing block %q]", id)
 	}
-	suggestf("  case %q:\n    renderAction(w, target, block, %s)\n",
-		block.Opcode,
-		strings.Join(argCode, ", "))
-	renderAction(w, target, block, args...)
 }
 
 func renderComment(w io.Writer, target lmsp.ProjectTarget, id lmsp.ProjectCommentID) {
@@ -404,202 +270,116 @@ func renderComment(w io.Writer, target lmsp.ProjectTarget, id lmsp.ProjectCommen
 }
 
 func renderProcedureCall(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
-	fmt.Fprintf(w, "%s %s(", block.Mutation.ProcCode, block.Mutation.ArgumentIDs)
-	inputs := block.Inputs
-	first := true
-	for id := range inputs {
-		if !first {
+	if block.Mutation == nil {
+		renderMissingMutation(w, block)
+		return
+	}
+	fmt.Fprintf(w, "%s(", block.Mutation.ProcCode)
+	for i, id := range procedureArgumentIDs(block) {
+		if i > 0 {
 			fmt.Fprint(w, ", ")
 		}
-		first = false
-		fmt.Fprintf(w, "%s: ", id)
+		fmt.Fprintf(w, "%s: ", procedureArgumentName(target, block, id))
 		visitInput(w, target, block, id)
 	}
 	fmt.Fprintf(w, ")")
 }
 
+// procedureArgumentIDs returns the IDs of a procedure call's inputs, in the
+// order that they appear in the custom block.
+func procedureArgumentIDs(block *lmsp.ProjectBlockObject) []lmsp.ProjectInputID {
+	ids := block.Mutation.ArgumentIDList()
+	seen := make(map[lmsp.ProjectInputID]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	var extra []lmsp.ProjectInputID
+	for id := range block.Inputs {
+		if !seen[id] {
+			extra = append(extra, id)
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i] < extra[j] })
+	return append(ids, extra...)
+}
+
+// procedureArgumentName finds the name of a procedure call's argument in the
+// custom block's definition. Argument IDs are random, so the ID is only used
+// when the definition can't be found.
+func procedureArgumentName(target lmsp.ProjectTarget, call *lmsp.ProjectBlockObject, id lmsp.ProjectInputID) string {
+	for _, b := range target.Blocks {
+		proto, ok := b.(*lmsp.ProjectBlockObject)
+		if !ok || proto.Opcode != "procedures_prototype" || proto.Mutation == nil || proto.Mutation.ProcCode != call.Mutation.ProcCode {
+			continue
+		}
+		names := proto.Mutation.ArgumentNameList()
+		for i, protoID := range proto.Mutation.ArgumentIDList() {
+			if protoID == id && i < len(names) {
+				return names[i]
+			}
+		}
+	}
+	return string(id)
+}
+
 func renderProcedureDefinition(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
 	fmt.Fprint(w, "def ")
 	visitInput(w, target, block, "custom_block")
 }
 
 func renderProcedurePrototype(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
+	if block.Mutation == nil {
+		renderMissingMutation(w, block)
+		return
+	}
 	fmt.Fprintf(w, "%s %s", block.Mutation.ProcCode, block.Mutation.ArgumentNames)
 	// Inputs is redundant with argument names.
 }
 
-// This goes with the visit* funcs.
-type argFn func(io.Writer, lmsp.ProjectTarget, *lmsp.ProjectBlockObject)
-
-// This goes with the render* funcs.
-var opcodeActions = map[lmsp.ProjectOpcode]string{
-	"event_broadcast":        "broadcast",
-	"event_broadcastandwait": "broadcastAndWait",
-
-	"flippercontrol_stop":            "stop",
-	"flippercontrol_stopOtherStacks": "stopOtherStacks",
-
-	"flipperdisplay_centerButtonLight":     "setCenterButtonLight",
-	"flipperdisplay_displayOff":            "turnOffPixels",
-	"flipperdisplay_ledAnimation":          "startAnimation",
-	"flipperdisplay_ledAnimationUntilDone": "playAnimationUntilDone",
-	"flipperdisplay_ledImage":              "turnOnPixels",
-	"flipperdisplay_ledImageFor":           "turnOnPixels",
-	"flipperdisplay_ledOn":                 "setPixel",
-	"flipperdisplay_ledRotateDirection":    "rotateDisplay",
-	"flipperdisplay_ledRotateOrientation":  "setDisplayRotation",
-	"flipperdisplay_ledSetBrightness":      "setPixelBrightness",
-	"flipperdisplay_ledText":               "write",
-	"flipperdisplay_ultrasonicLightUp":     "lightUpUltrasonicSensor",
-
-	"flippermoremotor_motorDidMovement":          "wasMotorInterrupted",
-	"flippermoremotor_motorGoToRelativePosition": "goToRelativePosition",
-	"flippermoremotor_motorSetAcceleration":      "setAcceleration",
-	"flippermoremotor_motorSetDegreeCounted":     "setRelativePosition",
-	"flippermoremotor_motorSetStallDetection":    "setStallDetection",
-	"flippermoremotor_motorSetStopMethod":        "setStopMethod",
-	"flippermoremotor_motorStartPower":           "startMotor",
-	"flippermoremotor_motorStartSpeed":           "startMotor",
-	"flippermoremotor_motorTurnForSpeed":         "runMotor",
-	"flippermoremotor_position":                  "relativePosition",
-	"flippermoremotor_power":                     "motorPower",
-
-	"flippermoremove_moveDidMovement":         "wasMovementInterrupted",
-	"flippermoremove_moveDistanceAtSpeed":     "moveAtSpeed",
-	"flippermoremove_movementSetAcceleration": "setMovementAcceleration",
-	"flippermoremove_movementSetStopMethod":   "setMovementStopMethod",
-	"flippermoremove_startDualPower":          "startMovingAtPower",
-	"flippermoremove_startDualSpeed":          "startMovingAtSpeed",
-	"flippermoremove_startSteerAtSpeed":       "startMovingAtSpeed",
-	"flippermoremove_steerDistanceAtSpeed":    "move",
-
-	"flippermoresensors_acceleration":    "acceleration",
-	"flippermoresensors_angularVelocity": "angularVelocity",
-	"flippermoresensors_force":           "pressure",
-	"flippermoresensors_isPressed":       "isPressed",
-	"flippermoresensors_rawColor":        "rawColor",
-
-	"flippermotor_absolutePosition":           "position",
-	"flippermotor_motorGoDirectionToPosition": "goToPosition",
-	"flippermotor_motorSetSpeed":              "setMotorSpeed",
-	"flippermotor_motorStartDirection":        "motorStart",
-	"flippermotor_motorStop":                  "stopMotor",
-	"flippermotor_motorTurnForDirection":      "run",
-	"flippermotor_speed":                      "motorSpeed",
-
-	"flippermove_move":            "move",
-	"flippermove_movementSpeed":   "setMovementSpeed",
-	"flippermove_setDistance":     "setOneMotorRotationDistance",
-	"flippermove_setMovementPair": "setMovementMotors",
-	"flippermove_startSteer":      "startMoving",
-	"flippermove_steer":           "move",
-	"flippermove_stopMove":        "stopMoving",
-
-	"flippersensors_buttonIsPressed": "isButtonPressed",
-	"flippersensors_color":           "color",
-	"flippersensors_distance":        "distance",
-	"flippersensors_isColor":         "isColor",
-	"flippersensors_ismotion":        "isGesture",
-	"flippersensors_isorientation":   "isUp",
-	"flippersensors_motion":          "gesture",
-	"flippersensors_orientation":     "orientation",
-	"flippersensors_orientationAxis": "angle",
-	"flippersensors_reflectivity":    "reflectedLight",
-	"flippersensors_resetTimer":      "resetTimer",
-	"flippersensors_resetYaw":        "resetYaw",
-	"flippersensors_timer":           "timer",
-
-	"flippersound_beep":      "beep",
-	"flippersound_playSound": "playSound",
-	"flippersound_stopSound": "stopSound",
-}
-
-// renderAction visits a block that is like a function call. These may be script
-// blocks, input blocks, or boolean blocks.
-func renderAction(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, args ...argFn) {
-	label, ok := opcodeActions[block.Opcode]
-	if !ok {
-		suggestf("  %q: \"todo--%s\",\n", block.Opcode, block.Opcode)
-		label = string(block.Opcode)
+// renderMissingMutation draws a custom block that doesn't say which custom
+// block it is.
+func renderMissingMutation(w io.Writer, block *lmsp.ProjectBlockObject) {
+	fmt.Fprintf(w, "%s [missing mutation]", block.Opcode)
+}
+
+// renderEntry draws a block like a function call, with its name and its
+// arguments from the opcode catalog. A block without a name, like a menu, is
+// just its arguments.
+func renderEntry(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, entry opcodes.Entry) {
+	if entry.Name != "" {
+		fmt.Fprintf(w, "%s(", entry.Name)
 	}
-	fmt.Fprintf(w, "%s(", label)
-	for i, a := range args {
+	for i, a := range entry.Args {
 		if i > 0 {
 			fmt.Fprint(w, ", ")
 		}
-		a(w, target, block)
+		renderArg(w, target, block, a)
 	}
-	fmt.Fprint(w, ")")
-}
-
-// This goes with the render* funcs.
-func fieldArg(fieldName lmsp.ProjectFieldName) argFn {
-	return func(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
-		fmt.Fprint(w, getField(block, fieldName))
+	if entry.Name != "" {
+		fmt.Fprint(w, ")")
 	}
 }
 
-// This goes with the render* funcs.
-func namedFieldArg(fieldName lmsp.ProjectFieldName) argFn {
-	label := strings.ToLower(string(fieldName))
-	return func(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
-		value := getField(block, fieldName)
-		if block.Opcode == "flippermoremove_movementSetStopMethod" && fieldName == "STOP" {
-			switch value {
-			case "1":
-				value = "brake"
-			case "2":
-				value = "hold position"
-			case "3":
-				value = "coast"
-			}
+// renderArg draws one argument of a block, with its label.
+func renderArg(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, arg opcodes.Arg) {
+	switch arg.Kind {
+	case opcodes.FieldInputArg:
+		fmt.Fprintf(w, "%s: ", getField(block, arg.Field))
+		visitInput(w, target, block, arg.Input)
+	case opcodes.FieldArg:
+		value := getField(block, arg.Field)
+		if shown, ok := arg.Values[value]; ok {
+			value = shown
 		}
-		fmt.Fprintf(w, "%s: %v", label, value)
-	}
-}
-
-// This goes with the render* funcs.
-func inputArg(inputName lmsp.ProjectInputID) argFn {
-	return func(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
-		visitInput(w, target, block, inputName)
-	}
-}
-
-// This goes with the render* funcs.
-var inputLabelOverrides = map[lmsp.ProjectOpcode]map[lmsp.ProjectInputID]string{
-	"flipperdisplay_ledImageFor": {
-		"VALUE": "seconds",
-	},
-	"flippermove_movementSpeed": {
-		"SPEED": "percent",
-	},
-}
-
-// This goes with the render* funcs.
-func namedInputArg(inputName lmsp.ProjectInputID) argFn {
-	return func(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
-		label := inputLabel(block.Opcode, inputName)
-		fmt.Fprintf(w, "%s: ", label)
-		visitInput(w, target, block, inputName)
-	}
-}
-
-// This goes with the render* funcs.
-func inputLabel(opcode lmsp.ProjectOpcode, input lmsp.ProjectInputID) string {
-	opcodeOverrides := inputLabelOverrides[opcode]
-	if opcodeOverrides != nil {
-		if label, ok := opcodeOverrides[input]; ok {
-			return label
+		if arg.Label != "" {
+			fmt.Fprintf(w, "%s: ", arg.Label)
 		}
-	}
-	return strings.ToLower(string(input))
-}
-
-// This goes with the render* funcs.
-func fieldInputArg(fieldName lmsp.ProjectFieldName, inputName lmsp.ProjectInputID) argFn {
-	return func(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
-		fmt.Fprintf(w, "%s: ", getField(block, fieldName))
-		visitInput(w, target, block, inputName)
+		fmt.Fprint(w, value)
+	default:
+		if arg.Label != "" {
+			fmt.Fprintf(w, "%s: ", arg.Label)
+		}
+		visitInput(w, target, block, arg.Input)
 	}
 }
 
@@ -661,61 +441,6 @@ func renderWhenPressed(w io.Writer, target lmsp.ProjectTarget, block *lmsp.Proje
 	fmt.Fprintf(w, "] when %s:", getField(block, "OPTION"))
 }
 
-func renderFieldSelector(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, field lmsp.ProjectFieldName) {
-	fmt.Fprint(w, getField(block, field))
-}
-
-var menus = map[lmsp.ProjectOpcode]map[string]string{
-
-	"flipperdisplay_menu_ledMatrixIndex": {
-		"1": "1",
-		"2": "2",
-		"3": "3",
-		"4": "4",
-		"5": "5",
-	},
-	"flipperdisplay_menu_orientation": {
-		"1": "upright",
-		"2": "left",
-		"3": "right",
-		"4": "upside down",
-	},
-	"flippermoremotor_menu_acceleration": {
-		"-1 -1":     "default",
-		"100 100":   "fast",
-		"350 350":   "balanced",
-		"800 800":   "smooth",
-		"1200 1200": "slow",
-		"2000 2000": "very slow",
-	},
-	"flippermoremove_menu_acceleration": {
-		"-1 -1":     "default",
-		"100 100":   "fast",
-		"350 350":   "balanced",
-		"800 800":   "smooth",
-		"1200 1200": "slow",
-		"2000 2000": "very slow",
-	},
-}
-
-func renderMenu(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, field lmsp.ProjectFieldName) {
-	value := getField(block, field)
-
-	menu, ok := menus[block.Opcode]
-	if !ok {
-		fmt.Fprintf(w, "[unknown menu type %s %q]", block.Opcode, value)
-		return
-	}
-
-	menuValue, ok := menu[value]
-	if !ok {
-		fmt.Fprintf(w, "[%s: %q]", block.Opcode, value)
-		return
-	}
-
-	fmt.Fprint(w, menuValue)
-}
-
 func renderBetween(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
 	fmt.Fprint(w, "(")
 	visitInput(w, target, block, "VALUE")
@@ -754,15 +479,17 @@ func renderControlRepeat(w io.Writer, target lmsp.ProjectTarget, block *lmsp.Pro
 	visitInput(indentStartingNow(w), target, block, "SUBSTACK")
 }
 
-func renderControl(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, keyword string) {
-	fmt.Fprintf(w, "%s ", keyword)
+// renderControl draws a C block with a condition, like "if" or "until". The
+// keyword is the block's name in the opcode catalog.
+func renderControl(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
+	fmt.Fprintf(w, "%s ", catalogEntry(block).Name)
 	visitInput(w, target, block, "CONDITION")
 	fmt.Fprintln(w, ":")
 	visitInput(indentStartingNow(w), target, block, "SUBSTACK")
 }
 
 func renderIfElse(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
-	renderControl(w, target, block, "if")
+	renderControl(w, target, block)
 	fmt.Fprintln(w, "\nelse:")
 	visitInput(indentStartingNow(w), target, block, "SUBSTACK2")
 }
@@ -773,12 +500,6 @@ func renderWaitUntil(w io.Writer, target lmsp.ProjectTarget, block *lmsp.Project
 	fmt.Fprint(w)
 }
 
-func renderWait(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
-	fmt.Fprint(w, "wait(duration: ")
-	visitInput(w, target, block, "DURATION")
-	fmt.Fprint(w, ")")
-}
-
 func renderChangeVariableBy(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
 	f := getField(block, "VARIABLE")
 	fmt.Fprintf(w, "[variable %s] = [variable %s] + ", f, f)
@@ -792,20 +513,24 @@ func renderSetVariableTo(w io.Writer, target lmsp.ProjectTarget, block *lmsp.Pro
 	fmt.Fprint(w)
 }
 
-// TODO - make 'op' a lookup
-func renderBinaryOperator(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, op string, arg1, arg2 lmsp.ProjectInputID) {
+// renderBinaryOperator draws an operator between its two arguments, like
+// "(a + b)". The operator is the block's name in the opcode catalog.
+func renderBinaryOperator(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
+	entry := catalogEntry(block)
+	if len(entry.Args) != 2 {
+		renderEntry(w, target, block, entry)
+		return
+	}
 	fmt.Fprint(w, "(")
-	visitInput(w, target, block, arg1)
-	fmt.Fprintf(w, " %s ", op)
-	visitInput(w, target, block, arg2)
+	renderArg(w, target, block, unlabeled(entry.Args[0]))
+	fmt.Fprintf(w, " %s ", entry.Name)
+	renderArg(w, target, block, unlabeled(entry.Args[1]))
 	fmt.Fprint(w, ")")
 }
 
-// TODO - make 'op' a lookup
-func renderUnaryOperator(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, op string, arg lmsp.ProjectInputID) {
-	fmt.Fprintf(w, "%s(", op)
-	visitInput(w, target, block, arg)
-	fmt.Fprint(w, ")")
+func unlabeled(a opcodes.Arg) opcodes.Arg {
+	a.Label = ""
+	return a
 }
 
 func renderMathOp(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
@@ -815,42 +540,39 @@ func renderMathOp(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlo
 }
 
 func visitInput(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject, inputName lmsp.ProjectInputID) {
-	blockInput, ok := block.Inputs[inputName]
+	input, ok := block.Inputs[inputName]
 	if !ok {
 		fmt.Fprintf(w, "[missing input: %q]", inputName) // TODO - move to a render func
 		return
 	}
 
-	if blockInput == nil {
+	if input == nil {
 		fmt.Fprint(w, "[nil]") // TODO - move to a render func
 		return
 	}
 
-	input := blockInput.([]interface{})
-
-	// Input is [shadow, val, opt-val]
-	// var shadowStrs = []string{"(unused)", "shadow", "no shadow", "shadow obscured"}
-	// opt-val only shows up when shadow is 3 (shadow obscured).
-	switch val := input[1].(type) {
-	case string:
-		visitBlock(w, target, lmsp.ProjectBlockID(val))
-	case []interface{}:
-		id := int(val[0].(float64))
-		v := val[1].(string)
-		switch id {
-		case 4, 5, 6, 7, 8, 9:
+	// An obscured shadow is hidden behind the block, so it isn't rendered.
+	switch {
+	case input.Value.Block != nil:
+		visitBlock(w, target, *input.Value.Block)
+	case input.Value.Primitive != nil:
+		val := input.Value.Primitive
+		v := val.Value
+		switch val.Kind {
+		case lmsp.PrimitiveNumber, lmsp.PrimitivePositiveNumber, lmsp.PrimitivePositiveInteger,
+			lmsp.PrimitiveInteger, lmsp.PrimitiveAngle, lmsp.PrimitiveColor:
 			if v == "" {
 				fmt.Fprint(w, "[unset number]") // TODO - move this to a render* func
 			} else {
 				fmt.Fprint(w, v) // TODO - move this to a render* func
 			}
-		case 10:
+		case lmsp.PrimitiveString:
 			fmt.Fprintf(w, "%q", v) // TODO - move this to a render* func
-		case 11:
+		case lmsp.PrimitiveBroadcast:
 			fmt.Fprintf(w, "[broadcast %q]", v) // TODO - move this to a render* func
-		case 12:
+		case lmsp.PrimitiveVariable:
 			fmt.Fprintf(w, "[variable %s]", v) // TODO - move this to a render* func
-		case 13:
+		case lmsp.PrimitiveList:
 			fmt.Fprintf(w, "[list %q]", v) // TODO - move this to a render* func
 		default:
 			fmt.Fprintf(w, "???%#v???", val) // TODO - move this to a render* func
@@ -858,11 +580,15 @@ func visitInput(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlock
 	}
 }
 
+// This goes with the visit* funcs.
+func catalogEntry(block *lmsp.ProjectBlockObject) opcodes.Entry {
+	entry, _ := opcodes.Default().Lookup(block.Opcode)
+	return entry
+}
+
 // This goes with the visit* funcs.
 func getField(block *lmsp.ProjectBlockObject, name lmsp.ProjectFieldName) string {
-	field := block.Fields[name].([]interface{})
-	// field[0] could be a string, float64, maybe others?
-	return fmt.Sprint(field[0])
+	return block.FieldValue(name)
 }
 
 var suggestionsEnabled = os.Getenv("SUGGEST") != ""
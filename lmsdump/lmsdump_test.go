@@ -2,13 +2,16 @@ package lmsdump
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/spraints/mind-meld/lmsp"
 	"github.com/spraints/mind-meld/lmsp/lmspsimple"
+	"github.com/spraints/mind-meld/opcodes"
 )
 
 func TestSample(t *testing.T) {
@@ -19,6 +22,220 @@ func TestSample(t *testing.T) {
 	require.NoError(t, err)
 
 	var buf bytes.Buffer
-	assert.NoError(t, Dump(&buf, f.Project))
+	assert.NoError(t, Options{Manifest: f.Manifest}.Dump(&buf, f.Project))
 	assert.Equal(t, string(expected), buf.String())
 }
+
+func TestOmitBlockIDs(t *testing.T) {
+	f, err := lmspsimple.Read("testdata/project.lms")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Options{OmitBlockIDs: true}.Dump(&buf, f.Project))
+	for id := range f.Project.Targets[1].Blocks {
+		assert.NotContains(t, buf.String(), string(id))
+	}
+}
+
+func TestSpike3(t *testing.T) {
+	f, err := lmspsimple.Read("../lmsp/testdata/hello.llsp3")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Options{OmitBlockIDs: true}.Dump(&buf, f.Project))
+	assert.Equal(t, `extensions: flipperevents, flipperlight
+scratch: 3.0.0 (vm 0.2.0)
+target: Stage
+target: SBr3xq7tNnfqpVnH9Pju
+  -----
+  when program starts:
+    write(text: "Hello")
+    turnOnPixels(matrix: [
+      .9.9.
+      99999
+      99999
+      .999.
+      ..9..
+    ], seconds: 2)
+    turnOffPixels()
+`, buf.String())
+}
+
+const procedureProject = `{"targets": [{"isStage": false, "name": "sprite", "blocks": {
+  "def": {"opcode": "procedures_definition", "next": null, "parent": null, "inputs": {"custom_block": [1, "proto"]}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 400},
+  "proto": {"opcode": "procedures_prototype", "next": null, "parent": "def", "inputs": {}, "fields": {}, "shadow": true, "topLevel": false, "mutation": {"tagName": "mutation", "children": [], "proccode": "drive %s %s", "argumentids": "[\"z;id\",\"a;id\"]", "argumentnames": "[\"speed\",\"distance\"]", "argumentdefaults": "[\"\",\"\"]", "warp": "false"}},
+  "hat": {"opcode": "flipperevents_whenProgramStarts", "next": "call", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+  "call": {"opcode": "procedures_call", "next": null, "parent": "hat", "inputs": {"a;id": [1, [10, "20"]], "z;id": [1, [10, "50"]]}, "fields": {}, "shadow": false, "topLevel": false, "mutation": {"tagName": "mutation", "children": [], "proccode": "drive %s %s", "argumentids": "[\"z;id\",\"a;id\"]", "warp": "false"}}
+}}]}`
+
+func TestProcedureCall(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(procedureProject), &proj))
+
+	var buf bytes.Buffer
+	assert.NoError(t, Options{OmitBlockIDs: true}.Dump(&buf, proj))
+	assert.Equal(t, `target: sprite
+  -----
+  when program starts:
+    drive %s %s(speed: "50", distance: "20")
+  -----
+  def drive %s %s ["speed","distance"]
+`, buf.String())
+}
+
+func TestProcedureCallWithoutMutation(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(`{"targets": [{"isStage": false, "name": "sprite", "blocks": {
+	  "call": {"opcode": "procedures_call", "next": null, "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0}
+	}}]}`), &proj))
+
+	var buf bytes.Buffer
+	Block(&buf, proj.Targets[0], "call")
+	assert.Equal(t, "procedures_call [missing mutation]", buf.String())
+}
+
+const declarationsProject = `{"targets": [
+  {"isStage": true, "name": "Stage", "variables": {"v2": ["speed", 50]}, "lists": {}, "broadcasts": {"b2": "stop", "b1": "go"}, "blocks": {}, "costumes": [{"name": "backdrop1", "dataFormat": "svg"}], "sounds": []},
+  {"isStage": false, "name": "sprite", "variables": {"v1": ["count", "0"]}, "lists": {"l1": ["steps", [1, "two"]]}, "blocks": {}, "costumes": [], "sounds": [{"name": "Beep", "dataFormat": "wav"}]}
+],
+"monitors": [
+  {"id": "v2", "mode": "large", "opcode": "data_variable", "params": {"VARIABLE": "speed"}, "spriteName": null, "value": 50, "visible": true},
+  {"id": "l1", "mode": "list", "opcode": "data_listcontents", "params": {"LIST": "steps"}, "spriteName": "sprite", "value": [], "visible": false}
+],
+"extensions": ["flippermotor", "flipperevents"],
+"meta": {"semver": "3.0.0", "vm": "1.2.3", "agent": "changes every time"}}`
+
+func TestDeclarations(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(declarationsProject), &proj))
+
+	man := &lmsp.Manifest{
+		Type: "word-blocks",
+		Name: "My Robot",
+		Hardware: map[string]lmsp.ManifestHardware{
+			"b": {Type: "flipper", Name: "Robot"},
+			"a": {Type: "flipper"},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Options{Manifest: man}.Dump(&buf, proj))
+	assert.Equal(t, `program: My Robot
+type: word-blocks
+hub: flipper
+hub: flipper "Robot"
+extensions: flipperevents, flippermotor
+scratch: 3.0.0 (vm 1.2.3)
+target: Stage
+  broadcast "go"
+  broadcast "stop"
+  variable speed = 50
+  monitor data_variable(variable: speed) large
+  costume "backdrop1" svg
+target: sprite
+  list steps = [1,"two"]
+  variable count = "0"
+  monitor data_listcontents(list: steps) list hidden
+  sound "Beep" wav
+`, buf.String())
+}
+
+const matrixProject = `{"targets": [{"isStage": false, "name": "sprite", "blocks": {
+  "hat": {"opcode": "flipperevents_whenProgramStarts", "next": "image", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+  "image": {"opcode": "flipperdisplay_ledImage", "next": "anim", "parent": "hat", "inputs": {"MATRIX": [1, "matrix"]}, "fields": {}, "shadow": false, "topLevel": false},
+  "matrix": {"opcode": "flipperdisplay_custom-matrix", "next": null, "parent": "image", "inputs": {}, "fields": {"field_flipperdisplay_custom-matrix": ["9909999099000009000905550", null]}, "shadow": true, "topLevel": false},
+  "anim": {"opcode": "flipperdisplay_ledAnimation", "next": "bad", "parent": "image", "inputs": {"MATRIX": [1, "frames"]}, "fields": {}, "shadow": false, "topLevel": false},
+  "frames": {"opcode": "flipperdisplay_custom-animate-matrix", "next": null, "parent": "anim", "inputs": {}, "fields": {"field_flipperdisplay_custom-animate-matrix": ["{\"transition\":2,\"frames\":[{\"pixels\":[1,0,0,0,0,0,1,0,0,0,0,0,1,0,0,0,0,0,1,0,0,0,0,0,1]},{\"pixels\":[0,0,0,0,0,0,0,0,0,0,0.5,0.5,0.5,0.5,0.5,0,0,0,0,0,0,0,0,0,0]}],\"loop\":true,\"fps\":4,\"animationName\":\"Wave\"}", null]}, "shadow": true, "topLevel": false},
+  "bad": {"opcode": "flipperdisplay_ledImage", "next": null, "parent": "anim", "inputs": {"MATRIX": [1, "badmatrix"]}, "fields": {}, "shadow": false, "topLevel": false},
+  "badmatrix": {"opcode": "flipperdisplay_custom-matrix", "next": null, "parent": "bad", "inputs": {}, "fields": {"field_flipperdisplay_custom-matrix": ["99", null]}, "shadow": true, "topLevel": false}
+}}]}`
+
+func TestMatrix(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(matrixProject), &proj))
+
+	var buf bytes.Buffer
+	assert.NoError(t, Options{OmitBlockIDs: true}.Dump(&buf, proj))
+	assert.Equal(t, `target: sprite
+  -----
+  when program starts:
+    turnOnPixels(matrix: [
+      99.99
+      99.99
+      .....
+      9...9
+      .555.
+    ])
+    startAnimation(matrix: animation(name: "Wave", fps: 4, loop: true, transition: 2, frames: 2) [
+      9.... .....
+      .9... .....
+      ..9.. 55555
+      ...9. .....
+      ....9 .....
+    ])
+    turnOnPixels(matrix: 99)
+`, buf.String())
+}
+
+const ev3Project = `{"targets": [{"isStage": false, "name": "sprite", "blocks": {
+  "hat": {"opcode": "ev3events_whenProgramStarts", "next": "stop", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+  "stop": {"opcode": "ev3motor_motorStop", "next": null, "parent": "hat", "inputs": {"PORT": [1, [10, "A"]]}, "fields": {"STOP": ["1", null]}, "shadow": false, "topLevel": false}
+}}]}`
+
+func TestCatalog(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(ev3Project), &proj))
+
+	var buf bytes.Buffer
+	assert.NoError(t, Options{OmitBlockIDs: true}.Dump(&buf, proj))
+	assert.Equal(t, `target: sprite
+  -----
+  ev3events_whenProgramStarts()
+    ev3motor_motorStop(port: "A", stop: 1)
+`, buf.String())
+
+	more, err := opcodes.Parse([]byte(`{
+	  "ev3events_whenProgramStarts": {"name": "whenProgramStarts", "shape": "hat", "family": "ev3"},
+	  "ev3motor_motorStop": {"name": "stopMotor", "shape": "stack", "family": "ev3", "args": [
+	    {"kind": "input", "input": "PORT", "label": ""},
+	    {"kind": "field", "field": "STOP", "label": "then", "values": {"1": "brake"}}
+	  ]}
+	}`))
+	require.NoError(t, err)
+	opcodes.SetDefault(opcodes.Builtin().Extend(more))
+	defer opcodes.SetDefault(nil)
+
+	buf.Reset()
+	assert.NoError(t, Options{OmitBlockIDs: true}.Dump(&buf, proj))
+	assert.Equal(t, `target: sprite
+  -----
+  whenProgramStarts()
+    stopMotor("A", then: brake)
+`, buf.String())
+}
+
+func TestCatalogReplacesRenderer(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(`{"targets": [{"isStage": false, "name": "sprite", "blocks": {
+	  "hat": {"opcode": "flipperevents_whenProgramStarts", "next": "loop", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+	  "loop": {"opcode": "control_forever", "next": null, "parent": "hat", "inputs": {"SUBSTACK": [2, "beep"]}, "fields": {}, "shadow": false, "topLevel": false},
+	  "beep": {"opcode": "flippersound_beep", "next": null, "parent": "loop", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false}
+	}}]}`), &proj))
+
+	var buf bytes.Buffer
+	assert.NoError(t, Options{OmitBlockIDs: true}.Dump(&buf, proj))
+	builtin := buf.String()
+	assert.Contains(t, builtin, "forever")
+
+	more, err := opcodes.Parse([]byte(`{
+	  "control_forever": {"name": "loop", "shape": "c", "family": "scratch", "args": [{"kind": "input", "input": "SUBSTACK", "label": "do"}]}
+	}`))
+	require.NoError(t, err)
+	opcodes.SetDefault(opcodes.Builtin().Extend(more))
+	defer opcodes.SetDefault(nil)
+
+	buf.Reset()
+	assert.NoError(t, Options{OmitBlockIDs: true}.Dump(&buf, proj))
+	assert.NotEqual(t, builtin, buf.String())
+	assert.Contains(t, buf.String(), "loop(do: ")
+}
@@ -0,0 +1,125 @@
+package lmsdump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// The hub's light matrix is 5x5, and each pixel's brightness is 0 to 9.
+const matrixSize = 5
+
+// framesPerRow is how many animation frames are drawn side by side.
+const framesPerRow = 8
+
+// renderMatrix draws an image for the light matrix, like "9909999099...", as
+// a grid with one row per line. Dark pixels are dots and lit pixels are their
+// brightness.
+func renderMatrix(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
+	value := getField(block, lmsp.ProjectFieldName("field_"+block.Opcode))
+	levels, ok := imageLevels(value)
+	if !ok {
+		fmt.Fprint(w, value)
+		return
+	}
+	fmt.Fprintln(w, "[")
+	writeFrames(indentStartingNow(w), [][]int{levels})
+	fmt.Fprint(w, "]")
+}
+
+// animation is the JSON in an animation menu. Pixels are 0 to 1.
+type animation struct {
+	Name       string  `json:"animationName"`
+	FPS        float64 `json:"fps"`
+	Loop       bool    `json:"loop"`
+	Transition float64 `json:"transition"`
+	Frames     []struct {
+		Pixels []float64 `json:"pixels"`
+	} `json:"frames"`
+}
+
+// renderAnimation draws each frame of an animation like renderMatrix does,
+// after the animation's settings. Frames are drawn side by side, in rows of
+// framesPerRow.
+func renderAnimation(w io.Writer, target lmsp.ProjectTarget, block *lmsp.ProjectBlockObject) {
+	value := getField(block, lmsp.ProjectFieldName("field_"+block.Opcode))
+	var anim animation
+	if err := json.Unmarshal([]byte(value), &anim); err != nil {
+		fmt.Fprint(w, value)
+		return
+	}
+	var frames [][]int
+	for _, f := range anim.Frames {
+		levels, ok := pixelLevels(f.Pixels)
+		if !ok {
+			fmt.Fprint(w, value)
+			return
+		}
+		frames = append(frames, levels)
+	}
+
+	fmt.Fprintf(w, "animation(name: %q, fps: %v, loop: %v, transition: %v, frames: %d) [\n",
+		anim.Name, anim.FPS, anim.Loop, anim.Transition, len(frames))
+	fw := indentStartingNow(w)
+	for i := 0; i < len(frames); i += framesPerRow {
+		end := i + framesPerRow
+		if end > len(frames) {
+			end = len(frames)
+		}
+		// Label the rows of frames when there's more than one, so they
+		// don't run together.
+		if len(frames) > framesPerRow {
+			fmt.Fprintf(fw, "frames %d-%d:\n", i+1, end)
+		}
+		writeFrames(fw, frames[i:end])
+	}
+	fmt.Fprint(w, "]")
+}
+
+func imageLevels(s string) ([]int, bool) {
+	if len(s) != matrixSize*matrixSize {
+		return nil, false
+	}
+	levels := make([]int, len(s))
+	for i, c := range s {
+		if c < '0' || c > '9' {
+			return nil, false
+		}
+		levels[i] = int(c - '0')
+	}
+	return levels, true
+}
+
+func pixelLevels(pixels []float64) ([]int, bool) {
+	if len(pixels) != matrixSize*matrixSize {
+		return nil, false
+	}
+	levels := make([]int, len(pixels))
+	for i, p := range pixels {
+		levels[i] = int(math.Round(math.Max(0, math.Min(1, p)) * 9))
+	}
+	return levels, true
+}
+
+// writeFrames draws frames side by side.
+func writeFrames(w io.Writer, frames [][]int) {
+	for row := 0; row < matrixSize; row++ {
+		cells := make([]string, len(frames))
+		for i, levels := range frames {
+			var line strings.Builder
+			for _, level := range levels[row*matrixSize : (row+1)*matrixSize] {
+				if level == 0 {
+					line.WriteByte('.')
+				} else {
+					line.WriteByte(byte('0' + level))
+				}
+			}
+			cells[i] = line.String()
+		}
+		fmt.Fprintln(w, strings.Join(cells, " "))
+	}
+}
@@ -0,0 +1,141 @@
+package lmsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DecodeError is a problem in a project.json, along with where it is.
+type DecodeError struct {
+	// Target is the name of the stage or sprite that has the problem.
+	Target string
+	// Block is the ID of the block that has the problem.
+	Block ProjectBlockID
+	// Path is where the problem is in the block's JSON, like
+	// "inputs.PORT[1]".
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	var parts []string
+	if e.Target != "" {
+		parts = append(parts, fmt.Sprintf("target %q", e.Target))
+	}
+	if e.Block != "" {
+		parts = append(parts, fmt.Sprintf("block %q", e.Block))
+	}
+	if e.Path != "" {
+		parts = append(parts, e.Path)
+	}
+	parts = append(parts, e.Err.Error())
+	return strings.Join(parts, ": ")
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// atPath records that err happened at path, which is outside of any path that
+// err already has.
+func atPath(path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var de *DecodeError
+	if errors.As(err, &de) {
+		switch {
+		case de.Path == "":
+			de.Path = path
+		case strings.HasPrefix(de.Path, "["):
+			de.Path = path + de.Path
+		default:
+			de.Path = path + "." + de.Path
+		}
+		return err
+	}
+	return &DecodeError{Path: path, Err: err}
+}
+
+func atIndex(i int, err error) error {
+	return atPath(fmt.Sprintf("[%d]", i), err)
+}
+
+// DecodeOptions controls how DecodeProject handles problems.
+type DecodeOptions struct {
+	// Lenient keeps blocks that can't be decoded as ProjectBlockRaw,
+	// instead of failing.
+	Lenient bool
+}
+
+// DecodeProject decodes a project.json. When opts.Lenient is set, it returns
+// the problems that it worked around instead of failing.
+func DecodeProject(data []byte, opts DecodeOptions) (Project, []*DecodeError, error) {
+	var proj Project
+	if err := json.Unmarshal(data, (*plainProject)(&proj)); err != nil {
+		return proj, nil, err
+	}
+	problems := proj.decodeErrors()
+	if !opts.Lenient && len(problems) > 0 {
+		return proj, nil, problems[0]
+	}
+	return proj, problems, nil
+}
+
+// plainProject is a Project that's decoded without checking for problems.
+type plainProject Project
+
+// UnmarshalJSON decodes a project. It fails if any block can't be decoded.
+// Use DecodeProject to decode leniently.
+func (p *Project) UnmarshalJSON(data []byte) error {
+	proj, _, err := DecodeProject(data, DecodeOptions{})
+	if err != nil {
+		return err
+	}
+	*p = proj
+	return nil
+}
+
+// decodeErrors returns the problems with the blocks that couldn't be decoded,
+// ordered by target and then by block ID.
+func (p Project) decodeErrors() []*DecodeError {
+	var res []*DecodeError
+	for _, target := range p.Targets {
+		var ids []ProjectBlockID
+		for id, block := range target.Blocks {
+			if raw, ok := block.(*ProjectBlockRaw); ok && raw.Err != nil {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			err := target.Blocks[id].(*ProjectBlockRaw).Err
+			err.Target = target.Name
+			res = append(res, err)
+		}
+	}
+	return res
+}
+
+// ProjectBlockRaw is a block that couldn't be decoded. It's only kept when a
+// project is decoded leniently, and it's written back out as-is.
+type ProjectBlockRaw struct {
+	Raw json.RawMessage
+	Err *DecodeError
+}
+
+func (b ProjectBlockRaw) MarshalJSON() ([]byte, error) {
+	return b.Raw, nil
+}
+
+func (b ProjectBlockRaw) Description() string {
+	const max = 60
+	s := string(b.Raw)
+	if len(s) > max {
+		s = s[:max] + "..."
+	}
+	return fmt.Sprintf("[unknown %s]", s)
+}
@@ -0,0 +1,104 @@
+package lmsp
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func projectWithBlocks(blocks string) []byte {
+	return []byte(`{"targets": [
+		{"isStage": true, "name": "Stage", "blocks": {}},
+		{"isStage": false, "name": "robot", "blocks": ` + blocks + `}
+	]}`)
+}
+
+func TestDecodePrimitiveBlocks(t *testing.T) {
+	data := projectWithBlocks(`{
+		"int": [7, 10],
+		"posint": [6, "3"],
+		"num": [4, "1.5"],
+		"var": [12, "count", "v1", 10, 20]
+	}`)
+
+	var proj Project
+	require.NoError(t, json.Unmarshal(data, &proj))
+	blocks := proj.Targets[1].Blocks
+	assert.Equal(t, int64(10), blocks["int"].(*ProjectBlockInt).Value)
+	assert.Equal(t, int64(3), blocks["posint"].(*ProjectBlockInt).Value)
+	assert.Equal(t, 1.5, blocks["num"].(*ProjectBlockNumber).Value)
+	assert.Equal(t, "count", blocks["var"].(*ProjectBlockVariable).Name)
+	assert.Equal(t, ProjectVariableID("v1"), blocks["var"].(*ProjectBlockVariable).ID)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, blocks, expected string
+	}{
+		{
+			name:     "short variable",
+			blocks:   `{"b1": [12, "count"]}`,
+			expected: `target "robot": block "b1": [2]: missing`,
+		},
+		{
+			name:     "not an integer",
+			blocks:   `{"b1": [7, "ten"]}`,
+			expected: `target "robot": block "b1": [1]: expected a number but got "ten"`,
+		},
+		{
+			name:     "unknown primitive",
+			blocks:   `{"b1": [99, "x"]}`,
+			expected: `target "robot": block "b1": [0]: unrecognized block type 99`,
+		},
+		{
+			name:     "bad input",
+			blocks:   `{"b1": {"opcode": "flippermotor_motorStop", "inputs": {"PORT": [1, [10, {}]]}, "fields": {}}}`,
+			expected: `target "robot": block "b1": inputs.PORT[1][1]: expected a string or number but got {}`,
+		},
+		{
+			name:     "bad field",
+			blocks:   `{"b1": {"opcode": "flippermotor_motorStop", "inputs": {}, "fields": {"PORT": []}}}`,
+			expected: `target "robot": block "b1": fields.PORT: expected 1 or 2 elements in field but got []`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var proj Project
+			err := json.Unmarshal(projectWithBlocks(tc.blocks), &proj)
+			require.Error(t, err)
+			assert.Equal(t, tc.expected, err.Error())
+
+			var de *DecodeError
+			require.True(t, errors.As(err, &de))
+			assert.Equal(t, "robot", de.Target)
+			assert.Equal(t, ProjectBlockID("b1"), de.Block)
+		})
+	}
+}
+
+func TestDecodeLenient(t *testing.T) {
+	data := projectWithBlocks(`{
+		"ok": {"opcode": "flippermotor_motorStop", "inputs": {}, "fields": {}, "next": "odd"},
+		"odd": [99, "x", {"what": true}]
+	}`)
+
+	_, _, err := DecodeProject(data, DecodeOptions{})
+	assert.Error(t, err)
+
+	proj, problems, err := DecodeProject(data, DecodeOptions{Lenient: true})
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, `target "robot": block "odd": [0]: unrecognized block type 99`, problems[0].Error())
+
+	blocks := proj.Targets[1].Blocks
+	assert.IsType(t, &ProjectBlockObject{}, blocks["ok"])
+	raw, ok := blocks["odd"].(*ProjectBlockRaw)
+	require.True(t, ok)
+	assert.Equal(t, `[unknown [99, "x", {"what": true}]]`, raw.Description())
+
+	out, err := json.Marshal(blocks["odd"])
+	require.NoError(t, err)
+	assert.Equal(t, `[99,"x",{"what":true}]`, string(out))
+}
@@ -15,6 +15,8 @@ type Reader struct {
 	// - manifest.json
 	// - scratch.sb3
 	// - icon.svg
+	// Python programs have projectbody.json instead of scratch.sb3. SPIKE 3
+	// python programs may have main.py instead of projectbody.json.
 	// scratch.sb3 contains several files. one example i have has these:
 	// - project.json
 	// - 14d134f088239ac481523b3c2c6ecd8c.svg
@@ -68,49 +70,82 @@ func (r *Reader) Manifest() (Manifest, error) {
 
 // Project reads the scratch project and programs from the file.
 func (r *Reader) Project() (Project, error) {
-	var res Project
+	res, _, err := r.DecodeProject(DecodeOptions{})
+	return res, err
+}
 
+// DecodeProject reads the scratch project like Project does, but lets the
+// caller decide how to handle blocks that can't be decoded.
+func (r *Reader) DecodeProject(opts DecodeOptions) (Project, []*DecodeError, error) {
+	data, err := r.ProjectJSON()
+	if err != nil {
+		return Project{}, nil, err
+	}
+	return DecodeProject(data, opts)
+}
+
+// ProjectJSON reads the raw project.json from the scratch project in the file.
+func (r *Reader) ProjectJSON() ([]byte, error) {
 	f := get(r.zr, "scratch.sb3")
 	if f == nil {
-		return res, ErrNoScratch
+		return nil, ErrNoScratch
 	}
 
 	fr, err := f.Open()
 	if err != nil {
-		return res, err
+		return nil, err
 	}
 	defer fr.Close()
 
 	data, err := ioutil.ReadAll(fr)
 	if err != nil {
-		return res, err
+		return nil, err
 	}
 	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
-		return res, err
+		return nil, err
 	}
 
 	f = get(zr, "project.json")
 	if f == nil {
-		return res, ErrNoProject
+		return nil, ErrNoProject
 	}
 
 	pr, err := f.Open()
 	if err != nil {
-		return res, err
+		return nil, err
 	}
 	defer pr.Close()
 
-	err = json.NewDecoder(pr).Decode(&res)
-	return res, err
+	return ioutil.ReadAll(pr)
 }
 
-// Python reads python source from the file.
+// Format detects which version of the file format the file uses.
+func (r *Reader) Format() (Format, error) {
+	man, err := r.Manifest()
+	if err != nil {
+		return 0, err
+	}
+	if man.AppType == appTypeV3 || get(r.zr, "main.py") != nil {
+		return FormatV3, nil
+	}
+	return FormatV2, nil
+}
+
+// Python reads python source from the file. SPIKE 3 files keep it in main.py
+// if they have one, and older files keep it in projectbody.json.
 func (r *Reader) Python() (string, error) {
 	var projectbody struct {
 		Main string `json:"main"`
 	}
 
+	if format, err := r.Format(); err == nil && format == FormatV3 {
+		if f := get(r.zr, "main.py"); f != nil {
+			data, err := readZipFile(f)
+			return string(data), err
+		}
+	}
+
 	f := get(r.zr, "projectbody.json")
 	if f == nil {
 		return "", ErrNoPython
@@ -120,11 +155,22 @@ func (r *Reader) Python() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer pr.Close()
 
 	err = json.NewDecoder(pr).Decode(&projectbody)
 	return projectbody.Main, err
 }
 
+// readFile reads a file from the outer zip. It returns nil if the file isn't
+// there.
+func (r *Reader) readFile(name string) ([]byte, error) {
+	f := get(r.zr, name)
+	if f == nil {
+		return nil, nil
+	}
+	return readZipFile(f)
+}
+
 func get(r *zip.Reader, name string) *zip.File {
 	for _, f := range r.File {
 		if f.Name == name {
@@ -0,0 +1,44 @@
+package lmsp
+
+import "strings"
+
+// Format is a version of the program file format.
+type Format int
+
+const (
+	// FormatV2 is used by the MINDSTORMS app (.lms) and SPIKE 2 (.llsp).
+	FormatV2 Format = 2
+	// FormatV3 is used by SPIKE 3 (.llsp3).
+	FormatV3 Format = 3
+)
+
+// appTypeV3 is the manifest's appType in SPIKE 3 files. Older files don't
+// have an appType.
+const appTypeV3 = "llsp3"
+
+// FormatForExt returns the format that the apps use for files with extension
+// ext, like ".llsp3".
+func FormatForExt(ext string) Format {
+	if strings.EqualFold(ext, ".llsp3") {
+		return FormatV3
+	}
+	return FormatV2
+}
+
+// AppType is the appType to put in the manifest of a new file.
+func (f Format) AppType() string {
+	if f == FormatV3 {
+		return appTypeV3
+	}
+	return ""
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatV2:
+		return "v2"
+	case FormatV3:
+		return "v3"
+	}
+	return "unknown"
+}
@@ -0,0 +1,90 @@
+package lmsp
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	v2 := openTestFile(t, "testdata/hello.llsp")
+	format, err := v2.Format()
+	require.NoError(t, err)
+	assert.Equal(t, FormatV2, format)
+
+	v3 := zipTestFile(t, map[string]string{
+		"manifest.json":    `{"type":"python","appType":"llsp3","name":"hello"}`,
+		"projectbody.json": `{"main":"print('hello')\n"}`,
+	})
+	format, err = v3.Format()
+	require.NoError(t, err)
+	assert.Equal(t, FormatV3, format)
+	program, err := v3.Python()
+	require.NoError(t, err)
+	assert.Equal(t, "print('hello')\n", program)
+
+	assert.Equal(t, FormatV3, FormatForExt(".llsp3"))
+	assert.Equal(t, FormatV2, FormatForExt(".llsp"))
+	assert.Equal(t, FormatV2, FormatForExt(".lms"))
+}
+
+func TestReadV3Blocks(t *testing.T) {
+	r := openTestFile(t, "testdata/hello.llsp3")
+	format, err := r.Format()
+	require.NoError(t, err)
+	assert.Equal(t, FormatV3, format)
+
+	man, err := r.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, "Hello SPIKE 3", man.Name)
+	assert.Equal(t, "word-blocks", man.Type)
+
+	proj, err := r.Project()
+	require.NoError(t, err)
+	require.Len(t, proj.Targets, 2)
+	block, ok := proj.Targets[1].Blocks["a2"].(*ProjectBlockObject)
+	require.True(t, ok)
+	assert.Equal(t, ProjectOpcode("flipperlight_lightDisplayText"), block.Opcode)
+}
+
+func TestMainPy(t *testing.T) {
+	r := zipTestFile(t, map[string]string{
+		"manifest.json": `{"type":"python","name":"hello"}`,
+		"main.py":       "print('hello')\n",
+	})
+	format, err := r.Format()
+	require.NoError(t, err)
+	assert.Equal(t, FormatV3, format)
+	program, err := r.Python()
+	require.NoError(t, err)
+	assert.Equal(t, "print('hello')\n", program)
+
+	w := NewWriter(r)
+	w.SetPython("print('bye')\n")
+	changed := writeAndRead(t, w)
+
+	program, err = changed.Python()
+	require.NoError(t, err)
+	assert.Equal(t, "print('bye')\n", program)
+	for _, f := range changed.zr.File {
+		assert.NotEqual(t, "projectbody.json", f.Name)
+	}
+}
+
+func zipTestFile(t *testing.T, files map[string]string) *Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	r, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	return r
+}
@@ -0,0 +1,289 @@
+package lmsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ProjectInputShadow says whether an input has a shadow block, which is the
+// menu or literal that's shown when nothing is dropped into the input.
+type ProjectInputShadow int
+
+const (
+	// InputShadow means the input's value is its shadow.
+	InputShadow ProjectInputShadow = 1
+	// InputNoShadow means the input has no shadow, like a boolean input or a
+	// C mouth.
+	InputNoShadow ProjectInputShadow = 2
+	// InputObscuredShadow means a block was dropped on top of the input's
+	// shadow.
+	InputObscuredShadow ProjectInputShadow = 3
+)
+
+// ProjectInput is one of a block's inputs. In JSON it's an array like
+// [1, "blockID"], [1, [10, "hello"]] or [3, "blockID", [4, "10"]].
+type ProjectInput struct {
+	Shadow ProjectInputShadow
+
+	// Value is the block or primitive in the input.
+	Value ProjectInputValue
+
+	// Obscured is the shadow that's hidden by Value. It's only set when
+	// Shadow is InputObscuredShadow.
+	Obscured *ProjectInputValue
+}
+
+// ProjectInputValue is the block or primitive in an input. Both are nil when
+// the input is empty.
+type ProjectInputValue struct {
+	Block     *ProjectBlockID
+	Primitive *ProjectPrimitive
+}
+
+// BlockID returns the ID of the block in the input, if there is one. It's safe
+// to call on a nil input.
+func (i *ProjectInput) BlockID() (ProjectBlockID, bool) {
+	if i == nil || i.Value.Block == nil {
+		return "", false
+	}
+	return *i.Value.Block, true
+}
+
+func (i ProjectInput) MarshalJSON() ([]byte, error) {
+	vals := []interface{}{i.Shadow, i.Value}
+	if i.Obscured != nil {
+		vals = append(vals, *i.Obscured)
+	}
+	return json.Marshal(vals)
+}
+
+func (i *ProjectInput) UnmarshalJSON(data []byte) error {
+	var vals []json.RawMessage
+	if err := json.Unmarshal(data, &vals); err != nil {
+		return err
+	}
+	if len(vals) < 2 || len(vals) > 3 {
+		return errors.Errorf("expected 2 or 3 elements in input but got %s", data)
+	}
+
+	var res ProjectInput
+	if err := json.Unmarshal(vals[0], &res.Shadow); err != nil {
+		return atIndex(0, errors.Errorf("expected shadow type but got %s", vals[0]))
+	}
+	if err := json.Unmarshal(vals[1], &res.Value); err != nil {
+		return atIndex(1, err)
+	}
+	if len(vals) == 3 {
+		res.Obscured = &ProjectInputValue{}
+		if err := json.Unmarshal(vals[2], res.Obscured); err != nil {
+			return atIndex(2, err)
+		}
+	}
+	*i = res
+	return nil
+}
+
+func (v ProjectInputValue) MarshalJSON() ([]byte, error) {
+	switch {
+	case v.Block != nil:
+		return json.Marshal(*v.Block)
+	case v.Primitive != nil:
+		return json.Marshal(v.Primitive)
+	default:
+		return []byte("null"), nil
+	}
+}
+
+func (v *ProjectInputValue) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*v = ProjectInputValue{}
+	case len(data) > 0 && data[0] == '"':
+		var id ProjectBlockID
+		if err := json.Unmarshal(data, &id); err != nil {
+			return err
+		}
+		*v = ProjectInputValue{Block: &id}
+	default:
+		var p ProjectPrimitive
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		*v = ProjectInputValue{Primitive: &p}
+	}
+	return nil
+}
+
+// ProjectPrimitiveKind is the type of a primitive.
+type ProjectPrimitiveKind int
+
+const (
+	PrimitiveNumber          ProjectPrimitiveKind = 4
+	PrimitivePositiveNumber  ProjectPrimitiveKind = 5
+	PrimitivePositiveInteger ProjectPrimitiveKind = 6
+	PrimitiveInteger         ProjectPrimitiveKind = 7
+	PrimitiveAngle           ProjectPrimitiveKind = 8
+	PrimitiveColor           ProjectPrimitiveKind = 9
+	PrimitiveString          ProjectPrimitiveKind = 10
+	PrimitiveBroadcast       ProjectPrimitiveKind = 11
+	PrimitiveVariable        ProjectPrimitiveKind = 12
+	PrimitiveList            ProjectPrimitiveKind = 13
+)
+
+// IsNumber is true for the kinds of primitives that hold numbers.
+func (k ProjectPrimitiveKind) IsNumber() bool {
+	return k >= PrimitiveNumber && k <= PrimitiveAngle
+}
+
+// ProjectPrimitive is a value that's typed into an input, or a reference to a
+// broadcast, variable, or list. In JSON it's an array like [4, "10"] or
+// [12, "name", "id"].
+type ProjectPrimitive struct {
+	Kind ProjectPrimitiveKind
+
+	// Value is the literal value, or the name of the broadcast, variable,
+	// or list.
+	Value string
+
+	// ID is the ID of the broadcast, variable, or list.
+	ID string
+
+	// rawValue is Value's original JSON, if it wasn't a string.
+	rawValue json.RawMessage
+	// hasID is true if the JSON has an ID, even if it's empty.
+	hasID bool
+	// rest holds any elements after the ID, like the position of a
+	// variable reporter that isn't in a script.
+	rest []json.RawMessage
+}
+
+func (p ProjectPrimitive) MarshalJSON() ([]byte, error) {
+	vals := []interface{}{p.Kind, jsonValue(p.Value, p.rawValue)}
+	if p.hasID || p.ID != "" || len(p.rest) > 0 {
+		vals = append(vals, p.ID)
+	}
+	for _, r := range p.rest {
+		vals = append(vals, r)
+	}
+	return json.Marshal(vals)
+}
+
+func (p *ProjectPrimitive) UnmarshalJSON(data []byte) error {
+	var vals []json.RawMessage
+	if err := json.Unmarshal(data, &vals); err != nil {
+		return err
+	}
+	if len(vals) < 2 {
+		return errors.Errorf("expected at least 2 elements in primitive but got %s", data)
+	}
+
+	var res ProjectPrimitive
+	if err := json.Unmarshal(vals[0], &res.Kind); err != nil {
+		return atIndex(0, errors.Errorf("expected primitive type but got %s", vals[0]))
+	}
+	var err error
+	if res.Value, res.rawValue, err = decodeValue(vals[1]); err != nil {
+		return atIndex(1, err)
+	}
+	if len(vals) > 2 {
+		res.hasID = true
+		if err := json.Unmarshal(vals[2], &res.ID); err != nil {
+			return atIndex(2, errors.Errorf("expected ID but got %s", vals[2]))
+		}
+		if len(vals) > 3 {
+			res.rest = vals[3:]
+		}
+	}
+	*p = res
+	return nil
+}
+
+// ProjectField is one of a block's fields. In JSON it's an array like
+// ["value"] or ["value", "id"].
+type ProjectField struct {
+	// Value is the value chosen in the field.
+	Value string
+
+	// ID is the ID of the field's value, for fields like variable and
+	// broadcast menus.
+	ID *string
+
+	// rawValue is Value's original JSON, if it wasn't a string.
+	rawValue json.RawMessage
+	// hasID is true if the JSON has a second element, even if it's null.
+	hasID bool
+}
+
+func (f ProjectField) MarshalJSON() ([]byte, error) {
+	vals := []interface{}{jsonValue(f.Value, f.rawValue)}
+	if f.hasID || f.ID != nil {
+		vals = append(vals, f.ID)
+	}
+	return json.Marshal(vals)
+}
+
+func (f *ProjectField) UnmarshalJSON(data []byte) error {
+	var vals []json.RawMessage
+	if err := json.Unmarshal(data, &vals); err != nil {
+		return err
+	}
+	if len(vals) < 1 || len(vals) > 2 {
+		return errors.Errorf("expected 1 or 2 elements in field but got %s", data)
+	}
+
+	var res ProjectField
+	var err error
+	if res.Value, res.rawValue, err = decodeValue(vals[0]); err != nil {
+		return atIndex(0, err)
+	}
+	if len(vals) == 2 {
+		res.hasID = true
+		if err := json.Unmarshal(vals[1], &res.ID); err != nil {
+			return atIndex(1, errors.Errorf("expected ID but got %s", vals[1]))
+		}
+	}
+	*f = res
+	return nil
+}
+
+// FieldValue returns the value of one of the block's fields, or "" if the
+// block doesn't have the field.
+func (o *ProjectBlockObject) FieldValue(name ProjectFieldName) string {
+	return o.Fields[name].Value
+}
+
+// decodeValue decodes a value that's usually a string but is sometimes a
+// number, a boolean, or null. It returns the text of the value, and the
+// original JSON if the value wasn't a string.
+func decodeValue(data json.RawMessage) (string, json.RawMessage, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return "", nil, err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil, nil
+	case json.Number, bool:
+		return fmt.Sprint(v), data, nil
+	case nil:
+		return "", data, nil
+	}
+	return "", nil, errors.Errorf("expected a string or number but got %s", data)
+}
+
+// jsonValue undoes decodeValue. If the value hasn't changed, its original JSON
+// is used.
+func jsonValue(s string, raw json.RawMessage) interface{} {
+	if raw != nil {
+		if orig, _, err := decodeValue(raw); err == nil && orig == s {
+			return raw
+		}
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package lmsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputAndFieldRoundTrip(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/project.json")
+	require.NoError(t, err)
+
+	var raw struct {
+		Targets []struct {
+			Blocks map[string]json.RawMessage `json:"blocks"`
+		} `json:"targets"`
+	}
+	require.NoError(t, json.Unmarshal(data, &raw))
+
+	count := 0
+	for _, target := range raw.Targets {
+		for id, block := range target.Blocks {
+			var obj struct {
+				Inputs map[string]json.RawMessage `json:"inputs"`
+				Fields map[string]json.RawMessage `json:"fields"`
+			}
+			if json.Unmarshal(block, &obj) != nil {
+				continue // a primitive block
+			}
+			for name, orig := range obj.Inputs {
+				var input *ProjectInput
+				require.NoError(t, json.Unmarshal(orig, &input), "%s.%s", id, name)
+				assertSameJSON(t, orig, input, "%s.%s", id, name)
+				count++
+			}
+			for name, orig := range obj.Fields {
+				var field ProjectField
+				require.NoError(t, json.Unmarshal(orig, &field), "%s.%s", id, name)
+				assertSameJSON(t, orig, field, "%s.%s", id, name)
+				count++
+			}
+		}
+	}
+	assert.NotZero(t, count)
+}
+
+func TestInput(t *testing.T) {
+	var input ProjectInput
+	require.NoError(t, json.Unmarshal([]byte(`[3, "abc", [4, 10]]`), &input))
+	assert.Equal(t, InputObscuredShadow, input.Shadow)
+	id, ok := input.BlockID()
+	assert.True(t, ok)
+	assert.Equal(t, ProjectBlockID("abc"), id)
+	require.NotNil(t, input.Obscured)
+	require.NotNil(t, input.Obscured.Primitive)
+	assert.Equal(t, PrimitiveNumber, input.Obscured.Primitive.Kind)
+	assert.Equal(t, "10", input.Obscured.Primitive.Value)
+
+	input.Obscured.Primitive.Value = "20"
+	assertSameJSON(t, []byte(`[3, "abc", [4, "20"]]`), input)
+
+	require.NoError(t, json.Unmarshal([]byte(`[1, [12, "count", "v1"]]`), &input))
+	_, ok = input.BlockID()
+	assert.False(t, ok)
+	assert.Nil(t, input.Obscured)
+	assert.Equal(t, &ProjectPrimitive{Kind: PrimitiveVariable, Value: "count", ID: "v1", hasID: true}, input.Value.Primitive)
+
+	var missing *ProjectInput
+	_, ok = missing.BlockID()
+	assert.False(t, ok)
+}
+
+func TestField(t *testing.T) {
+	var field ProjectField
+	require.NoError(t, json.Unmarshal([]byte(`["go", "b1"]`), &field))
+	assert.Equal(t, "go", field.Value)
+	require.NotNil(t, field.ID)
+	assert.Equal(t, "b1", *field.ID)
+
+	require.NoError(t, json.Unmarshal([]byte(`[1, null]`), &field))
+	assert.Equal(t, "1", field.Value)
+	assert.Nil(t, field.ID)
+	assertSameJSON(t, []byte(`[1, null]`), field)
+
+	block := ProjectBlockObject{Fields: map[ProjectFieldName]ProjectField{"PORT": field}}
+	assert.Equal(t, "1", block.FieldValue("PORT"))
+	assert.Equal(t, "", block.FieldValue("OTHER"))
+}
+
+func assertSameJSON(t *testing.T, expected []byte, val interface{}, msgAndArgs ...interface{}) {
+	t.Helper()
+	actual, err := json.Marshal(val)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, json.Compact(&buf, expected))
+	assert.Equal(t, buf.String(), string(actual), msgAndArgs...)
+}
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
@@ -14,6 +15,15 @@ import (
 type File struct {
 	Raw     []byte
 	Project lmsp.Project
+	// Manifest is nil if the file doesn't have a manifest.json, or if it
+	// can't be decoded.
+	Manifest *lmsp.Manifest
+	// Problems are the blocks that couldn't be decoded. They're in
+	// Project as lmsp.ProjectBlockRaw.
+	Problems []*lmsp.DecodeError
+	// Warnings are other things that were wrong with the file but didn't
+	// stop it from being read, like a manifest.json that can't be decoded.
+	Warnings []error
 }
 
 func Read(path string) (*File, error) {
@@ -39,7 +49,22 @@ func Read(path string) (*File, error) {
 	}
 	defer zf.Close()
 
-	return readScratch(zf)
+	file, err := readScratch(zf)
+	if err != nil {
+		return nil, err
+	}
+
+	if mf, err := zr.Open("manifest.json"); err == nil {
+		defer mf.Close()
+		var man lmsp.Manifest
+		if err := json.NewDecoder(mf).Decode(&man); err != nil {
+			file.Warnings = append(file.Warnings, fmt.Errorf("manifest.json: %w", err))
+		} else {
+			file.Manifest = &man
+		}
+	}
+
+	return file, nil
 }
 
 func readScratch(f fs.File) (*File, error) {
@@ -63,10 +88,10 @@ func readScratch(f fs.File) (*File, error) {
 		return nil, err
 	}
 
-	res := &File{Raw: data}
-	if err := json.Unmarshal(data, &res.Project); err != nil {
+	proj, problems, err := lmsp.DecodeProject(data, lmsp.DecodeOptions{Lenient: true})
+	if err != nil {
 		return nil, err
 	}
 
-	return res, nil
+	return &File{Raw: data, Project: proj, Problems: problems}, nil
 }
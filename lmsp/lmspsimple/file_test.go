@@ -0,0 +1,46 @@
+package lmspsimple
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBadManifest(t *testing.T) {
+	orig, err := zip.OpenReader("../../lmsdump/testdata/project.lms")
+	require.NoError(t, err)
+	defer orig.Close()
+
+	path := filepath.Join(t.TempDir(), "bad.lms")
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(out)
+	for _, f := range orig.File {
+		w, err := zw.Create(f.Name)
+		require.NoError(t, err)
+		if f.Name == "manifest.json" {
+			_, err = w.Write([]byte(`{"name": `))
+			require.NoError(t, err)
+			continue
+		}
+		r, err := f.Open()
+		require.NoError(t, err)
+		_, err = io.Copy(w, r)
+		r.Close()
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, out.Close())
+
+	f, err := Read(path)
+	require.NoError(t, err)
+	assert.Nil(t, f.Manifest)
+	require.Len(t, f.Warnings, 1)
+	assert.Contains(t, f.Warnings[0].Error(), "manifest.json: ")
+	assert.Len(t, f.Project.Targets, 2)
+}
@@ -1,31 +1,75 @@
 package lmsp
 
-import "time"
+import (
+	"crypto/rand"
+	"math/big"
+	"time"
+)
 
 type Manifest struct {
-	Type          string    `json:"type"` // always "word-blocks" for EV3?
-	AutoDelete    bool      `json:"autoDelete"`
-	Created       time.Time `json:"created"`
-	ID            string    `json:"id"`
-	LastSaved     time.Time `json:"lastsaved"`
-	Size          int       `json:"size"` // always 0?
-	Name          string    `json:"name"`
-	SlotIndex     int       `json:"slotIndex"`
-	WorkspaceX    float64   `json:"workspaceX"`
-	WorkspaceY    float64   `json:"workspaceY"`
-	ZoomLevel     float64   `json:"zoomLevel"`
-	ShowAllBlocks bool      `json:"showAllBlocks"`
-	Version       int       `json:"version"` // always 5 for EV3?
-	Hardware      map[string]struct {
-		Name               string `json:"name"` // name of EV3 brick
-		Connection         string `json:"connection"`
-		LastConnectedHubID string `json:"lastConnectedHubId"`
-		ID                 string `json:"id"`
-		Type               string `json:"type"`
-	} `json:"hardware"`
-	Extensions []string `json:"extensions"` // ev3events, ev3move, ev3motor, ev3sensors
-	State      struct {
+	Type          string                      `json:"type"`              // always "word-blocks" for EV3?
+	AppType       string                      `json:"appType,omitempty"` // "llsp3" for SPIKE 3
+	AutoDelete    bool                        `json:"autoDelete"`
+	Created       time.Time                   `json:"created"`
+	ID            string                      `json:"id"`
+	LastSaved     time.Time                   `json:"lastsaved"`
+	Size          int                         `json:"size"` // always 0?
+	Name          string                      `json:"name"`
+	SlotIndex     int                         `json:"slotIndex"`
+	WorkspaceX    float64                     `json:"workspaceX"`
+	WorkspaceY    float64                     `json:"workspaceY"`
+	ZoomLevel     float64                     `json:"zoomLevel"`
+	ShowAllBlocks bool                        `json:"showAllBlocks"`
+	Version       int                         `json:"version"` // always 5 for EV3?
+	Hardware      map[string]ManifestHardware `json:"hardware"`
+	Extensions    []string                    `json:"extensions"` // ev3events, ev3move, ev3motor, ev3sensors
+	State         struct {
 		PlayMode        string `json:"playMode"`
 		CanvasDrawerTab string `json:"canvasDrawerTab"`
 	} `json:"state"`
 }
+
+type ManifestHardware struct {
+	Name               string `json:"name"` // name of EV3 brick
+	Connection         string `json:"connection"`
+	LastConnectedHubID string `json:"lastConnectedHubId"`
+	ID                 string `json:"id"`
+	Type               string `json:"type"`
+}
+
+// NewPythonManifest returns a manifest for a new python program, with a new
+// ID and the same defaults that the apps use.
+func NewPythonManifest(name string, now time.Time) Manifest {
+	now = now.UTC().Truncate(time.Millisecond)
+	m := Manifest{
+		Type:       "python",
+		Created:    now,
+		ID:         NewID(),
+		LastSaved:  now,
+		Name:       name,
+		ZoomLevel:  0.5,
+		Version:    10,
+		Hardware:   map[string]ManifestHardware{},
+		Extensions: []string{},
+	}
+	m.State.PlayMode = "download"
+	m.State.CanvasDrawerTab = "monitorTab"
+	return m
+}
+
+const idChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// NewID returns a random program ID, which looks like the ones that the apps
+// make.
+func NewID() string {
+	id := make([]byte, 12)
+	max := big.NewInt(int64(len(idChars)))
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		id[i] = idChars[n.Int64()]
+	}
+	return string(id)
+}
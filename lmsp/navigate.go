@@ -0,0 +1,167 @@
+package lmsp
+
+import (
+	"sort"
+	"strings"
+)
+
+// Block returns the block object with the given ID. It returns false if there
+// isn't one, or if it's a primitive or a block that couldn't be decoded.
+func (t ProjectTarget) Block(id ProjectBlockID) (*ProjectBlockObject, bool) {
+	block, ok := t.Blocks[id].(*ProjectBlockObject)
+	return block, ok && block != nil
+}
+
+// Next returns the ID of the block after id in its stack.
+func (t ProjectTarget) Next(id ProjectBlockID) (ProjectBlockID, bool) {
+	block, ok := t.Block(id)
+	if !ok || block.Next == nil {
+		return "", false
+	}
+	return *block.Next, true
+}
+
+// Parent returns the ID of the block before id in its stack, the C block
+// that id is the first block in the mouth of, or the block that id is an
+// input to.
+func (t ProjectTarget) Parent(id ProjectBlockID) (ProjectBlockID, bool) {
+	block, ok := t.Block(id)
+	if !ok || block.Parent == nil {
+		return "", false
+	}
+	return *block.Parent, true
+}
+
+// Stack returns id and the IDs of the blocks after it in its stack.
+func (t ProjectTarget) Stack(id ProjectBlockID) []ProjectBlockID {
+	var ids []ProjectBlockID
+	seen := map[ProjectBlockID]bool{}
+	for {
+		if _, ok := t.Block(id); !ok || seen[id] {
+			return ids
+		}
+		seen[id] = true
+		ids = append(ids, id)
+
+		next, ok := t.Next(id)
+		if !ok {
+			return ids
+		}
+		id = next
+	}
+}
+
+// InputBlock returns the ID of the block in one of a block's inputs. It
+// returns false if the input is empty or has a primitive value.
+func (t ProjectTarget) InputBlock(id ProjectBlockID, name ProjectInputID) (ProjectBlockID, bool) {
+	block, ok := t.Block(id)
+	if !ok {
+		return "", false
+	}
+	return block.Inputs[name].BlockID()
+}
+
+// Substack returns the IDs of the blocks in one of a C block's mouths, like
+// "SUBSTACK".
+func (t ProjectTarget) Substack(id ProjectBlockID, name ProjectInputID) []ProjectBlockID {
+	first, ok := t.InputBlock(id, name)
+	if !ok {
+		return nil
+	}
+	return t.Stack(first)
+}
+
+// Children returns the IDs of the blocks in a block's inputs, including the
+// first block in each mouth of a C block. They're ordered by input name.
+func (t ProjectTarget) Children(id ProjectBlockID) []ProjectBlockID {
+	block, ok := t.Block(id)
+	if !ok {
+		return nil
+	}
+	var ids []ProjectBlockID
+	for _, name := range block.InputNames() {
+		if child, ok := block.Inputs[name].BlockID(); ok {
+			ids = append(ids, child)
+		}
+	}
+	return ids
+}
+
+// InputNames returns the names of the block's inputs, in order.
+func (o *ProjectBlockObject) InputNames() []ProjectInputID {
+	names := make([]ProjectInputID, 0, len(o.Inputs))
+	for name := range o.Inputs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// IsSubstack is true if name is the name of a C block's mouth, like
+// "SUBSTACK" or "SUBSTACK2".
+func IsSubstack(name ProjectInputID) bool {
+	return strings.HasPrefix(string(name), "SUBSTACK")
+}
+
+// Script is a stack of blocks that starts with a top-level block.
+type Script struct {
+	// ID is the ID of the first block.
+	ID ProjectBlockID
+	// Top is the first block, which is usually a hat block.
+	Top *ProjectBlockObject
+}
+
+// ScriptIterator goes through a target's scripts. Use it like this:
+//
+//	for it := target.Scripts(); it.Next(); {
+//		script := it.Script()
+//	}
+type ScriptIterator struct {
+	target ProjectTarget
+	ids    []ProjectBlockID
+	cur    Script
+}
+
+// Scripts returns an iterator over the target's scripts, in the same order as
+// GetRootBlockIDs. Top-level shadow blocks aren't scripts, so they're
+// skipped.
+func (t ProjectTarget) Scripts() *ScriptIterator {
+	return &ScriptIterator{target: t, ids: t.GetRootBlockIDs()}
+}
+
+// Next moves to the next script. It returns false when there aren't any more.
+func (it *ScriptIterator) Next() bool {
+	for len(it.ids) > 0 {
+		id := it.ids[0]
+		it.ids = it.ids[1:]
+		if block, ok := it.target.Block(id); ok && !block.Shadow {
+			it.cur = Script{ID: id, Top: block}
+			return true
+		}
+	}
+	it.cur = Script{}
+	return false
+}
+
+// Script returns the current script.
+func (it *ScriptIterator) Script() Script {
+	return it.cur
+}
+
+// Blocks returns the IDs of the blocks in the script's top-level stack.
+func (s Script) Blocks(target ProjectTarget) []ProjectBlockID {
+	return target.Stack(s.ID)
+}
+
+// IsHat is true if the block looks like it starts a script, like "when
+// program starts" or the definition of a custom block. The opcode catalog's
+// opcodes.IsHat is better, because it knows each block's shape; this is its
+// guess for blocks that aren't in the catalog.
+func (o *ProjectBlockObject) IsHat() bool {
+	if o.Opcode == "procedures_definition" {
+		return true
+	}
+	op := string(o.Opcode)
+	i := strings.Index(op, "_")
+	return i >= 0 && strings.HasPrefix(op[i+1:], "when")
+}
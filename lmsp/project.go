@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
 	"sort"
+	"strconv"
 
 	"github.com/pkg/errors"
 )
@@ -230,6 +232,8 @@ func (b ProjectBlocks) MarshalJSON() ([]byte, error) {
 	return json.Marshal(blocks)
 }
 
+// UnmarshalJSON decodes blocks. A block that can't be decoded is kept as a
+// ProjectBlockRaw, and Project's decoding decides what to do about it.
 func (b *ProjectBlocks) UnmarshalJSON(data []byte) error {
 	var blocks map[ProjectBlockID]json.RawMessage
 	if err := json.Unmarshal(data, &blocks); err != nil {
@@ -238,7 +242,12 @@ func (b *ProjectBlocks) UnmarshalJSON(data []byte) error {
 	res := make(ProjectBlocks, len(blocks))
 	for id, data := range blocks {
 		if val, err := unmarshalProjectBlock(data); err != nil {
-			return err
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				de = &DecodeError{Err: err}
+			}
+			de.Block = id
+			res[id] = &ProjectBlockRaw{Raw: data, Err: de}
 		} else {
 			res[id] = val
 		}
@@ -247,19 +256,6 @@ func (b *ProjectBlocks) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-const (
-	projectBlockNumber          int = 4
-	projectBlockPositiveNumber      = 5
-	projectBlockPositiveInteger     = 6
-	projectBlockInteger             = 7
-	projectBlockAngle               = 8
-	projectBlockColor               = 9
-	projectBlockString              = 10
-	projectBlockBroadcast           = 11
-	projectBlockVariable            = 12
-	projectBlockList                = 13
-)
-
 func unmarshalProjectBlock(data json.RawMessage) (ProjectBlock, error) {
 	dec := json.NewDecoder(bytes.NewReader(data))
 	tok, err := dec.Token()
@@ -272,62 +268,7 @@ func unmarshalProjectBlock(data json.RawMessage) (ProjectBlock, error) {
 	}
 	switch delim {
 	case '[':
-		var vals []interface{}
-		err := json.Unmarshal(data, &vals)
-		if err != nil {
-			return nil, err
-		}
-		if len(vals) < 1 {
-			return nil, errors.Errorf("expected at least one element in array")
-		}
-		fcode, ok := vals[0].(float64)
-		if !ok {
-			return nil, errors.Errorf("expected first element (%+v, %T) to be a number in %q", vals[0], vals[0], data)
-		}
-		code := int(fcode)
-		switch code {
-		case projectBlockNumber, projectBlockPositiveNumber:
-			return &ProjectBlockNumber{
-				code:  code,
-				Value: vals[1].(float64),
-			}, nil
-		case projectBlockPositiveInteger, projectBlockInteger:
-			return &ProjectBlockInt{
-				code:  code,
-				Value: vals[1].(int64),
-			}, nil
-		case projectBlockAngle:
-			return &ProjectBlockAngle{
-				Value: vals[1].(float64),
-			}, nil
-		case projectBlockColor:
-			return &ProjectBlockColor{
-				Value: vals[1].(string),
-			}, nil
-		case projectBlockString:
-			return &ProjectBlockString{
-				Value: vals[1].(string),
-			}, nil
-		case projectBlockBroadcast:
-			return &ProjectBlockBroadcast{
-				Name: vals[1].(string),
-				ID:   ProjectBroadcastID(vals[2].(string)),
-			}, nil
-		case projectBlockVariable:
-			return &ProjectBlockVariable{
-				Name:   vals[1].(string),
-				ID:     ProjectVariableID(vals[2].(string)),
-				Coords: vals[3:],
-			}, nil
-		case projectBlockList:
-			return &ProjectBlockList{
-				Name:   vals[1].(string),
-				ID:     ProjectListID(vals[2].(string)),
-				Coords: vals[3:],
-			}, nil
-		default:
-			return nil, errors.Errorf("unrecognized block type in %q", data)
-		}
+		return unmarshalPrimitiveBlock(data)
 	case '{':
 		var res ProjectBlockObject
 		err := json.Unmarshal(data, &res)
@@ -337,12 +278,115 @@ func unmarshalProjectBlock(data json.RawMessage) (ProjectBlock, error) {
 	}
 }
 
+// unmarshalPrimitiveBlock decodes a block that's an array, like a variable
+// reporter that isn't in a script.
+func unmarshalPrimitiveBlock(data json.RawMessage) (ProjectBlock, error) {
+	var vals []json.RawMessage
+	if err := json.Unmarshal(data, &vals); err != nil {
+		return nil, err
+	}
+	if len(vals) < 2 {
+		return nil, errors.Errorf("expected at least two elements in %q", data)
+	}
+	var code ProjectPrimitiveKind
+	if err := json.Unmarshal(vals[0], &code); err != nil {
+		return nil, atIndex(0, errors.Errorf("expected a block type but got %s", vals[0]))
+	}
+
+	switch code {
+	case PrimitiveNumber, PrimitivePositiveNumber:
+		n, err := decodeFloat(vals[1])
+		if err != nil {
+			return nil, atIndex(1, err)
+		}
+		return &ProjectBlockNumber{code: code, Value: n}, nil
+	case PrimitivePositiveInteger, PrimitiveInteger:
+		n, err := decodeFloat(vals[1])
+		if err != nil {
+			return nil, atIndex(1, err)
+		}
+		if n != math.Trunc(n) {
+			return nil, atIndex(1, errors.Errorf("expected an integer but got %s", vals[1]))
+		}
+		return &ProjectBlockInt{code: code, Value: int64(n)}, nil
+	case PrimitiveAngle:
+		n, err := decodeFloat(vals[1])
+		if err != nil {
+			return nil, atIndex(1, err)
+		}
+		return &ProjectBlockAngle{Value: n}, nil
+	case PrimitiveColor:
+		var res ProjectBlockColor
+		return &res, decodeElems(vals, &res.Value)
+	case PrimitiveString:
+		var res ProjectBlockString
+		return &res, decodeElems(vals, &res.Value)
+	case PrimitiveBroadcast:
+		var res ProjectBlockBroadcast
+		return &res, decodeElems(vals, &res.Name, &res.ID)
+	case PrimitiveVariable:
+		var res ProjectBlockVariable
+		if err := decodeElems(vals, &res.Name, &res.ID); err != nil {
+			return nil, err
+		}
+		res.Coords = decodeCoords(vals[3:])
+		return &res, nil
+	case PrimitiveList:
+		var res ProjectBlockList
+		if err := decodeElems(vals, &res.Name, &res.ID); err != nil {
+			return nil, err
+		}
+		res.Coords = decodeCoords(vals[3:])
+		return &res, nil
+	default:
+		return nil, atIndex(0, errors.Errorf("unrecognized block type %d", code))
+	}
+}
+
+// decodeElems decodes vals[1:] into dest.
+func decodeElems(vals []json.RawMessage, dest ...interface{}) error {
+	for i, d := range dest {
+		if i+1 >= len(vals) {
+			return atIndex(i+1, errors.New("missing"))
+		}
+		if err := json.Unmarshal(vals[i+1], d); err != nil {
+			return atIndex(i+1, errors.Errorf("expected a string but got %s", vals[i+1]))
+		}
+	}
+	return nil
+}
+
+// decodeFloat decodes a number, which may be stored as a string.
+func decodeFloat(data json.RawMessage) (float64, error) {
+	s, _, err := decodeValue(data)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Errorf("expected a number but got %s", data)
+	}
+	return n, nil
+}
+
+// decodeCoords decodes the position of a variable or list reporter.
+func decodeCoords(vals []json.RawMessage) []interface{} {
+	res := make([]interface{}, 0, len(vals))
+	for _, v := range vals {
+		var c interface{}
+		// v is already valid JSON, so this can't fail.
+		_ = json.Unmarshal(v, &c)
+		res = append(res, c)
+	}
+	return res
+}
+
 type ProjectBlock interface {
 	Description() string
 }
 
 type ProjectBlockNumber struct {
-	code  int
+	code  ProjectPrimitiveKind
 	Value float64
 }
 
@@ -355,7 +399,7 @@ func (n ProjectBlockNumber) Description() string {
 }
 
 type ProjectBlockInt struct {
-	code  int
+	code  ProjectPrimitiveKind
 	Value int64
 }
 
@@ -372,7 +416,7 @@ type ProjectBlockAngle struct {
 }
 
 func (n ProjectBlockAngle) MarshalJSON() ([]byte, error) {
-	return json.Marshal([]interface{}{projectBlockAngle, n.Value})
+	return json.Marshal([]interface{}{PrimitiveAngle, n.Value})
 }
 
 func (n ProjectBlockAngle) Description() string {
@@ -384,7 +428,7 @@ type ProjectBlockColor struct {
 }
 
 func (n ProjectBlockColor) MarshalJSON() ([]byte, error) {
-	return json.Marshal([]interface{}{projectBlockColor, n.Value})
+	return json.Marshal([]interface{}{PrimitiveColor, n.Value})
 }
 
 func (n ProjectBlockColor) Description() string {
@@ -396,7 +440,7 @@ type ProjectBlockString struct {
 }
 
 func (n ProjectBlockString) MarshalJSON() ([]byte, error) {
-	return json.Marshal([]interface{}{projectBlockString, n.Value})
+	return json.Marshal([]interface{}{PrimitiveString, n.Value})
 }
 
 func (n ProjectBlockString) Description() string {
@@ -409,7 +453,7 @@ type ProjectBlockBroadcast struct {
 }
 
 func (n ProjectBlockBroadcast) MarshalJSON() ([]byte, error) {
-	return json.Marshal([]interface{}{projectBlockBroadcast, n.Name, n.ID})
+	return json.Marshal([]interface{}{PrimitiveBroadcast, n.Name, n.ID})
 }
 
 func (n ProjectBlockBroadcast) Description() string {
@@ -423,7 +467,7 @@ type ProjectBlockVariable struct {
 }
 
 func (n ProjectBlockVariable) MarshalJSON() ([]byte, error) {
-	return json.Marshal(append([]interface{}{projectBlockVariable, n.Name, n.ID}, n.Coords...))
+	return json.Marshal(append([]interface{}{PrimitiveVariable, n.Name, n.ID}, n.Coords...))
 }
 
 func (n ProjectBlockVariable) Description() string {
@@ -437,7 +481,7 @@ type ProjectBlockList struct {
 }
 
 func (n ProjectBlockList) MarshalJSON() ([]byte, error) {
-	return json.Marshal(append([]interface{}{projectBlockList, n.Name, n.ID}, n.Coords...))
+	return json.Marshal(append([]interface{}{PrimitiveList, n.Name, n.ID}, n.Coords...))
 }
 
 func (n ProjectBlockList) Description() string {
@@ -468,7 +512,7 @@ type ProjectBlockObject struct {
 	// representing it as described in the table below. If there is an
 	// obscured shadow, the third element is its ID or an array
 	// representing it.
-	Inputs map[ProjectInputID]TODO `json:"inputs"`
+	Inputs map[ProjectInputID]*ProjectInput `json:"inputs"`
 
 	// An object associating names with arrays representing fields. The
 	// first element of each array is the field's value. For certain
@@ -496,12 +540,48 @@ type ProjectBlockObject struct {
 	Mutation *ProjectMutation `json:"mutation,omitempty"`
 }
 
+func (o *ProjectBlockObject) UnmarshalJSON(data []byte) error {
+	type plain ProjectBlockObject
+	var res struct {
+		*plain
+		Inputs map[ProjectInputID]json.RawMessage   `json:"inputs"`
+		Fields map[ProjectFieldName]json.RawMessage `json:"fields"`
+	}
+	res.plain = (*plain)(o)
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+
+	o.Inputs = nil
+	if res.Inputs != nil {
+		o.Inputs = make(map[ProjectInputID]*ProjectInput, len(res.Inputs))
+	}
+	for name, data := range res.Inputs {
+		var input *ProjectInput
+		if err := json.Unmarshal(data, &input); err != nil {
+			return atPath("inputs."+string(name), err)
+		}
+		o.Inputs[name] = input
+	}
+
+	o.Fields = nil
+	if res.Fields != nil {
+		o.Fields = make(map[ProjectFieldName]ProjectField, len(res.Fields))
+	}
+	for name, data := range res.Fields {
+		var field ProjectField
+		if err := json.Unmarshal(data, &field); err != nil {
+			return atPath("fields."+string(name), err)
+		}
+		o.Fields[name] = field
+	}
+	return nil
+}
+
 func (o ProjectBlockObject) Description() string {
 	return fmt.Sprintf("[object %s]", o.Opcode)
 }
 
-type ProjectField TODO // [name, optional ID of field's value]
-
 // Mutations are present on blocks where the opcode property is equal to
 // "procedures_call" (i.e.  'custom block') or "procedures_prototype" (i.e. the
 // inner part of 'define [custom block]'). Mutations have the following
@@ -535,6 +615,28 @@ type ProjectMutation struct {
 	Warp string `json:"warp"`
 }
 
+// ArgumentIDList decodes ArgumentIDs, which is stored as a JSON-encoded array.
+func (m ProjectMutation) ArgumentIDList() []ProjectInputID {
+	var ids []ProjectInputID
+	decodeMutationList(m.ArgumentIDs, &ids)
+	return ids
+}
+
+// ArgumentNameList decodes ArgumentNames, which is stored as a JSON-encoded
+// array.
+func (m ProjectMutation) ArgumentNameList() []string {
+	var names []string
+	decodeMutationList(m.ArgumentNames, &names)
+	return names
+}
+
+func decodeMutationList(val TODO, res interface{}) {
+	if s, ok := val.(string); ok {
+		// If the list is malformed, act like it's empty.
+		_ = json.Unmarshal([]byte(s), res)
+	}
+}
+
 type ProjectComment struct {
 	Width     float64         `json:"width"`
 	Height    float64         `json:"height"`
@@ -0,0 +1,112 @@
+package lmsp
+
+// Visitor is called by Walk for each block in a script.
+//
+// Each Enter method returns whether to walk into the block. When it returns
+// false, the block's inputs and mouths are skipped, and the matching Leave
+// method isn't called.
+type Visitor interface {
+	// EnterStatement is called for a block in a stack.
+	EnterStatement(target ProjectTarget, id ProjectBlockID, block *ProjectBlockObject) bool
+	LeaveStatement(target ProjectTarget, id ProjectBlockID, block *ProjectBlockObject)
+
+	// EnterReporter is called for a block in one of parent's inputs, like
+	// an operator, a sensor, or a menu's shadow block.
+	EnterReporter(target ProjectTarget, parent ProjectBlockID, input ProjectInputID, id ProjectBlockID, block *ProjectBlockObject) bool
+	LeaveReporter(target ProjectTarget, parent ProjectBlockID, input ProjectInputID, id ProjectBlockID, block *ProjectBlockObject)
+
+	// EnterMouth is called before the stack in one of a C block's mouths,
+	// like the SUBSTACK of an if block. It's called even if the mouth is
+	// empty.
+	EnterMouth(target ProjectTarget, id ProjectBlockID, block *ProjectBlockObject, input ProjectInputID) bool
+	LeaveMouth(target ProjectTarget, id ProjectBlockID, block *ProjectBlockObject, input ProjectInputID)
+}
+
+// BaseVisitor does nothing, and walks into every block. Embed it in a Visitor
+// to only implement the methods that are needed.
+type BaseVisitor struct{}
+
+func (BaseVisitor) EnterStatement(ProjectTarget, ProjectBlockID, *ProjectBlockObject) bool {
+	return true
+}
+
+func (BaseVisitor) LeaveStatement(ProjectTarget, ProjectBlockID, *ProjectBlockObject) {}
+
+func (BaseVisitor) EnterReporter(ProjectTarget, ProjectBlockID, ProjectInputID, ProjectBlockID, *ProjectBlockObject) bool {
+	return true
+}
+
+func (BaseVisitor) LeaveReporter(ProjectTarget, ProjectBlockID, ProjectInputID, ProjectBlockID, *ProjectBlockObject) {
+}
+
+func (BaseVisitor) EnterMouth(ProjectTarget, ProjectBlockID, *ProjectBlockObject, ProjectInputID) bool {
+	return true
+}
+
+func (BaseVisitor) LeaveMouth(ProjectTarget, ProjectBlockID, *ProjectBlockObject, ProjectInputID) {}
+
+// Walk visits the stack that starts with id, and everything inside of it.
+// Inputs are visited in order by name. Obscured shadows and blocks that
+// can't be decoded are skipped.
+func Walk(v Visitor, target ProjectTarget, id ProjectBlockID) {
+	w := walker{v: v, target: target, seen: map[ProjectBlockID]bool{}}
+	w.stack(id)
+}
+
+// WalkScripts walks each of the target's scripts, in the order that Scripts
+// returns them.
+func WalkScripts(v Visitor, target ProjectTarget) {
+	for it := target.Scripts(); it.Next(); {
+		Walk(v, target, it.Script().ID)
+	}
+}
+
+type walker struct {
+	v      Visitor
+	target ProjectTarget
+	// seen keeps a malformed project from looping forever.
+	seen map[ProjectBlockID]bool
+}
+
+func (w walker) stack(id ProjectBlockID) {
+	for _, id := range w.target.Stack(id) {
+		block, _ := w.target.Block(id)
+		if w.seen[id] {
+			return
+		}
+		w.seen[id] = true
+		if !w.v.EnterStatement(w.target, id, block) {
+			continue
+		}
+		w.inputs(id, block)
+		w.v.LeaveStatement(w.target, id, block)
+	}
+}
+
+func (w walker) inputs(id ProjectBlockID, block *ProjectBlockObject) {
+	for _, name := range block.InputNames() {
+		if IsSubstack(name) {
+			if w.v.EnterMouth(w.target, id, block, name) {
+				if first, ok := block.Inputs[name].BlockID(); ok {
+					w.stack(first)
+				}
+				w.v.LeaveMouth(w.target, id, block, name)
+			}
+			continue
+		}
+
+		childID, ok := block.Inputs[name].BlockID()
+		if !ok || w.seen[childID] {
+			continue
+		}
+		child, ok := w.target.Block(childID)
+		if !ok {
+			continue
+		}
+		w.seen[childID] = true
+		if w.v.EnterReporter(w.target, id, name, childID, child) {
+			w.inputs(childID, child)
+			w.v.LeaveReporter(w.target, id, name, childID, child)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package lmsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const navigationTarget = `{"name": "robot", "blocks": {
+	"start": {"opcode": "flipperevents_whenProgramStarts", "next": "if", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+	"if": {"opcode": "control_if", "next": "stop", "parent": "start", "inputs": {"CONDITION": [2, "lt"], "SUBSTACK": [2, "beep"]}, "fields": {}, "shadow": false, "topLevel": false},
+	"lt": {"opcode": "operator_lt", "next": null, "parent": "if", "inputs": {"OPERAND1": [3, "timer", [10, ""]], "OPERAND2": [1, [10, "5"]]}, "fields": {}, "shadow": false, "topLevel": false},
+	"timer": {"opcode": "flippersensors_timer", "next": null, "parent": "lt", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false},
+	"beep": {"opcode": "flippersound_beep", "next": "beep2", "parent": "if", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false},
+	"beep2": {"opcode": "flippersound_beep", "next": null, "parent": "beep", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false},
+	"stop": {"opcode": "flippermove_stopMove", "next": null, "parent": "if", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false},
+	"menu": {"opcode": "flippermotor_multiple-port-selector", "next": null, "parent": null, "inputs": {}, "fields": {"field_flippermotor_multiple-port-selector": ["A", null]}, "shadow": true, "topLevel": true},
+	"var": [12, "count", "v1", 10, 10]
+}}`
+
+func readNavigationTarget(t *testing.T) ProjectTarget {
+	var target ProjectTarget
+	require.NoError(t, json.Unmarshal([]byte(navigationTarget), &target))
+	return target
+}
+
+func TestNavigation(t *testing.T) {
+	target := readNavigationTarget(t)
+
+	var scripts []ProjectBlockID
+	for it := target.Scripts(); it.Next(); {
+		scripts = append(scripts, it.Script().ID)
+	}
+	assert.Equal(t, []ProjectBlockID{"start"}, scripts)
+
+	assert.Equal(t, []ProjectBlockID{"start", "if", "stop"}, Script{ID: "start"}.Blocks(target))
+	assert.Equal(t, []ProjectBlockID{"beep", "beep2"}, target.Substack("if", "SUBSTACK"))
+	assert.Empty(t, target.Substack("if", "SUBSTACK2"))
+	assert.Equal(t, []ProjectBlockID{"lt", "beep"}, target.Children("if"))
+
+	next, ok := target.Next("if")
+	assert.True(t, ok)
+	assert.Equal(t, ProjectBlockID("stop"), next)
+	_, ok = target.Next("stop")
+	assert.False(t, ok)
+
+	parent, ok := target.Parent("timer")
+	assert.True(t, ok)
+	assert.Equal(t, ProjectBlockID("lt"), parent)
+
+	input, ok := target.InputBlock("lt", "OPERAND1")
+	assert.True(t, ok)
+	assert.Equal(t, ProjectBlockID("timer"), input)
+	_, ok = target.InputBlock("lt", "OPERAND2")
+	assert.False(t, ok)
+
+	_, ok = target.Block("var")
+	assert.False(t, ok)
+
+	start, _ := target.Block("start")
+	assert.True(t, start.IsHat())
+	beep, _ := target.Block("beep")
+	assert.False(t, beep.IsHat())
+}
+
+type recordingVisitor struct {
+	BaseVisitor
+	events []string
+}
+
+func (v *recordingVisitor) EnterStatement(_ ProjectTarget, id ProjectBlockID, _ *ProjectBlockObject) bool {
+	v.events = append(v.events, "enter "+string(id))
+	return true
+}
+
+func (v *recordingVisitor) LeaveStatement(_ ProjectTarget, id ProjectBlockID, _ *ProjectBlockObject) {
+	v.events = append(v.events, "leave "+string(id))
+}
+
+func (v *recordingVisitor) EnterReporter(_ ProjectTarget, parent ProjectBlockID, input ProjectInputID, id ProjectBlockID, _ *ProjectBlockObject) bool {
+	v.events = append(v.events, fmt.Sprintf("reporter %s.%s=%s", parent, input, id))
+	return true
+}
+
+func (v *recordingVisitor) EnterMouth(_ ProjectTarget, id ProjectBlockID, _ *ProjectBlockObject, input ProjectInputID) bool {
+	v.events = append(v.events, fmt.Sprintf("mouth %s.%s", id, input))
+	return true
+}
+
+func (v *recordingVisitor) LeaveMouth(_ ProjectTarget, id ProjectBlockID, _ *ProjectBlockObject, input ProjectInputID) {
+	v.events = append(v.events, fmt.Sprintf("end %s.%s", id, input))
+}
+
+func TestWalkScripts(t *testing.T) {
+	target := readNavigationTarget(t)
+
+	var v recordingVisitor
+	WalkScripts(&v, target)
+	assert.Equal(t, []string{
+		"enter start",
+		"leave start",
+		"enter if",
+		"reporter if.CONDITION=lt",
+		"reporter lt.OPERAND1=timer",
+		"mouth if.SUBSTACK",
+		"enter beep",
+		"leave beep",
+		"enter beep2",
+		"leave beep2",
+		"end if.SUBSTACK",
+		"leave if",
+		"enter stop",
+		"leave stop",
+	}, v.events)
+}
@@ -0,0 +1,343 @@
+package lmsp
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+)
+
+// Writer writes a program file. It starts with the contents of an existing
+// file, and replaces the manifest, scratch project, or python source with new
+// versions. Everything else, like the icon and the project's assets, is copied
+// as-is.
+type Writer struct {
+	base *Reader
+
+	manifest *Manifest
+	project  *Project
+	python   *string
+}
+
+// NewWriter creates a Writer that will write a copy of base. If base is nil,
+// the Writer will create a new file.
+func NewWriter(base *Reader) *Writer {
+	return &Writer{base: base}
+}
+
+// SetManifest replaces the file's manifest.json.
+func (w *Writer) SetManifest(m Manifest) {
+	w.manifest = &m
+}
+
+// SetProject replaces the project.json in the file's scratch.sb3.
+func (w *Writer) SetProject(p Project) {
+	w.project = &p
+}
+
+// SetPython replaces the python source in the file's projectbody.json, or in
+// main.py if that's where the original file has it.
+func (w *Writer) SetPython(program string) {
+	w.python = &program
+}
+
+// WriteTo writes the whole file to out.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	cw := &countingWriter{w: out}
+	zw := zip.NewWriter(cw)
+
+	written := map[string]bool{}
+	if w.base != nil {
+		for _, f := range w.base.zr.File {
+			written[f.Name] = true
+			data, replace, err := w.replacement(f.Name)
+			if err != nil {
+				return cw.n, err
+			}
+			if !replace {
+				if err := copyZipFile(zw, f); err != nil {
+					return cw.n, err
+				}
+				continue
+			}
+			if err := writeZipFile(zw, f.FileHeader, data); err != nil {
+				return cw.n, err
+			}
+		}
+	}
+
+	for _, name := range []string{"manifest.json", "scratch.sb3", "projectbody.json", "icon.svg"} {
+		if written[name] || (name == "projectbody.json" && written["main.py"]) {
+			continue
+		}
+		data, replace, err := w.replacement(name)
+		if err != nil {
+			return cw.n, err
+		}
+		if replace {
+			if err := writeZipFile(zw, zip.FileHeader{Name: name, Method: zip.Deflate}, data); err != nil {
+				return cw.n, err
+			}
+		}
+	}
+
+	err := zw.Close()
+	return cw.n, err
+}
+
+// replacement returns new contents for a file in the outer zip, if the file
+// needs to be replaced.
+func (w *Writer) replacement(name string) ([]byte, bool, error) {
+	switch name {
+	case "manifest.json":
+		if w.manifest == nil {
+			return nil, false, nil
+		}
+		orig, err := w.readBase(name)
+		if err != nil {
+			return nil, false, err
+		}
+		data, err := mergeJSON(orig, &Manifest{}, w.manifest)
+		return data, true, err
+
+	case "scratch.sb3":
+		if w.project == nil {
+			return nil, false, nil
+		}
+		data, err := w.scratch()
+		return data, true, err
+
+	case "projectbody.json":
+		if w.python == nil {
+			return nil, false, nil
+		}
+		orig, err := w.readBase(name)
+		if err != nil {
+			return nil, false, err
+		}
+		var body projectBody
+		data, err := mergeJSON(orig, &body, &projectBody{Main: *w.python})
+		return data, true, err
+
+	case "main.py":
+		if w.python == nil {
+			return nil, false, nil
+		}
+		return []byte(*w.python), true, nil
+
+	case "icon.svg":
+		// New files need an icon, and there isn't any way to
+		// change it yet.
+		return []byte(defaultIcon), w.base == nil, nil
+
+	default:
+		return nil, false, nil
+	}
+}
+
+// scratch builds a new scratch.sb3, with the original assets and a new
+// project.json.
+func (w *Writer) scratch() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	var orig []byte
+	if zr, err := w.readBaseScratch(); err != nil {
+		return nil, err
+	} else if zr != nil {
+		for _, f := range zr.File {
+			if f.Name == "project.json" {
+				if orig, err = readZipFile(f); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := copyZipFile(zw, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	data, err := mergeJSON(orig, &Project{}, w.project)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeZipFile(zw, zip.FileHeader{Name: "project.json", Method: zip.Deflate}, data); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *Writer) readBase(name string) ([]byte, error) {
+	if w.base == nil {
+		return nil, nil
+	}
+	return w.base.readFile(name)
+}
+
+func (w *Writer) readBaseScratch() (*zip.Reader, error) {
+	data, err := w.readBase("scratch.sb3")
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+type projectBody struct {
+	Main string `json:"main"`
+}
+
+// mergeJSON encodes newVal as a JSON object, but keeps the original encoding
+// of any top-level field that didn't change. This keeps fields that mind-meld
+// doesn't know about, and keeps the original order of the fields.
+//
+// oldVal is a pointer to a zero value of the same type as newVal. orig is
+// decoded into it to find out which fields changed.
+func mergeJSON(orig []byte, oldVal, newVal interface{}) ([]byte, error) {
+	newFields, newOrder, err := encodeFields(newVal)
+	if err != nil {
+		return nil, err
+	}
+	if len(orig) == 0 {
+		return joinFields(newOrder, newFields), nil
+	}
+
+	if err := json.Unmarshal(orig, oldVal); err != nil {
+		return nil, err
+	}
+	oldFields, _, err := encodeFields(oldVal)
+	if err != nil {
+		return nil, err
+	}
+	origFields, origOrder, err := splitFields(orig)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range origOrder {
+		if val, ok := newFields[name]; ok && !bytes.Equal(val, oldFields[name]) {
+			origFields[name] = val
+		}
+	}
+	for _, name := range newOrder {
+		if _, ok := origFields[name]; !ok && !bytes.Equal(newFields[name], oldFields[name]) {
+			origFields[name] = newFields[name]
+			origOrder = append(origOrder, name)
+		}
+	}
+	return joinFields(origOrder, origFields), nil
+}
+
+// encodeFields encodes val and splits it into its top-level fields.
+func encodeFields(val interface{}) (map[string]json.RawMessage, []string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(val); err != nil {
+		return nil, nil, err
+	}
+	return splitFields(buf.Bytes())
+}
+
+// splitFields splits a JSON object into its top-level fields, and also returns
+// the order that the fields are in.
+func splitFields(data []byte) (map[string]json.RawMessage, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	var order []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		name, _ := tok.(string)
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := fields[name]; !ok {
+			order = append(order, name)
+		}
+		fields[name] = val
+	}
+	return fields, order, nil
+}
+
+func joinFields(order []string, fields map[string]json.RawMessage) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, name := range order {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(fields[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func writeZipFile(zw *zip.Writer, hdr zip.FileHeader, data []byte) error {
+	hdr.CompressedSize64 = 0
+	hdr.UncompressedSize64 = 0
+	hdr.CRC32 = 0
+	hdr.Method = zip.Deflate
+	w, err := zw.CreateHeader(&hdr)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// copyZipFile copies f into zw as-is. It's like zw.Copy, which needs a newer
+// Go.
+func copyZipFile(zw *zip.Writer, f *zip.File) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	hdr := f.FileHeader
+	hdr.CompressedSize64 = 0
+	hdr.UncompressedSize64 = 0
+	hdr.CRC32 = 0
+	w, err := zw.CreateHeader(&hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+const defaultIcon = `<svg xmlns="http://www.w3.org/2000/svg" width="60" height="60" viewBox="0 0 60 60"><rect width="60" height="60" rx="8" fill="#ffd500"/></svg>`
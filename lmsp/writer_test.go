@@ -0,0 +1,155 @@
+package lmsp
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterCopy(t *testing.T) {
+	for _, name := range []string{"testdata/Gyro drive.lmsp", "../lmsdump/testdata/project.lms"} {
+		t.Run(name, func(t *testing.T) {
+			testWriterCopy(t, name)
+		})
+	}
+}
+
+func testWriterCopy(t *testing.T, name string) {
+	orig := openTestFile(t, name)
+
+	man, err := orig.Manifest()
+	require.NoError(t, err)
+	proj, err := orig.Project()
+	require.NoError(t, err)
+
+	w := NewWriter(orig)
+	w.SetManifest(man)
+	w.SetProject(proj)
+	copied := writeAndRead(t, w)
+
+	origManifest, err := orig.readFile("manifest.json")
+	require.NoError(t, err)
+	copiedManifest, err := copied.readFile("manifest.json")
+	require.NoError(t, err)
+	assert.Equal(t, string(origManifest), string(copiedManifest))
+
+	origIcon, err := orig.readFile("icon.svg")
+	require.NoError(t, err)
+	copiedIcon, err := copied.readFile("icon.svg")
+	require.NoError(t, err)
+	assert.Equal(t, origIcon, copiedIcon)
+
+	copiedProj, err := copied.Project()
+	require.NoError(t, err)
+	assert.Equal(t, proj, copiedProj)
+
+	// The project's assets are copied into the new scratch.sb3.
+	origAssets := scratchAssets(t, orig)
+	assert.NotEmpty(t, origAssets)
+	assert.Equal(t, origAssets, scratchAssets(t, copied))
+}
+
+// scratchAssets returns the files in r's scratch.sb3, other than project.json,
+// with how they're compressed.
+func scratchAssets(t *testing.T, r *Reader) map[string]string {
+	zr, err := NewWriter(r).readBaseScratch()
+	require.NoError(t, err)
+	assets := map[string]string{}
+	for _, f := range zr.File {
+		if f.Name == "project.json" {
+			continue
+		}
+		data, err := readZipFile(f)
+		require.NoError(t, err)
+		assets[f.Name] = fmt.Sprintf("method %d: %x", f.Method, data)
+	}
+	return assets
+}
+
+func TestWriterCopyScratch(t *testing.T) {
+	orig := openTestFile(t, "../lmsdump/testdata/project.lms")
+	man, err := orig.Manifest()
+	require.NoError(t, err)
+	man.Name = "renamed"
+
+	// Only the manifest changes, so scratch.sb3 is copied whole.
+	w := NewWriter(orig)
+	w.SetManifest(man)
+	copied := writeAndRead(t, w)
+
+	origScratch, err := orig.readFile("scratch.sb3")
+	require.NoError(t, err)
+	copiedScratch, err := copied.readFile("scratch.sb3")
+	require.NoError(t, err)
+	assert.Equal(t, origScratch, copiedScratch)
+}
+
+func TestWriterChanges(t *testing.T) {
+	orig := openTestFile(t, "testdata/Gyro drive.lmsp")
+
+	man, err := orig.Manifest()
+	require.NoError(t, err)
+	man.Name = "Gyro drive 2"
+
+	proj, err := orig.Project()
+	require.NoError(t, err)
+	proj.Targets[1].Name = "renamed"
+
+	w := NewWriter(orig)
+	w.SetManifest(man)
+	w.SetProject(proj)
+	changed := writeAndRead(t, w)
+
+	changedManifest, err := changed.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, man, changedManifest)
+
+	raw, err := changed.readFile("manifest.json")
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"name":"Gyro drive 2"`)
+	assert.Contains(t, string(raw), `"workspaceX":120.00000000000023`)
+
+	changedProj, err := changed.Project()
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", changedProj.Targets[1].Name)
+	assert.Equal(t, proj.Targets[1].Blocks, changedProj.Targets[1].Blocks)
+}
+
+func TestWriterNewPython(t *testing.T) {
+	w := NewWriter(nil)
+	w.SetManifest(Manifest{Type: "python", Name: "new program", ID: "abcdefghijkl"})
+	w.SetPython("print('hi')\n")
+	created := writeAndRead(t, w)
+
+	man, err := created.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, "python", man.Type)
+	assert.Equal(t, "new program", man.Name)
+
+	program, err := created.Python()
+	require.NoError(t, err)
+	assert.Equal(t, "print('hi')\n", program)
+}
+
+func openTestFile(t *testing.T, name string) *Reader {
+	data, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	r, err := Read(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	return r
+}
+
+func writeAndRead(t *testing.T, w *Writer) *Reader {
+	var buf bytes.Buffer
+	n, err := w.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	r, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	return r
+}
@@ -0,0 +1,311 @@
+// Package lmstree turns a block program into a tree of targets, scripts, and
+// nested blocks, for programs that aren't written in Go. Inputs hold their
+// values, or the blocks that are dropped into them, instead of block IDs, so
+// there's no linked list to follow.
+package lmstree
+
+import (
+	"sort"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// Options changes how a tree is built.
+type Options struct {
+	// OmitBlockIDs leaves block IDs out of the tree.
+	OmitBlockIDs bool
+
+	// Manifest, if it's set, is used for the program's name and type.
+	Manifest *lmsp.Manifest
+}
+
+type Program struct {
+	Name       string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Type       string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Extensions []string `json:"extensions,omitempty" yaml:"extensions,omitempty"`
+	Targets    []Target `json:"targets" yaml:"targets"`
+}
+
+// Target is the stage or a sprite.
+type Target struct {
+	Name       string     `json:"name" yaml:"name"`
+	Stage      bool       `json:"stage,omitempty" yaml:"stage,omitempty"`
+	Variables  []Variable `json:"variables,omitempty" yaml:"variables,omitempty"`
+	Lists      []List     `json:"lists,omitempty" yaml:"lists,omitempty"`
+	Broadcasts []string   `json:"broadcasts,omitempty" yaml:"broadcasts,omitempty"`
+	Scripts    []Script   `json:"scripts,omitempty" yaml:"scripts,omitempty"`
+	// Comments are the comments that aren't attached to a block.
+	Comments []string `json:"comments,omitempty" yaml:"comments,omitempty"`
+}
+
+type Variable struct {
+	Name  string      `json:"name" yaml:"name"`
+	Value interface{} `json:"value" yaml:"value"`
+}
+
+type List struct {
+	Name   string        `json:"name" yaml:"name"`
+	Values []interface{} `json:"values" yaml:"values"`
+}
+
+// Script is a stack of blocks. The first block is usually a hat block.
+type Script struct {
+	X      int      `json:"x" yaml:"x"`
+	Y      int      `json:"y" yaml:"y"`
+	Blocks []*Block `json:"blocks" yaml:"blocks"`
+}
+
+type Block struct {
+	ID     string `json:"id,omitempty" yaml:"id,omitempty"`
+	Opcode string `json:"opcode" yaml:"opcode"`
+
+	// ProcCode is the name of the custom block that's called or defined,
+	// like "drive %s %s".
+	ProcCode string `json:"proccode,omitempty" yaml:"proccode,omitempty"`
+	// Params are the names of a custom block's arguments, in a definition.
+	Params []string `json:"params,omitempty" yaml:"params,omitempty"`
+
+	// Inputs are named like the block's inputs. A custom block's
+	// arguments are named by the argument names instead of their IDs.
+	Inputs map[string]*Value `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Fields map[string]string `json:"fields,omitempty" yaml:"fields,omitempty"`
+
+	// Substacks are the blocks in each of a C block's mouths, like
+	// "SUBSTACK" and "SUBSTACK2".
+	Substacks map[string][]*Block `json:"substacks,omitempty" yaml:"substacks,omitempty"`
+
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// Value is what's in one of a block's inputs.
+type Value struct {
+	// Kind is "number", "color", "string", "broadcast", "variable", "list",
+	// "menu", "block", or "empty".
+	Kind string `json:"kind" yaml:"kind"`
+	// Value is set for everything except blocks and empty inputs. For
+	// a menu, it's the menu's choice.
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	// Block is the reporter that's dropped into the input.
+	Block *Block `json:"block,omitempty" yaml:"block,omitempty"`
+}
+
+// Build makes a tree from a project. Scripts are ordered by where they are on
+// the canvas, and variables, lists, and broadcasts are ordered by name.
+func Build(proj lmsp.Project, opts Options) Program {
+	var prog Program
+	if opts.Manifest != nil {
+		prog.Name = opts.Manifest.Name
+		prog.Type = opts.Manifest.Type
+	}
+	for _, ext := range proj.Extensions {
+		prog.Extensions = append(prog.Extensions, string(ext))
+	}
+	sort.Strings(prog.Extensions)
+
+	prog.Targets = []Target{}
+	for _, t := range proj.Targets {
+		b := builder{target: t, opts: opts, seen: map[lmsp.ProjectBlockID]bool{}}
+		prog.Targets = append(prog.Targets, b.build())
+	}
+	return prog
+}
+
+type builder struct {
+	target lmsp.ProjectTarget
+	opts   Options
+	// seen keeps a malformed project from looping forever.
+	seen map[lmsp.ProjectBlockID]bool
+}
+
+func (b builder) build() Target {
+	t := b.target
+	res := Target{Name: t.Name, Stage: t.IsStage}
+
+	for _, v := range t.Variables {
+		res.Variables = append(res.Variables, Variable{Name: v.Name, Value: v.Value})
+	}
+	sort.Slice(res.Variables, func(i, j int) bool { return res.Variables[i].Name < res.Variables[j].Name })
+
+	for _, l := range t.Lists {
+		values := l.Values
+		if values == nil {
+			values = []interface{}{}
+		}
+		res.Lists = append(res.Lists, List{Name: l.Name, Values: values})
+	}
+	sort.Slice(res.Lists, func(i, j int) bool { return res.Lists[i].Name < res.Lists[j].Name })
+
+	for _, name := range t.Broadcasts {
+		res.Broadcasts = append(res.Broadcasts, string(name))
+	}
+	sort.Strings(res.Broadcasts)
+
+	for it := t.Scripts(); it.Next(); {
+		s := it.Script()
+		res.Scripts = append(res.Scripts, Script{
+			X:      coord(s.Top.X),
+			Y:      coord(s.Top.Y),
+			Blocks: b.stack(s.ID),
+		})
+	}
+	sort.SliceStable(res.Scripts, func(i, j int) bool {
+		a, b := res.Scripts[i], res.Scripts[j]
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.X < b.X
+	})
+
+	for _, id := range t.GetStandaloneCommentIDs() {
+		res.Comments = append(res.Comments, t.Comments[id].Text)
+	}
+	return res
+}
+
+func (b builder) stack(id lmsp.ProjectBlockID) []*Block {
+	blocks := []*Block{}
+	for _, id := range b.target.Stack(id) {
+		if b.seen[id] {
+			break
+		}
+		blocks = append(blocks, b.block(id))
+	}
+	return blocks
+}
+
+func (b builder) block(id lmsp.ProjectBlockID) *Block {
+	b.seen[id] = true
+	block, _ := b.target.Block(id)
+
+	res := &Block{Opcode: string(block.Opcode)}
+	if !b.opts.OmitBlockIDs {
+		res.ID = string(id)
+	}
+	if block.Comment != "" {
+		res.Comment = b.target.Comments[block.Comment].Text
+	}
+
+	argNames := map[lmsp.ProjectInputID]string{}
+	switch block.Opcode {
+	case "procedures_call":
+		if block.Mutation != nil {
+			res.ProcCode = block.Mutation.ProcCode
+			argNames = b.argumentNames(block.Mutation.ProcCode)
+		}
+	case "procedures_definition":
+		if proto, ok := b.prototype(block); ok {
+			res.ProcCode = proto.Mutation.ProcCode
+			res.Params = proto.Mutation.ArgumentNameList()
+		}
+	}
+
+	for name, field := range block.Fields {
+		if res.Fields == nil {
+			res.Fields = map[string]string{}
+		}
+		res.Fields[string(name)] = field.Value
+	}
+
+	for _, name := range block.InputNames() {
+		if block.Opcode == "procedures_definition" && name == "custom_block" {
+			continue
+		}
+		if lmsp.IsSubstack(name) {
+			if res.Substacks == nil {
+				res.Substacks = map[string][]*Block{}
+			}
+			res.Substacks[string(name)] = []*Block{}
+			if first, ok := block.Inputs[name].BlockID(); ok {
+				res.Substacks[string(name)] = b.stack(first)
+			}
+			continue
+		}
+		if res.Inputs == nil {
+			res.Inputs = map[string]*Value{}
+		}
+		key := string(name)
+		if argName, ok := argNames[name]; ok {
+			key = argName
+		}
+		res.Inputs[key] = b.value(block.Inputs[name])
+	}
+	return res
+}
+
+func (b builder) value(input *lmsp.ProjectInput) *Value {
+	if input == nil {
+		return &Value{Kind: "empty"}
+	}
+	if p := input.Value.Primitive; p != nil {
+		return &Value{Kind: kindName(p.Kind), Value: p.Value}
+	}
+	id, ok := input.BlockID()
+	if !ok || b.seen[id] {
+		return &Value{Kind: "empty"}
+	}
+	block, ok := b.target.Block(id)
+	if !ok {
+		return &Value{Kind: "empty"}
+	}
+	// A menu is a shadow block with one field, so it's written as the
+	// menu's choice.
+	if block.Shadow && len(block.Fields) == 1 && len(block.Inputs) == 0 {
+		for _, field := range block.Fields {
+			return &Value{Kind: "menu", Value: field.Value}
+		}
+	}
+	return &Value{Kind: "block", Block: b.block(id)}
+}
+
+// prototype returns the prototype of a custom block definition.
+func (b builder) prototype(def *lmsp.ProjectBlockObject) (*lmsp.ProjectBlockObject, bool) {
+	id, ok := def.Inputs["custom_block"].BlockID()
+	if !ok {
+		return nil, false
+	}
+	proto, ok := b.target.Block(id)
+	return proto, ok && proto.Mutation != nil
+}
+
+// argumentNames maps the argument IDs of a custom block to their names, from
+// the custom block's prototype.
+func (b builder) argumentNames(procCode string) map[lmsp.ProjectInputID]string {
+	names := map[lmsp.ProjectInputID]string{}
+	for _, block := range b.target.Blocks {
+		proto, ok := block.(*lmsp.ProjectBlockObject)
+		if !ok || proto.Opcode != "procedures_prototype" || proto.Mutation == nil || proto.Mutation.ProcCode != procCode {
+			continue
+		}
+		argNames := proto.Mutation.ArgumentNameList()
+		for i, id := range proto.Mutation.ArgumentIDList() {
+			if i < len(argNames) {
+				names[id] = argNames[i]
+			}
+		}
+	}
+	return names
+}
+
+func kindName(kind lmsp.ProjectPrimitiveKind) string {
+	switch {
+	case kind.IsNumber():
+		return "number"
+	case kind == lmsp.PrimitiveColor:
+		return "color"
+	case kind == lmsp.PrimitiveBroadcast:
+		return "broadcast"
+	case kind == lmsp.PrimitiveVariable:
+		return "variable"
+	case kind == lmsp.PrimitiveList:
+		return "list"
+	default:
+		return "string"
+	}
+}
+
+func coord(c *int) int {
+	if c == nil {
+		return 0
+	}
+	return *c
+}
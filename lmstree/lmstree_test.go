@@ -0,0 +1,153 @@
+package lmstree
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spraints/mind-meld/internal/sampletest"
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+const project = `{"targets": [{"isStage": false, "name": "sprite",
+  "variables": {"v1": ["count", 0]},
+  "comments": {"c1": {"blockId": "beep", "x": 0, "y": 0, "width": 100, "height": 100, "minimized": false, "text": "loud"}},
+  "blocks": {
+    "def": {"opcode": "procedures_definition", "next": null, "parent": null, "inputs": {"custom_block": [1, "proto"]}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 400},
+    "proto": {"opcode": "procedures_prototype", "next": null, "parent": "def", "inputs": {}, "fields": {}, "shadow": true, "topLevel": false, "mutation": {"tagName": "mutation", "children": [], "proccode": "drive %s", "argumentids": "[\"a;id\"]", "argumentnames": "[\"speed\"]", "argumentdefaults": "[\"\"]", "warp": "false"}},
+    "hat": {"opcode": "flipperevents_whenProgramStarts", "next": "if", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+    "if": {"opcode": "control_if", "next": "call", "parent": "hat", "inputs": {"CONDITION": [2, "lt"], "SUBSTACK": [2, "beep"]}, "fields": {}, "shadow": false, "topLevel": false},
+    "lt": {"opcode": "operator_lt", "next": null, "parent": "if", "inputs": {"OPERAND1": [3, [12, "count", "v1"], [10, ""]], "OPERAND2": [1, [10, "5"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "beep": {"opcode": "flippersound_beep", "next": null, "parent": "if", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false, "comment": "c1"},
+    "call": {"opcode": "procedures_call", "next": null, "parent": "if", "inputs": {"a;id": [1, "port"]}, "fields": {}, "shadow": false, "topLevel": false, "mutation": {"tagName": "mutation", "children": [], "proccode": "drive %s", "argumentids": "[\"a;id\"]", "warp": "false"}},
+    "port": {"opcode": "flippermotor_single-motor-selector", "next": null, "parent": "call", "inputs": {}, "fields": {"field_flippermotor_single-motor-selector": ["A", null]}, "shadow": true, "topLevel": false}
+  }}]}`
+
+func build(t *testing.T) Program {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(project), &proj))
+	return Build(proj, Options{OmitBlockIDs: true, Manifest: &lmsp.Manifest{Name: "My Robot", Type: "word-blocks"}})
+}
+
+func TestBuild(t *testing.T) {
+	prog := build(t)
+	assert.Equal(t, Program{
+		Name: "My Robot",
+		Type: "word-blocks",
+		Targets: []Target{{
+			Name:      "sprite",
+			Variables: []Variable{{Name: "count", Value: 0.0}},
+			Scripts: []Script{
+				{Y: 0, Blocks: []*Block{
+					{Opcode: "flipperevents_whenProgramStarts"},
+					{
+						Opcode: "control_if",
+						Inputs: map[string]*Value{
+							"CONDITION": {Kind: "block", Block: &Block{
+								Opcode: "operator_lt",
+								Inputs: map[string]*Value{
+									"OPERAND1": {Kind: "variable", Value: "count"},
+									"OPERAND2": {Kind: "string", Value: "5"},
+								},
+							}},
+						},
+						Substacks: map[string][]*Block{
+							"SUBSTACK": {{Opcode: "flippersound_beep", Comment: "loud"}},
+						},
+					},
+					{
+						Opcode:   "procedures_call",
+						ProcCode: "drive %s",
+						Inputs: map[string]*Value{
+							"speed": {Kind: "menu", Value: "A"},
+						},
+					},
+				}},
+				{Y: 400, Blocks: []*Block{
+					{Opcode: "procedures_definition", ProcCode: "drive %s", Params: []string{"speed"}},
+				}},
+			},
+		}},
+	}, prog)
+}
+
+func TestBuildSample(t *testing.T) {
+	f := sampletest.Read(t)
+	prog := Build(f.Project, Options{OmitBlockIDs: true, Manifest: f.Manifest})
+
+	assert.Equal(t, "Project 1", prog.Name)
+	assert.Equal(t, "word-blocks", prog.Type)
+	require.Len(t, prog.Targets, 2)
+	assert.Equal(t, []string{"message1"}, prog.Targets[0].Broadcasts)
+
+	sprite := prog.Targets[1]
+	assert.Equal(t, []Variable{{Name: "yahey", Value: 0.0}}, sprite.Variables)
+	opcodes := func(s Script) []string {
+		var opcodes []string
+		for _, b := range s.Blocks {
+			opcodes = append(opcodes, b.Opcode)
+		}
+		return opcodes
+	}
+
+	// Scripts are sorted from top to bottom.
+	require.NotEmpty(t, sprite.Scripts)
+	first := sprite.Scripts[0]
+	assert.Equal(t, []int{639, -406}, []int{first.X, first.Y})
+	assert.Equal(t, []string{
+		"flipperevents_whenColor",
+		"event_broadcastandwait",
+		"flippermotor_motorGoDirectionToPosition",
+		"flipperdisplay_ledAnimation",
+		"flipperdisplay_ultrasonicLightUp",
+		"control_wait",
+		"flippermoremove_startDualSpeed",
+	}, opcodes(first))
+	assert.Equal(t, &Value{Kind: "broadcast", Value: "message1"}, first.Blocks[1].Inputs["BROADCAST_INPUT"])
+
+	// A block on its own is a script too.
+	last := sprite.Scripts[len(sprite.Scripts)-1]
+	assert.Equal(t, []int{-72, 2089}, []int{last.X, last.Y})
+	assert.Equal(t, []string{"radiobroadcast_whenIReceiveRadioSignalHat"}, opcodes(last))
+}
+
+func TestBuildBlockIDs(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(project), &proj))
+	prog := Build(proj, Options{})
+	assert.Equal(t, "hat", prog.Targets[0].Scripts[0].Blocks[0].ID)
+	assert.Equal(t, "lt", prog.Targets[0].Scripts[0].Blocks[1].Inputs["CONDITION"].Block.ID)
+}
+
+func TestWrite(t *testing.T) {
+	prog := Program{Name: "My Robot", Targets: []Target{{Name: "sprite", Scripts: []Script{{X: 1, Y: 2, Blocks: []*Block{
+		{Opcode: "control_wait", Inputs: map[string]*Value{"DURATION": {Kind: "number", Value: "1"}}},
+	}}}}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, prog, "json"))
+	assert.JSONEq(t, `{"name": "My Robot", "targets": [{"name": "sprite", "scripts": [{"x": 1, "y": 2, "blocks": [
+		{"opcode": "control_wait", "inputs": {"DURATION": {"kind": "number", "value": "1"}}}
+	]}]}]}`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, Write(&buf, prog, "yaml"))
+	assert.Equal(t, `name: My Robot
+targets:
+  - name: sprite
+    scripts:
+      - x: 1
+        "y": 2
+        blocks:
+          - opcode: control_wait
+            inputs:
+              DURATION:
+                kind: number
+                value: "1"
+`, buf.String())
+
+	assert.EqualError(t, Write(&buf, prog, "xml"), `unknown format "xml" (expected json or yaml)`)
+}
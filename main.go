@@ -7,18 +7,28 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/spraints/mind-meld/appcmd"
 	"github.com/spraints/mind-meld/appcmd/diff"
 	"github.com/spraints/mind-meld/appcmd/fetch"
+	"github.com/spraints/mind-meld/appcmd/push"
 	"github.com/spraints/mind-meld/appcmd/watch"
 	"github.com/spraints/mind-meld/apps/mindstormsapp"
 	"github.com/spraints/mind-meld/apps/spike"
+	"github.com/spraints/mind-meld/apps/spike3"
+	"github.com/spraints/mind-meld/blockdiff"
+	"github.com/spraints/mind-meld/coverage"
 	"github.com/spraints/mind-meld/githooks"
+	"github.com/spraints/mind-meld/graph"
+	"github.com/spraints/mind-meld/lint"
 	"github.com/spraints/mind-meld/lmsdump"
 	"github.com/spraints/mind-meld/lmsp"
+	"github.com/spraints/mind-meld/lmstree"
+	"github.com/spraints/mind-meld/opcodes"
+	"github.com/spraints/mind-meld/transpile"
 	"github.com/spraints/mind-meld/ui"
 )
 
@@ -30,18 +40,43 @@ func mkRootCmd() *cobra.Command {
 	root := &cobra.Command{
 		Use:   "mind-meld",
 		Short: "Manage your LEGO MINDSTORMS",
+		PersistentPreRun: func(*cobra.Command, []string) {
+			opcodes.SetDefaultFunc(configuredOpcodes)
+		},
 	}
 
+	root.AddCommand(mkBlockDiffCmd())
 	root.AddCommand(mkBrowseCmd())
 	root.AddCommand(mkDumpCmd())
+	root.AddCommand(mkGitDiffCmd())
+	root.AddCommand(mkGraphCmd())
+	root.AddCommand(mkLintCmd())
+	root.AddCommand(mkOpcodesCmd())
 	root.AddCommand(mkPreCommitCmd())
+	root.AddCommand(mkTranspileCmd())
 
 	root.AddCommand(mkAppSubcommandCmd("mindstorms", mindstormsapp.New()))
 	root.AddCommand(mkAppSubcommandCmd("spike", spike.New()))
+	root.AddCommand(mkAppSubcommandCmd("spike3", spike3.New()))
 
 	return root
 }
 
+func mkBlockDiffCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "blockdiff OLD NEW",
+		Short: "Show which blocks changed between two versions of a program.",
+		Long: `Show which blocks changed between two versions of a program.
+
+Scripts are matched up between the two versions, and then each block that was
+added, removed, moved, or had a parameter changed is listed.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return blockDiff(args[0], args[1])
+		},
+	}
+}
+
 func mkBrowseCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "browse",
@@ -58,18 +93,179 @@ func mkBrowseCmd() *cobra.Command {
 }
 
 func mkDumpCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts lmsdump.Options
+	var format string
+	cmd := &cobra.Command{
 		Use:   "dump",
 		Short: "Print a plain text version of a mindstorms program.",
-		Args:  cobra.ExactArgs(1),
+		Long: `Print a plain text version of a mindstorms program.
+
+With --format json or --format yaml, the program is printed as a tree of
+targets, scripts, and nested blocks, for tools that aren't written in Go. Each
+block's inputs hold their values or the reporter blocks in them, and a C
+block's "substacks" hold the blocks in its mouths.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return dump(args[0], format, opts)
+		},
+	}
+	addDumpFlags(cmd, &opts)
+	cmd.Flags().StringVar(&format, "format", "text", "text, json, or yaml")
+	return cmd
+}
+
+func addDumpFlags(cmd *cobra.Command, opts *lmsdump.Options) {
+	cmd.Flags().BoolVar(&opts.OmitBlockIDs, "omit-ids", false, "leave block IDs out of the output")
+}
+
+func mkGitDiffCmd() *cobra.Command {
+	var opts lmsdump.Options
+	cmd := &cobra.Command{
+		Use:   "git-diff FILE",
+		Short: "Print a plain text version of a program, for use as a git textconv filter.",
+		Long: `Print a plain text version of a program, for use as a git textconv filter.
+
+Block programs are printed the same way as 'mind-meld dump'. Python programs
+are printed as-is. If FILE can't be read, the error is printed instead so that
+'git diff' keeps working.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if err := githooks.TextConv(os.Stdout, args[0], opts); err != nil {
+				fmt.Printf("mind-meld: %s: %v\n", args[0], err)
+			}
+			return nil
+		},
+	}
+	addDumpFlags(cmd, &opts)
+	return cmd
+}
+
+func mkGraphCmd() *cobra.Command {
+	var format string
+	cmd := &cobra.Command{
+		Use:   "graph FILE",
+		Short: "Show which scripts in a block program start each other.",
+		Long: `Show which scripts in a block program start each other.
+
+The graph has a node for each script that starts with a hat block, and for
+each broadcast message and radio signal. Scripts point to the messages that
+they broadcast, messages point to the scripts that receive them, and scripts
+point to the custom blocks that they call.
+
+dot is for Graphviz, e.g. 'mind-meld graph FILE | dot -Tsvg > graph.svg'.
+mermaid can be pasted into a Markdown file on GitHub.
+
+Formats: ` + strings.Join(graph.Formats(), ", "),
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			proj, err := decodeProject(args[0], lmsp.DecodeOptions{Lenient: true})
+			if err != nil {
+				return err
+			}
+			return graph.Build(proj).Write(os.Stdout, format)
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "dot", "how to write the graph")
+	return cmd
+}
+
+func mkLintCmd() *cobra.Command {
+	var opts lint.Options
+	var rules []string
+	for _, r := range lint.Rules() {
+		rules = append(rules, fmt.Sprintf("  %-22s %s", r.ID, r.Description))
+	}
+	cmd := &cobra.Command{
+		Use:   "lint FILE...",
+		Short: "Look for mistakes in block programs.",
+		Long: `Look for mistakes in block programs.
+
+Each problem is printed as FILE:TARGET:BLOCK: MESSAGE (RULE). BLOCK is left
+out for problems that aren't about one block, like a variable that's never
+used. The exit status is 1 if any problems are found.
+
+Rules:
+` + strings.Join(rules, "\n"),
+		Args: cobra.MinimumNArgs(1),
+		// Finding problems isn't a usage error, and finish prints the
+		// error.
+		SilenceUsage:  true,
+		SilenceErrors: true,
 		RunE: func(_ *cobra.Command, args []string) error {
-			return dump(args[0])
+			problems := 0
+			for _, path := range args {
+				proj, err := decodeProject(path, lmsp.DecodeOptions{Lenient: true})
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				diags, err := lint.Lint(proj, opts)
+				if err != nil {
+					return err
+				}
+				for _, d := range diags {
+					fmt.Printf("%s:%s\n", path, d)
+				}
+				problems += len(diags)
+			}
+			if problems > 0 {
+				return fmt.Errorf("%d problem(s) found", problems)
+			}
+			return nil
 		},
 	}
+	cmd.Flags().StringArrayVar(&opts.Disable, "disable", nil, "skip a rule (can be repeated)")
+	return cmd
+}
+
+func mkOpcodesCmd() *cobra.Command {
+	var format, rev string
+	var unhandled bool
+	cmd := &cobra.Command{
+		Use:   "opcodes [PATH...]",
+		Short: "Count the opcodes in block programs, and find the ones that dump doesn't handle.",
+		Long: `Count the opcodes in block programs, and find the ones that dump doesn't handle.
+
+Each PATH is a program file or a dir to search for .lms, .lmsp, .llsp, and
+.llsp3 files. The default is the current dir. With --git, each PATH is a git
+repository, and every version of every program in the history of REV is
+scanned. Copies of a program with the same content are only counted once.
+
+Opcodes that aren't in the opcode catalog are dumped with their inputs and
+fields in alphabetical order. The report shows the JSON of one block for each
+of them, so that they can be added to a catalog file.`,
+		RunE: func(_ *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+			s := coverage.NewScanner()
+			for _, path := range args {
+				var err error
+				if rev != "" {
+					err = s.ScanGit(path, rev)
+				} else {
+					err = s.ScanPath(path)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			report := s.Report()
+			if unhandled {
+				report.Opcodes = report.Unhandled()
+			}
+			return report.Write(os.Stdout, format)
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "text", "text or json")
+	cmd.Flags().StringVar(&rev, "git", "", "scan the history of `REV` in git repositories")
+	cmd.Flags().Lookup("git").NoOptDefVal = "HEAD"
+	cmd.Flags().BoolVar(&unhandled, "unhandled", false, "only list the opcodes that dump doesn't handle")
+	return cmd
 }
 
 func mkPreCommitCmd() *cobra.Command {
 	var cached bool
+	var opts lmsdump.Options
 	cmd := &cobra.Command{
 		Use:    "pre-commit",
 		Args:   cobra.NoArgs,
@@ -79,21 +275,95 @@ func mkPreCommitCmd() *cobra.Command {
 			if cached {
 				mode = githooks.UpdateCache
 			}
-			return githooks.RunPreCommit(mode)
+			return githooks.RunPreCommit(mode, opts)
 		},
 	}
 	cmd.PersistentFlags().BoolVar(&cached, "cached", false, "update index instead of working copy")
+	addDumpFlags(cmd, &opts)
+	return cmd
+}
+
+func mkTranspileCmd() *cobra.Command {
+	var target string
+	cmd := &cobra.Command{
+		Use:   "transpile FILE",
+		Short: "Translate a block program into python for the hub.",
+		Long: `Translate a block program into python for the hub.
+
+Hat blocks become async functions that are all started when the program runs,
+and custom blocks become async functions that the scripts call. Blocks that
+can't be translated are left as TODO comments, or as calls to todo(), so that
+they're easy to find.
+
+spike-python writes python for the SPIKE 2 and MINDSTORMS apps, which import
+from spike or mindstorms. spike3-python writes python for SPIKE App 3, which
+uses runloop. pybricks writes MicroPython for hubs with Pybricks firmware.
+
+Targets: ` + strings.Join(transpile.Targets(), ", "),
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			proj, err := readProject(args[0])
+			if err != nil {
+				return err
+			}
+			return transpile.Transpile(os.Stdout, proj, target)
+		},
+	}
+	cmd.Flags().StringVar(&target, "target", "spike-python", "kind of python to write")
 	return cmd
 }
 
-func mkAppSubcommandCmd(name string, a appcmd.App) *cobra.Command {
+// configuredOpcodes returns the built-in opcode catalog, extended with the
+// catalogs that the config file lists. If the config or a catalog can't be
+// read, it warns and returns the built-in catalog, so that commands like
+// git-diff keep working.
+func configuredOpcodes() *opcodes.Catalog {
+	cfg, err := appcmd.LoadConfig()
+	if err == nil {
+		var c *opcodes.Catalog
+		if c, err = opcodes.LoadFiles(cfg.OpcodeFiles()); err == nil {
+			return c
+		}
+	}
+	fmt.Fprintf(os.Stderr, "mind-meld: warning: %v (using the built-in opcodes)\n", err)
+	return opcodes.Builtin()
+}
+
+func mkAppSubcommandCmd(name string, app appcmd.App) *cobra.Command {
+	a := &appcmd.Configured{App: app, Name: name}
 	subCmd := &cobra.Command{
 		Use:   name,
 		Short: "Manage " + a.FullName() + " programs.",
+		Long: `Manage ` + a.FullName() + ` programs.
+
+Programs are found in the first of these dirs that exists:
+
+  1. Each --project-dir.
+  2. The dirs in $` + a.EnvVar() + `, separated like $PATH.
+  3. The "project_dirs" for "` + name + `" in the config file.
+  4. The usual places that ` + a.FullName() + ` keeps programs, unless the config
+     file has "skip_default_dirs" for "` + name + `".
+
+The config file is JSON, and is read from $MIND_MELD_CONFIG or from
+mind-meld/config.json in the user config dir (~/.config on Linux).`,
+		PersistentPreRunE: func(*cobra.Command, []string) error {
+			// cobra only runs the closest PersistentPreRun, so this has to
+			// set up the opcodes like the root command does.
+			opcodes.SetDefaultFunc(configuredOpcodes)
+
+			cfg, err := appcmd.LoadConfig()
+			if err != nil {
+				return err
+			}
+			a.Config = cfg
+			return nil
+		},
 	}
+	subCmd.PersistentFlags().StringArrayVar(&a.Dirs, "project-dir", nil, "look for programs in this dir (may be repeated)")
 
 	subCmd.AddCommand(mkAppDiffCommand(a))
 	subCmd.AddCommand(mkAppFetchCommand(a))
+	subCmd.AddCommand(mkAppPushCommand(a))
 	subCmd.AddCommand(mkAppWatchCommand(a))
 
 	return subCmd
@@ -102,8 +372,8 @@ func mkAppSubcommandCmd(name string, a appcmd.App) *cobra.Command {
 func mkAppDiffCommand(a appcmd.App) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "diff COMMIT",
-		Short: "Diff python programs from " + a.FullName() + ".",
-		Long: `Diff python programs from ` + a.FullName() + ` against COMMIT.
+		Short: "Diff programs from " + a.FullName() + ".",
+		Long: `Diff programs from ` + a.FullName() + ` against COMMIT.
 
 COMMIT may be a branch name, ref name, commit OID, or anything that
 git-rev-parse can resolve to a commit.`,
@@ -120,11 +390,19 @@ func mkAppFetchCommand(a appcmd.App) *cobra.Command {
 	var opts fetchOpts
 	cmd := &cobra.Command{
 		Use:   "fetch",
-		Short: "Get python programs from " + a.FullName() + ".",
-		Long: `Get python programs from ` + a.FullName() + `.
+		Short: "Get programs from " + a.FullName() + ".",
+		Long: `Get programs from ` + a.FullName() + `.
+
+Python programs are stored as .py files. Block programs are stored as a text
+rendering in .blocks.txt files. When --project-json is specified, the raw
+project.json of each block program is also stored in a .project.json file.
+When --originals is specified, a copy of each program file is stored in
+.mind-meld/originals, so that it can be restored into the app.
 
 When --git is specified, the programs are stored as a new commit on the given
-branch or ref.
+branch or ref. Unless --message is given, the commit message lists the programs
+that were added, changed and removed. Add --commit-per-program to make a commit
+for each program that changed instead, dated when the program was last saved.
 
 When --dir is specified, the programs are stored in the given directory.`,
 		Args: cobra.NoArgs,
@@ -134,7 +412,7 @@ When --dir is specified, the programs are stored in the given directory.`,
 				return err
 			}
 
-			if msg, err := fetch.Run(a, target); err != nil {
+			if msg, err := fetch.Run(a, target, opts.FetchOptions()); err != nil {
 				fmt.Printf("error:%v\n", err)
 			} else {
 				fmt.Printf("%s.\n", msg)
@@ -143,7 +421,52 @@ When --dir is specified, the programs are stored in the given directory.`,
 			return nil
 		},
 	}
-	opts.AddFlags(cmd, a)
+	opts.AddFlags(cmd)
+	return cmd
+}
+
+func mkAppPushCommand(a appcmd.App) *cobra.Command {
+	var gitRef, dir string
+	cmd := &cobra.Command{
+		Use:   "push",
+		Short: "Put python programs back into " + a.FullName() + ".",
+		Long: `Put python programs back into ` + a.FullName() + `.
+
+Each .py file replaces the program in the matching ` + a.FullName() + ` program file,
+using the same names that 'fetch' uses. A .py file that doesn't match any
+program is added as a new python program. Block programs are never changed.
+
+When --git is specified, the programs are read from the given commit in the
+current git repository.
+
+When --dir is specified, the programs are read from the given directory.
+
+Close ` + a.FullName() + ` before pushing, so that it doesn't overwrite the changes.`,
+		Args: cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			var src push.Source
+			switch {
+			case gitRef != "" && dir != "":
+				return fmt.Errorf("only one of --git and --dir may be specified")
+			case gitRef != "":
+				src = push.GitSource{Ref: gitRef}
+			case dir != "":
+				src = push.DirSource(dir)
+			default:
+				return fmt.Errorf("one of --git and --dir must be specified")
+			}
+
+			if msg, err := push.Run(a, src); err != nil {
+				fmt.Printf("error:%v\n", err)
+			} else {
+				fmt.Printf("%s.\n", msg)
+			}
+
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&gitRef, "git", "", "push programs from the given commit in the current git repository")
+	cmd.Flags().StringVar(&dir, "dir", "", "push programs from the given directory")
 	return cmd
 }
 
@@ -151,7 +474,7 @@ func mkAppWatchCommand(a appcmd.App) *cobra.Command {
 	var opts fetchOpts
 	cmd := &cobra.Command{
 		Use:   "watch",
-		Short: "Continuously fetch python programs from " + a.FullName() + ".",
+		Short: "Continuously fetch programs from " + a.FullName() + ".",
 		Args:  cobra.NoArgs,
 		RunE: func(*cobra.Command, []string) error {
 			ctx := context.Background()
@@ -163,24 +486,40 @@ func mkAppWatchCommand(a appcmd.App) *cobra.Command {
 				return err
 			}
 
-			return watch.Run(ctx, a, target)
+			return watch.Run(ctx, a, target, opts.FetchOptions())
 		},
 	}
-	opts.AddFlags(cmd, a)
+	opts.AddFlags(cmd)
 	return cmd
 }
 
 type fetchOpts struct {
-	GitRef        string
-	CommitMessage string
+	GitRef           string
+	CommitMessage    string
+	CommitPerProgram bool
 
-	Dir string
+	Dir   string
+	Trash string
+
+	ProjectJSON bool
+	Originals   bool
 }
 
-func (f *fetchOpts) AddFlags(cmd *cobra.Command, app appcmd.App) {
+func (f *fetchOpts) AddFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&f.GitRef, "git", "", "fetch to the given ref in the current git repository")
 	cmd.Flags().StringVar(&f.Dir, "dir", "", "fetch to the given directory")
-	cmd.Flags().StringVarP(&f.CommitMessage, "message", "m", "Update copy of "+app.FullName()+" python programs", "commit message (when using --git)")
+	cmd.Flags().StringVar(&f.Trash, "trash", "", "move the files of deleted programs to this directory instead of removing them (when using --dir)")
+	cmd.Flags().StringVarP(&f.CommitMessage, "message", "m", "", "commit message (when using --git, default is a summary of the changes)")
+	cmd.Flags().BoolVar(&f.CommitPerProgram, "commit-per-program", false, "make a commit for each changed program, dated when it was last saved (when using --git)")
+	cmd.Flags().BoolVar(&f.ProjectJSON, "project-json", false, "also store the raw project.json of block programs")
+	cmd.Flags().BoolVar(&f.Originals, "originals", false, "also store a copy of each program file in .mind-meld/originals")
+}
+
+func (f fetchOpts) FetchOptions() fetch.Options {
+	return fetch.Options{
+		ProjectJSON: f.ProjectJSON,
+		Originals:   f.Originals,
+	}
 }
 
 func (f fetchOpts) MakeTarget() (fetch.Target, error) {
@@ -189,11 +528,12 @@ func (f fetchOpts) MakeTarget() (fetch.Target, error) {
 		return nil, fmt.Errorf("only one of --git and --dir may be specified")
 	case f.GitRef != "":
 		return fetch.GitTarget{
-			Ref:           f.GitRef,
-			CommitMessage: f.CommitMessage,
+			Ref:              f.GitRef,
+			CommitMessage:    f.CommitMessage,
+			CommitPerProgram: f.CommitPerProgram,
 		}, nil
 	case f.Dir != "":
-		return fetch.DirTarget(f.Dir), nil
+		return fetch.DirTarget{Dir: f.Dir, Trash: f.Trash}, nil
 	default:
 		return nil, fmt.Errorf("one of --git and --dir must be specified")
 	}
@@ -206,32 +546,92 @@ func finish(err error) {
 	}
 }
 
-func dump(path string) error {
+func readProject(path string) (lmsp.Project, error) {
+	return decodeProject(path, lmsp.DecodeOptions{})
+}
+
+// decodeProject reads the project in a program file. Any blocks that are
+// skipped in lenient mode are reported on stderr.
+func decodeProject(path string, opts lmsp.DecodeOptions) (lmsp.Project, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return lmsp.Project{}, err
 	}
+	defer f.Close()
+
 	l, err := lmsp.ReadFile(f)
 	if err != nil {
-		return err
+		return lmsp.Project{}, err
 	}
-	/*
-		man, err := l.Manifest()
-		if err != nil {
-			return err
+
+	proj, problems, err := l.DecodeProject(opts)
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "%s: warning: %v\n", path, p)
+	}
+	return proj, err
+}
+
+func readManifest(path string) (lmsp.Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return lmsp.Manifest{}, err
+	}
+	defer f.Close()
+
+	l, err := lmsp.ReadFile(f)
+	if err != nil {
+		return lmsp.Manifest{}, err
+	}
+	return l.Manifest()
+}
+
+func blockDiff(oldPath, newPath string) error {
+	oldProj, err := readProject(oldPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", oldPath, err)
+	}
+	newProj, err := readProject(newPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", newPath, err)
+	}
+
+	changes := blockdiff.Compare(oldProj, newProj)
+	if len(changes) == 0 {
+		fmt.Println("no changes")
+		return nil
+	}
+
+	target := ""
+	for i, c := range changes {
+		if i == 0 || c.Target != target {
+			target = c.Target
+			fmt.Printf("target: %s\n", target)
 		}
-		spew.Dump(man)
-	*/
+		fmt.Printf("  %s\n", c)
+	}
+	return nil
+}
 
-	proj, err := l.Project()
+func dump(path, format string, opts lmsdump.Options) error {
+	proj, err := decodeProject(path, lmsp.DecodeOptions{Lenient: true})
 	if err != nil {
 		return err
 	}
-	lmsdump.Dump(os.Stdout, proj)
+	if man, err := readManifest(path); err == nil {
+		opts.Manifest = &man
+	}
+	if format == "text" {
+		opts.Dump(os.Stdout, proj)
+	} else {
+		tree := lmstree.Build(proj, lmstree.Options{OmitBlockIDs: opts.OmitBlockIDs, Manifest: opts.Manifest})
+		if err := lmstree.Write(os.Stdout, tree, format); err != nil {
+			return err
+		}
+	}
 
 	if os.Getenv("WRITE_PROJECT_JSON") != "" {
 		log.Print("writing JSON back out to 'testing.json'...")
-		f, err = os.Create("testing.json")
+		f, err := os.Create("testing.json")
 		if err != nil {
 			return err
 		}
@@ -241,7 +641,5 @@ func dump(path string) error {
 		}
 	}
 
-	// todo later - print out programs in pybricks
-
 	return nil
 }
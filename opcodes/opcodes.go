@@ -0,0 +1,304 @@
+// Package opcodes is a catalog of the blocks that can be in a program: what
+// each opcode is called, what its arguments are, what shape the block is, and
+// which family of apps it comes from. The catalog is built in, and it can be
+// extended with the user's own files, so a new extension's blocks only need
+// new data.
+package opcodes
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// Shape is how a block looks, and so where it can go in a script.
+type Shape string
+
+const (
+	// Hat blocks start scripts.
+	Hat Shape = "hat"
+	// Stack blocks go one after another in a script.
+	Stack Shape = "stack"
+	// C blocks are stack blocks that hold other blocks, like loops.
+	C Shape = "c"
+	// Reporter blocks go in inputs, and have a value.
+	Reporter Shape = "reporter"
+	// Boolean blocks go in inputs, and are true or false.
+	Boolean Shape = "boolean"
+)
+
+var shapes = map[Shape]bool{Hat: true, Stack: true, C: true, Reporter: true, Boolean: true}
+
+// ArgKind is where an argument's value comes from.
+type ArgKind string
+
+const (
+	// InputArg is an input, which can hold a value or another block.
+	InputArg ArgKind = "input"
+	// FieldArg is a field, like a dropdown, which holds a value.
+	FieldArg ArgKind = "field"
+	// FieldInputArg is a field that's the unit of an input, like
+	// "rotations" in "run for 1 rotations".
+	FieldInputArg ArgKind = "field+input"
+)
+
+// Entry describes one opcode.
+type Entry struct {
+	Opcode lmsp.ProjectOpcode `json:"-"`
+
+	// Name is what the block is called in a dump, like "stopMotor". A
+	// block without a name, like a menu, is shown as just its arguments.
+	Name string `json:"name"`
+
+	Shape Shape `json:"shape"`
+
+	// Family is the group of apps that have the block. Scratch's own
+	// blocks are "scratch", blocks that the LEGO apps add are "lego", and
+	// blocks that only SPIKE App 3 has are "spike3".
+	Family string `json:"family"`
+
+	// Waits is true for blocks that take time to finish, like "wait 1
+	// seconds" or "run for 1 rotations", which gives other scripts a chance
+	// to run.
+	Waits bool `json:"waits,omitempty"`
+
+	// Builtin is true for the entries in mind-meld's own catalog, as opposed
+	// to the ones from the user's catalog files.
+	Builtin bool `json:"-"`
+
+	// Args are the block's inputs and fields, in the order they're shown.
+	Args []Arg `json:"args,omitempty"`
+}
+
+// Arg is one of a block's arguments.
+type Arg struct {
+	Kind ArgKind `json:"kind"`
+
+	// Input is the input's name, for InputArg and FieldInputArg.
+	Input lmsp.ProjectInputID `json:"input,omitempty"`
+	// Field is the field's name, for FieldArg and FieldInputArg.
+	Field lmsp.ProjectFieldName `json:"field,omitempty"`
+
+	// Label is shown before the argument's value. If it isn't in the
+	// catalog file, it's the input or field name in lower case. An empty
+	// label isn't shown. A FieldInputArg is labeled with its field's value
+	// instead.
+	Label string `json:"label"`
+
+	// Required is true for inputs that the app leaves out of the block's
+	// JSON when they're empty, instead of writing an empty value.
+	Required bool `json:"required,omitempty"`
+
+	// Values maps a field's values to what's shown for them, for fields
+	// whose values are codes, like "1" for "brake".
+	Values map[string]string `json:"values,omitempty"`
+}
+
+func (a *Arg) UnmarshalJSON(data []byte) error {
+	type rawArg Arg
+	var raw struct {
+		rawArg
+		Label *string `json:"label"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*a = Arg(raw.rawArg)
+	switch {
+	case raw.Label != nil:
+		a.Label = *raw.Label
+	case a.Kind == FieldArg:
+		a.Label = strings.ToLower(string(a.Field))
+	default:
+		a.Label = strings.ToLower(string(a.Input))
+	}
+	return nil
+}
+
+// Catalog is a set of opcodes.
+type Catalog struct {
+	entries map[lmsp.ProjectOpcode]Entry
+}
+
+// Parse reads a catalog file. The file is a JSON object, with an entry for
+// each opcode. For example:
+//
+//	{
+//	  "flippermotor_motorStop": {
+//	    "name": "stopMotor",
+//	    "shape": "stack",
+//	    "family": "lego",
+//	    "args": [{"kind": "input", "input": "PORT"}]
+//	  }
+//	}
+func Parse(data []byte) (*Catalog, error) {
+	var entries map[lmsp.ProjectOpcode]Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for opcode, e := range entries {
+		e.Opcode = opcode
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", opcode, err)
+		}
+		entries[opcode] = e
+	}
+	return &Catalog{entries: entries}, nil
+}
+
+func (e Entry) validate() error {
+	if !shapes[e.Shape] {
+		return fmt.Errorf("unknown shape %q", e.Shape)
+	}
+	for i, a := range e.Args {
+		switch a.Kind {
+		case InputArg:
+			if a.Input == "" {
+				return fmt.Errorf("arg %d: input is missing", i)
+			}
+		case FieldArg:
+			if a.Field == "" {
+				return fmt.Errorf("arg %d: field is missing", i)
+			}
+		case FieldInputArg:
+			if a.Input == "" || a.Field == "" {
+				return fmt.Errorf("arg %d: field and input are both needed", i)
+			}
+		default:
+			return fmt.Errorf("arg %d: unknown kind %q", i, a.Kind)
+		}
+	}
+	return nil
+}
+
+// Load reads a catalog file from disk.
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Lookup finds an opcode in the catalog.
+func (c *Catalog) Lookup(opcode lmsp.ProjectOpcode) (Entry, bool) {
+	e, ok := c.entries[opcode]
+	return e, ok
+}
+
+// Entries returns all of the catalog's entries, ordered by opcode.
+func (c *Catalog) Entries() []Entry {
+	res := make([]Entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Opcode < res[j].Opcode })
+	return res
+}
+
+// Extend returns a catalog with the entries from c and other. Where they both
+// have an opcode, other's entry is used.
+func (c *Catalog) Extend(other *Catalog) *Catalog {
+	entries := make(map[lmsp.ProjectOpcode]Entry, len(c.entries)+len(other.entries))
+	for opcode, e := range c.entries {
+		entries[opcode] = e
+	}
+	for opcode, e := range other.entries {
+		entries[opcode] = e
+	}
+	return &Catalog{entries: entries}
+}
+
+//go:embed opcodes.json
+var builtinData []byte
+
+var (
+	builtinOnce sync.Once
+	builtin     *Catalog
+
+	defaultMu sync.Mutex
+	current   *Catalog
+	loader    func() *Catalog
+)
+
+// Builtin returns the catalog that's built in to mind-meld.
+func Builtin() *Catalog {
+	builtinOnce.Do(func() {
+		c, err := Parse(builtinData)
+		if err != nil {
+			panic("opcodes.json: " + err.Error())
+		}
+		for opcode, e := range c.entries {
+			e.Builtin = true
+			c.entries[opcode] = e
+		}
+		builtin = c
+	})
+	return builtin
+}
+
+// Default returns the catalog that dumps use. It's the built-in catalog unless
+// SetDefault or SetDefaultFunc has been called.
+func Default() *Catalog {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if current == nil && loader != nil {
+		current = loader()
+		loader = nil
+	}
+	if current == nil {
+		return Builtin()
+	}
+	return current
+}
+
+// SetDefault changes the catalog that Default returns.
+func SetDefault(c *Catalog) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	current = c
+	loader = nil
+}
+
+// SetDefaultFunc makes Default call load the first time it's needed, and
+// return the catalog that load returns from then on. Commands that never look
+// at an opcode don't have to read any catalog files.
+func SetDefaultFunc(load func() *Catalog) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	current = nil
+	loader = load
+}
+
+// IsHat is true if block starts a script. Blocks that aren't in the default
+// catalog are hats if they look like one, like "when ...".
+func IsHat(block *lmsp.ProjectBlockObject) bool {
+	if e, ok := Default().Lookup(block.Opcode); ok {
+		return e.Shape == Hat
+	}
+	return block.IsHat()
+}
+
+// LoadFiles returns the built-in catalog, extended with each of the files in
+// paths.
+func LoadFiles(paths []string) (*Catalog, error) {
+	c := Builtin()
+	for _, path := range paths {
+		more, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		c = c.Extend(more)
+	}
+	return c, nil
+}
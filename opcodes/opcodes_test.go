@@ -0,0 +1,126 @@
+package opcodes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+func TestBuiltin(t *testing.T) {
+	entry, ok := Builtin().Lookup("flippermotor_motorTurnForDirection")
+	require.True(t, ok)
+	assert.Equal(t, Entry{
+		Opcode:  "flippermotor_motorTurnForDirection",
+		Name:    "run",
+		Shape:   Stack,
+		Family:  "lego",
+		Waits:   true,
+		Builtin: true,
+		Args: []Arg{
+			{Kind: InputArg, Input: "PORT", Label: "port"},
+			{Kind: InputArg, Input: "DIRECTION", Label: "direction"},
+			{Kind: FieldInputArg, Field: "UNIT", Input: "VALUE", Label: "value"},
+		},
+	}, entry)
+
+	entry, ok = Builtin().Lookup("flipperevents_whenProgramStarts")
+	require.True(t, ok)
+	assert.Equal(t, Hat, entry.Shape)
+
+	_, ok = Builtin().Lookup("ev3motor_motorStop")
+	assert.False(t, ok)
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(`{
+	  "ev3motor_motorStop": {"name": "stopMotor", "shape": "stack", "family": "ev3", "waits": true, "args": [
+	    {"kind": "input", "input": "PORT", "required": true},
+	    {"kind": "field", "field": "STOP", "values": {"1": "brake"}},
+	    {"kind": "input", "input": "SPEED", "label": ""}
+	  ]}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{{
+		Opcode: "ev3motor_motorStop",
+		Name:   "stopMotor",
+		Shape:  Stack,
+		Family: "ev3",
+		Waits:  true,
+		Args: []Arg{
+			{Kind: InputArg, Input: "PORT", Label: "port", Required: true},
+			{Kind: FieldArg, Field: "STOP", Label: "stop", Values: map[string]string{"1": "brake"}},
+			{Kind: InputArg, Input: "SPEED"},
+		},
+	}}, c.Entries())
+
+	_, err = Parse([]byte(`{"x_y": {"name": "y", "shape": "round"}}`))
+	assert.EqualError(t, err, `x_y: unknown shape "round"`)
+
+	_, err = Parse([]byte(`{"x_y": {"name": "y", "shape": "stack", "args": [{"kind": "field+input", "input": "VALUE"}]}}`))
+	assert.EqualError(t, err, `x_y: arg 0: field and input are both needed`)
+}
+
+func TestExtend(t *testing.T) {
+	more, err := Parse([]byte(`{
+	  "flippermotor_motorStop": {"name": "halt", "shape": "stack", "family": "lego"},
+	  "ev3motor_motorStop": {"name": "stopMotor", "shape": "stack", "family": "ev3"}
+	}`))
+	require.NoError(t, err)
+
+	c := Builtin().Extend(more)
+	entry, _ := c.Lookup("flippermotor_motorStop")
+	assert.Equal(t, "halt", entry.Name)
+	assert.False(t, entry.Builtin)
+	_, ok := c.Lookup("ev3motor_motorStop")
+	assert.True(t, ok)
+	_, ok = c.Lookup("flippermotor_speed")
+	assert.True(t, ok)
+
+	entry, _ = Builtin().Lookup("flippermotor_motorStop")
+	assert.Equal(t, "stopMotor", entry.Name)
+	assert.True(t, entry.Builtin)
+}
+
+func TestSetDefaultFunc(t *testing.T) {
+	defer SetDefault(nil)
+
+	more, err := Parse([]byte(`{"ev3motor_motorStop": {"name": "stopMotor", "shape": "stack", "family": "ev3"}}`))
+	require.NoError(t, err)
+	calls := 0
+	SetDefaultFunc(func() *Catalog {
+		calls++
+		return Builtin().Extend(more)
+	})
+	assert.Equal(t, 0, calls)
+
+	_, ok := Default().Lookup("ev3motor_motorStop")
+	assert.True(t, ok)
+	Default()
+	assert.Equal(t, 1, calls)
+
+	SetDefault(nil)
+	assert.Same(t, Builtin(), Default())
+}
+
+func TestIsHat(t *testing.T) {
+	defer SetDefault(nil)
+
+	assert.True(t, IsHat(&lmsp.ProjectBlockObject{Opcode: "flipperevents_whenProgramStarts"}))
+	assert.True(t, IsHat(&lmsp.ProjectBlockObject{Opcode: "procedures_definition"}))
+	assert.False(t, IsHat(&lmsp.ProjectBlockObject{Opcode: "flippermotor_motorStop"}))
+	// Blocks that aren't in the catalog are hats if they look like one.
+	assert.True(t, IsHat(&lmsp.ProjectBlockObject{Opcode: "ev3events_whenProgramStarts"}))
+	assert.False(t, IsHat(&lmsp.ProjectBlockObject{Opcode: "ev3motor_motorStop"}))
+
+	more, err := Parse([]byte(`{
+	  "ev3events_whenProgramStarts": {"name": "start", "shape": "stack", "family": "ev3"},
+	  "ev3events_onButton": {"name": "onButton", "shape": "hat", "family": "ev3"}
+	}`))
+	require.NoError(t, err)
+	SetDefault(Builtin().Extend(more))
+	assert.False(t, IsHat(&lmsp.ProjectBlockObject{Opcode: "ev3events_whenProgramStarts"}))
+	assert.True(t, IsHat(&lmsp.ProjectBlockObject{Opcode: "ev3events_onButton"}))
+}
@@ -0,0 +1,565 @@
+package transpile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// pybricks writes MicroPython for hubs that run Pybricks firmware. Scripts
+// run together with multitask.
+//
+// https://docs.pybricks.com/
+type pybricks struct{}
+
+func (pybricks) header() string {
+	return `# Translated from blocks by mind-meld.
+from pybricks.hubs import PrimeHub
+from pybricks.parameters import Button, Color, Direction, Port, Side
+from pybricks.pupdevices import ColorSensor, ForceSensor, Motor, UltrasonicSensor
+from pybricks.robotics import DriveBase
+from pybricks.tools import Matrix, StopWatch, multitask, run_task, wait
+import umath as math
+import urandom as random
+
+hub = PrimeHub()
+timer = StopWatch()
+devices = {}
+motor_speeds = {}
+movement = {"speed": 50, "cm_per_rotation": 17.5, "pair": (Port.A, Port.B), "base": None}
+
+# DriveBase needs the distance between the wheels, in mm. Change this to match
+# your robot.
+AXLE_TRACK = 112
+
+
+# Blocks use percent for speeds, but Pybricks uses degrees per second.
+def velocity(percent):
+    return percent * 10
+
+
+def note_frequency(note):
+    return int(440 * 2 ** ((note - 69) / 12))
+
+
+def device(kind, port):
+    if port not in devices:
+        devices[port] = kind(port)
+    return devices[port]
+
+
+def drive_base():
+    if movement["base"] is None:
+        left, right = movement["pair"]
+        if left not in devices:
+            devices[left] = Motor(left, Direction.COUNTERCLOCKWISE)
+        wheel_diameter = movement["cm_per_rotation"] * 10 / math.pi
+        movement["base"] = DriveBase(devices[left], device(Motor, right), wheel_diameter, AXLE_TRACK)
+    return movement["base"]
+
+
+# The movement speed, in mm per second.
+def drive_speed():
+    return velocity(movement["speed"]) * movement["cm_per_rotation"] * 10 / 360
+`
+}
+
+func (pybricks) names() []string {
+	return []string{
+		"PrimeHub", "Button", "Color", "Direction", "Port", "Side",
+		"ColorSensor", "ForceSensor", "Motor", "UltrasonicSensor", "DriveBase",
+		"Matrix", "StopWatch", "multitask", "run_task", "wait", "math", "random",
+		"hub", "timer", "devices", "motor_speeds", "movement", "AXLE_TRACK",
+		"velocity", "note_frequency", "device", "drive_base", "drive_speed",
+	}
+}
+
+func (pybricks) sleep(ms string) string {
+	return fmt.Sprintf("await wait(%s)", ms)
+}
+
+func (pybricks) waitUntil(g *gen, cond string) {
+	g.line("while not %s:", atom(cond))
+	g.indent++
+	g.line("await wait(10)")
+	g.indent--
+}
+
+func (pybricks) run(g *gen, scripts []string) {
+	calls := make([]string, 0, len(scripts))
+	for _, s := range scripts {
+		calls = append(calls, s+"()")
+	}
+	g.line("run_task(multitask(%s))", strings.Join(calls, ", "))
+}
+
+func (p pybricks) statement(g *gen, block *lmsp.ProjectBlockObject) bool {
+	switch block.Opcode {
+	case "flippermotor_motorSetSpeed":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		for _, port := range ports {
+			g.line("motor_speeds[Port.%s] = %s", port, g.input(block, "SPEED"))
+		}
+		return true
+
+	case "flippermotor_motorStartDirection":
+		ports, ok := g.ports(block, "PORT")
+		dir, dirOK := g.menu(block, "DIRECTION")
+		if !ok || !dirOK {
+			return false
+		}
+		for _, port := range ports {
+			g.line("%s.run(%s)", pbMotor(port), direction(pbMotorVelocity(port), dir))
+		}
+		return true
+
+	case "flippermotor_motorStop":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		for _, port := range ports {
+			g.line("%s.stop()", pbMotor(port))
+		}
+		return true
+
+	case "flippermotor_motorTurnForDirection":
+		ports, ok := g.ports(block, "PORT")
+		dir, dirOK := g.menu(block, "DIRECTION")
+		if !ok || !dirOK {
+			return false
+		}
+		return p.motorRunFor(g, block, ports, func(port string) string {
+			return direction(pbMotorVelocity(port), dir)
+		})
+
+	case "flippermotor_motorGoDirectionToPosition":
+		ports, ok := g.ports(block, "PORT")
+		if !ok || g.field(block, "DIRECTION") != "shortest" {
+			return false
+		}
+		pos := g.input(block, "POSITION")
+		for i, port := range ports {
+			g.line("%s%s.run_target(%s, %s%s)", await(i, ports), pbMotor(port), pbMotorVelocity(port), pos, noWait(i, ports))
+		}
+		return true
+
+	case "flippermoremotor_motorStartSpeed":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		for _, port := range ports {
+			g.line("%s.run(velocity(%s))", pbMotor(port), g.input(block, "SPEED"))
+		}
+		return true
+
+	case "flippermoremotor_motorStartPower":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		for _, port := range ports {
+			g.line("%s.dc(%s)", pbMotor(port), g.input(block, "POWER"))
+		}
+		return true
+
+	case "flippermoremotor_motorTurnForSpeed":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		speed := fmt.Sprintf("velocity(%s)", g.input(block, "SPEED"))
+		return p.motorRunFor(g, block, ports, func(string) string { return speed })
+
+	case "flippermoremotor_motorGoToRelativePosition":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		pos := g.input(block, "POSITION")
+		speed := g.input(block, "SPEED")
+		for i, port := range ports {
+			g.line("%s%s.run_target(velocity(%s), %s%s)", await(i, ports), pbMotor(port), speed, pos, noWait(i, ports))
+		}
+		return true
+
+	case "flippermoremotor_motorSetDegreeCounted":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		for _, port := range ports {
+			g.line("%s.reset_angle(%s)", pbMotor(port), g.input(block, "VALUE"))
+		}
+		return true
+
+	case "flippermove_setMovementPair":
+		ports, ok := g.ports(block, "PAIR")
+		if !ok || len(ports) != 2 {
+			return false
+		}
+		g.line(`movement["pair"] = (Port.%s, Port.%s)`, ports[0], ports[1])
+		g.line(`movement["base"] = None`)
+		return true
+
+	case "flippermove_movementSpeed":
+		g.line(`movement["speed"] = %s`, g.input(block, "SPEED"))
+		return true
+
+	case "flippermove_setDistance":
+		dist := g.input(block, "DISTANCE")
+		switch g.field(block, "UNIT") {
+		case "cm":
+		case "in":
+			dist = scale(dist, 2.54)
+		default:
+			return false
+		}
+		g.line(`movement["cm_per_rotation"] = %s`, dist)
+		g.line(`movement["base"] = None`)
+		return true
+
+	case "flippermove_move":
+		dir, ok := g.menu(block, "DIRECTION")
+		if !ok {
+			return false
+		}
+		switch dir {
+		case "forward":
+			return p.straight(g, block, false)
+		case "back":
+			return p.straight(g, block, true)
+		}
+		return false
+
+	case "flippermove_steer":
+		if steering, ok := parseNumber(g.input(block, "STEERING")); !ok || steering != 0 {
+			return false
+		}
+		return p.straight(g, block, false)
+
+	case "flippermove_startSteer":
+		if steering, ok := parseNumber(g.input(block, "STEERING")); !ok || steering != 0 {
+			return false
+		}
+		g.line("drive_base().drive(drive_speed(), 0)")
+		return true
+
+	case "flippermove_stopMove":
+		g.line("drive_base().stop()")
+		return true
+
+	case "flipperdisplay_displayOff":
+		g.line("hub.display.off()")
+		return true
+
+	case "flipperdisplay_ledText":
+		g.line("await hub.display.text(str(%s))", g.input(block, "TEXT"))
+		return true
+
+	case "flipperdisplay_ledImage":
+		matrix, ok := p.matrix(g, block)
+		if !ok {
+			return false
+		}
+		g.line("hub.display.icon(%s)", matrix)
+		return true
+
+	case "flipperdisplay_ledImageFor":
+		matrix, ok := p.matrix(g, block)
+		if !ok {
+			return false
+		}
+		g.line("hub.display.icon(%s)", matrix)
+		g.line("%s", p.sleep(millis(g.input(block, "VALUE"))))
+		g.line("hub.display.off()")
+		return true
+
+	case "flipperdisplay_ledOn":
+		g.line("hub.display.pixel(%s, %s, %s)",
+			addConst(intExpr(g.input(block, "Y")), -1),
+			addConst(intExpr(g.input(block, "X")), -1),
+			g.input(block, "BRIGHTNESS"))
+		return true
+
+	case "flipperdisplay_ultrasonicLightUp":
+		ports, ok := g.ports(block, "PORT")
+		lights, lightsOK := g.menu(block, "VALUE")
+		if !ok || !lightsOK {
+			return false
+		}
+		for _, port := range ports {
+			g.line("device(UltrasonicSensor, Port.%s).lights.on([%s])", port, strings.Join(strings.Fields(lights), ", "))
+		}
+		return true
+
+	case "flippersound_beepForTime":
+		g.line("await hub.speaker.beep(note_frequency(%s), %s)", g.input(block, "NOTE"), millis(g.input(block, "DURATION")))
+		return true
+
+	case "flippersensors_resetYaw":
+		g.line("hub.imu.reset_heading(0)")
+		return true
+
+	case "flippersensors_resetTimer":
+		g.line("timer.reset()")
+		return true
+	}
+	return false
+}
+
+// motorRunFor writes a block that runs motors for some rotations, degrees, or
+// seconds. All of the motors start together, and the block waits for the
+// last one.
+func (pybricks) motorRunFor(g *gen, block *lmsp.ProjectBlockObject, ports []string, speed func(port string) string) bool {
+	value := g.input(block, "VALUE")
+	var fn, amount string
+	switch g.field(block, "UNIT") {
+	case "rotations":
+		fn, amount = "run_angle", scale(value, 360)
+	case "degrees":
+		fn, amount = "run_angle", value
+	case "seconds":
+		fn, amount = "run_time", millis(value)
+	default:
+		return false
+	}
+	for i, port := range ports {
+		g.line("%s%s.%s(%s, %s%s)", await(i, ports), pbMotor(port), fn, speed(port), amount, noWait(i, ports))
+	}
+	return true
+}
+
+// straight writes a movement block that drives straight for a distance.
+func (p pybricks) straight(g *gen, block *lmsp.ProjectBlockObject, back bool) bool {
+	value := g.input(block, "VALUE")
+	var mm string
+	switch g.field(block, "UNIT") {
+	case "cm":
+		mm = scale(value, 10)
+	case "in":
+		mm = scale(value, 25.4)
+	case "rotations":
+		mm = fmt.Sprintf(`%s * movement["cm_per_rotation"] * 10`, atom(value))
+	case "degrees":
+		mm = fmt.Sprintf(`%s * movement["cm_per_rotation"] * 10 / 360`, atom(value))
+	case "seconds":
+		speed := "drive_speed()"
+		if back {
+			speed = negate(speed)
+		}
+		g.line("drive_base().drive(%s, 0)", speed)
+		g.line("%s", p.sleep(millis(value)))
+		g.line("drive_base().stop()")
+		return true
+	default:
+		return false
+	}
+	if back {
+		mm = negate(mm)
+	}
+	g.line("drive_base().settings(straight_speed=drive_speed())")
+	g.line("await drive_base().straight(%s)", mm)
+	return true
+}
+
+// matrix converts the image in a MATRIX input, like "9909...", to a Matrix of
+// brightnesses.
+func (pybricks) matrix(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	image, ok := g.menu(block, "MATRIX")
+	if !ok || len(image) != 25 {
+		return "", false
+	}
+	var rows []string
+	for row := 0; row < 5; row++ {
+		var pixels []string
+		for _, r := range image[row*5 : row*5+5] {
+			if r < '0' || r > '9' {
+				return "", false
+			}
+			pixels = append(pixels, fmt.Sprint((int(r-'0')*100+4)/9))
+		}
+		rows = append(rows, "["+strings.Join(pixels, ", ")+"]")
+	}
+	return "Matrix([" + strings.Join(rows, ", ") + "])", true
+}
+
+func (p pybricks) expression(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	switch block.Opcode {
+	case "flippermotor_absolutePosition":
+		return onePort(g, block, "(device(Motor, Port.%s).angle() %% 360)")
+	case "flippermotor_speed":
+		return onePort(g, block, "(device(Motor, Port.%s).speed() / 10)")
+	case "flippermoremotor_position":
+		return onePort(g, block, "device(Motor, Port.%s).angle()")
+
+	case "flippersensors_isColor":
+		return p.isColor(g, block, "VALUE")
+	case "flippersensors_reflectivity":
+		return onePort(g, block, "device(ColorSensor, Port.%s).reflection()")
+	case "flippersensors_isReflectivity":
+		reflection, ok := onePort(g, block, "device(ColorSensor, Port.%s).reflection()")
+		if !ok {
+			return "", false
+		}
+		return compare(reflection, g.field(block, "COMPARATOR"), g.input(block, "VALUE"))
+	case "flippersensors_distance":
+		return p.distance(g, block)
+	case "flippersensors_isDistance":
+		return p.isDistance(g, block)
+
+	case "flippersensors_buttonIsPressed":
+		return p.button(g, block)
+	case "flippersensors_orientationAxis":
+		switch g.field(block, "AXIS") {
+		case "yaw":
+			return "hub.imu.heading()", true
+		case "pitch":
+			return "hub.imu.tilt()[0]", true
+		case "roll":
+			return "hub.imu.tilt()[1]", true
+		}
+	case "flippersensors_isorientation":
+		return p.isUp(g, block, "ORIENTATION")
+	case "flippersensors_timer":
+		return "(timer.time() / 1000)", true
+
+	case "flippermoresensors_force":
+		switch g.field(block, "UNIT") {
+		case "newton":
+			return onePort(g, block, "device(ForceSensor, Port.%s).force()")
+		case "%":
+			return onePort(g, block, "(device(ForceSensor, Port.%s).force() * 10)")
+		}
+	case "flippermoresensors_isPressed":
+		return p.isPressed(g, block)
+	}
+	return "", false
+}
+
+func (p pybricks) hatCondition(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	switch block.Opcode {
+	case "flipperevents_whenButton":
+		return p.button(g, block)
+	case "flipperevents_whenColor":
+		return p.isColor(g, block, "OPTION")
+	case "flipperevents_whenCondition":
+		return g.input(block, "CONDITION"), true
+	case "flipperevents_whenDistance":
+		return p.isDistance(g, block)
+	case "flipperevents_whenOrientation":
+		return p.isUp(g, block, "VALUE")
+	case "flipperevents_whenPressed":
+		return p.isPressed(g, block)
+	case "flipperevents_whenTimer":
+		return fmt.Sprintf("(timer.time() / 1000) > %s", g.input(block, "VALUE")), true
+	}
+	return "", false
+}
+
+// pbColors are the Pybricks versions of the colors in color selectors.
+var pbColors = map[string]string{
+	"-1": "Color.NONE",
+	"0":  "Color.BLACK",
+	"1":  "Color.MAGENTA",
+	"3":  "Color.BLUE",
+	"4":  "Color.CYAN",
+	"6":  "Color.GREEN",
+	"7":  "Color.YELLOW",
+	"9":  "Color.RED",
+	"10": "Color.WHITE",
+}
+
+func (pybricks) isColor(g *gen, block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID) (string, bool) {
+	value, ok := g.menu(block, input)
+	if !ok {
+		return "", false
+	}
+	color, ok := pbColors[value]
+	if !ok {
+		return "", false
+	}
+	sensor, ok := onePort(g, block, "device(ColorSensor, Port.%s).color()")
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("(%s == %s)", sensor, color), true
+}
+
+func (pybricks) distance(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	divisor, ok := map[string]string{"cm": "10", "in": "25.4", "%": "20"}[g.field(block, "UNIT")]
+	if !ok {
+		return "", false
+	}
+	return onePort(g, block, "(device(UltrasonicSensor, Port.%s).distance() / "+divisor+")")
+}
+
+func (p pybricks) isDistance(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	distance, ok := p.distance(g, block)
+	if !ok {
+		return "", false
+	}
+	return compare(distance, g.field(block, "COMPARATOR"), g.input(block, "VALUE"))
+}
+
+func (pybricks) button(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	b, ok := map[string]string{"left": "Button.LEFT", "right": "Button.RIGHT"}[g.field(block, "BUTTON")]
+	if !ok {
+		return "", false
+	}
+	switch g.field(block, "EVENT") {
+	case "pressed":
+		return fmt.Sprintf("(%s in hub.buttons.pressed())", b), true
+	case "released":
+		return fmt.Sprintf("(%s not in hub.buttons.pressed())", b), true
+	}
+	return "", false
+}
+
+func (pybricks) isUp(g *gen, block *lmsp.ProjectBlockObject, field lmsp.ProjectFieldName) (string, bool) {
+	side, ok := map[string]string{
+		"front":     "Side.FRONT",
+		"back":      "Side.BACK",
+		"up":        "Side.TOP",
+		"down":      "Side.BOTTOM",
+		"leftside":  "Side.LEFT",
+		"rightside": "Side.RIGHT",
+	}[g.field(block, field)]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("(hub.imu.up() == %s)", side), true
+}
+
+func (pybricks) isPressed(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	switch g.field(block, "OPTION") {
+	case "pressed":
+		return onePort(g, block, "device(ForceSensor, Port.%s).pressed()")
+	case "released":
+		return onePort(g, block, "(not device(ForceSensor, Port.%s).pressed())")
+	}
+	return "", false
+}
+
+func pbMotor(port string) string {
+	return fmt.Sprintf("device(Motor, Port.%s)", port)
+}
+
+// pbMotorVelocity is the velocity that a motor was set to with "set speed".
+func pbMotorVelocity(port string) string {
+	return fmt.Sprintf("velocity(motor_speeds.get(Port.%s, 75))", port)
+}
+
+// noWait lets all of the motors in a block start together, except for the
+// last one, which is awaited.
+func noWait(i int, ports []string) string {
+	if i == len(ports)-1 {
+		return ""
+	}
+	return ", wait=False"
+}
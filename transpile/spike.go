@@ -0,0 +1,428 @@
+package transpile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// spikePython writes python for the hub API that the SPIKE 2 and MINDSTORMS
+// apps run. The header imports it from spike, or from mindstorms when that's
+// where the app has it, so the same program runs in both. That API's motor
+// methods don't return until the motors stop, so the header has its own
+// scheduler, and motor blocks start the motors and poll them so that the
+// other scripts keep running.
+//
+// https://spike.legoeducation.com/prime/help/lls-help-python
+type spikePython struct{}
+
+func (spikePython) header() string {
+	return `# Translated from blocks by mind-meld.
+try:
+    from spike import ColorSensor, DistanceSensor, ForceSensor, Motor, MotorPair, PrimeHub
+except ImportError:
+    # The MINDSTORMS app has the same API under another name, without the
+    # force sensor.
+    from mindstorms import ColorSensor, DistanceSensor, Motor, MotorPair
+    from mindstorms import MSHub as PrimeHub
+import math
+import random
+import utime
+
+hub = PrimeHub()
+timer = {"start": utime.ticks_ms()}
+devices = {}
+motor_speeds = {}
+movement = {"speed": 50, "cm_per_rotation": 17.5, "pair": ("A", "B")}
+
+# The numbers that blocks use for the colors that the color sensor sees, and
+# the names of the colors that the hub's light can be.
+COLORS = {"black": 0, "violet": 1, "blue": 3, "cyan": 4, "green": 6, "yellow": 7, "red": 9, "white": 10}
+LIGHT_COLORS = ["black", "pink", "violet", "blue", "azure", "cyan", "green", "yellow", "orange", "red", "white"]
+
+
+def device(kind, port):
+    if port not in devices:
+        devices[port] = kind(port)
+    return devices[port]
+
+
+def motor(port):
+    return device(Motor, port)
+
+
+def motor_pair():
+    left, right = movement["pair"]
+    key = left + right
+    if key not in devices:
+        devices[key] = MotorPair(left, right)
+    return devices[key]
+
+
+def motor_speed(port):
+    return int(motor_speeds.get(port, 75))
+
+
+def color_number(name):
+    return COLORS.get(name, -1)
+
+
+def show_pixels(pixels):
+    for i, brightness in enumerate(pixels):
+        hub.light_matrix.set_pixel(i % 5, i // 5, brightness)
+
+
+# Scripts are generators that take turns. Each one lets the others run when it
+# waits.
+def sleep_ms(ms):
+    end = utime.ticks_add(utime.ticks_ms(), int(ms))
+    yield
+    while utime.ticks_diff(end, utime.ticks_ms()) > 0:
+        yield
+
+
+def until(condition):
+    while not condition():
+        yield
+
+
+def run(*scripts):
+    scripts = list(scripts)
+    while scripts:
+        for script in list(scripts):
+            try:
+                script.send(None)
+            except StopIteration:
+                scripts.remove(script)
+
+
+# motors is a list of (motor, speed). Each one stops when it has turned for
+# degrees.
+def run_for_degrees(motors, degrees):
+    running = [(m, m.get_degrees_counted()) for m, _ in motors]
+    for m, speed in motors:
+        m.start(speed)
+    while running:
+        yield
+        for m, start in list(running):
+            if abs(m.get_degrees_counted() - start) >= abs(degrees):
+                m.stop()
+                running.remove((m, start))
+
+
+def run_for_time(motors, ms):
+    for m, speed in motors:
+        m.start(speed)
+    yield from sleep_ms(ms)
+    for m, _ in motors:
+        m.stop()
+
+
+# Moves with start, which starts the motor pair, until either wheel has gone
+# amount.
+def move_for(amount, unit, start):
+    pair = motor_pair()
+    if unit == "seconds":
+        start(pair)
+        yield from sleep_ms(amount * 1000)
+        pair.stop()
+        return
+    if unit == "rotations":
+        degrees = amount * 360
+    elif unit == "degrees":
+        degrees = amount
+    elif unit == "in":
+        degrees = amount * 2.54 * 360 / movement["cm_per_rotation"]
+    else:
+        degrees = amount * 360 / movement["cm_per_rotation"]
+    wheels = [motor(p) for p in movement["pair"]]
+    starts = [m.get_degrees_counted() for m in wheels]
+    start(pair)
+    while max(abs(m.get_degrees_counted() - s) for m, s in zip(wheels, starts)) < abs(degrees):
+        yield
+    pair.stop()
+`
+}
+
+func (spikePython) names() []string {
+	return []string{
+		"ColorSensor", "DistanceSensor", "ForceSensor", "Motor", "MotorPair",
+		"PrimeHub", "math", "random", "utime",
+		"hub", "timer", "devices", "motor_speeds", "movement", "COLORS",
+		"LIGHT_COLORS", "device", "motor", "motor_pair", "motor_speed",
+		"color_number", "show_pixels", "sleep_ms", "until", "run",
+		"run_for_degrees", "run_for_time", "move_for",
+	}
+}
+
+func (spikePython) sleep(ms string) string {
+	return fmt.Sprintf("await sleep_ms(%s)", ms)
+}
+
+func (spikePython) waitUntil(g *gen, cond string) {
+	g.line("await until(lambda: %s)", cond)
+}
+
+func (spikePython) run(g *gen, scripts []string) {
+	calls := make([]string, 0, len(scripts))
+	for _, s := range scripts {
+		calls = append(calls, s+"()")
+	}
+	g.line("run(%s)", strings.Join(calls, ", "))
+}
+
+func (s spikePython) statement(g *gen, block *lmsp.ProjectBlockObject) bool {
+	return g.spikeStatement(s, block)
+}
+
+func (s spikePython) expression(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	return g.spikeExpression(s, block)
+}
+
+func (s spikePython) hatCondition(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	return g.spikeHatCondition(s, block)
+}
+
+func (spikePython) motorSpeed(port string) string {
+	return fmt.Sprintf("motor_speed(%q)", port)
+}
+
+func (spikePython) velocity(percent string) string {
+	return intExpr(percent)
+}
+
+func (spikePython) setMotorSpeed(g *gen, port, speed string) {
+	g.line("motor_speeds[%q] = %s", port, speed)
+}
+
+func (spikePython) startMotor(g *gen, port, speed string) {
+	g.line("motor(%q).start(%s)", port, speed)
+}
+
+func (spikePython) startMotorAtPower(g *gen, port, power string) {
+	g.line("motor(%q).start_at_power(%s)", port, intExpr(power))
+}
+
+func (spikePython) stopMotor(g *gen, port string) {
+	g.line("motor(%q).stop()", port)
+}
+
+func (spikePython) setDegreesCounted(g *gen, port, degrees string) {
+	g.line("motor(%q).set_degrees_counted(%s)", port, degrees)
+}
+
+// motorRunFor starts all of the motors together, and waits for all of them.
+func (spikePython) motorRunFor(g *gen, block *lmsp.ProjectBlockObject, ports []string, speed func(port string) string) bool {
+	value := g.input(block, "VALUE")
+	var fn, amount string
+	switch g.field(block, "UNIT") {
+	case "rotations":
+		fn, amount = "run_for_degrees", intExpr(scale(value, 360))
+	case "degrees":
+		fn, amount = "run_for_degrees", intExpr(value)
+	case "seconds":
+		fn, amount = "run_for_time", millis(value)
+	default:
+		return false
+	}
+	motors := make([]string, 0, len(ports))
+	for _, p := range ports {
+		motors = append(motors, fmt.Sprintf("(motor(%q), %s)", p, speed(p)))
+	}
+	g.line("await %s([%s], %s)", fn, strings.Join(motors, ", "), amount)
+	return true
+}
+
+func (spikePython) motorsToPosition(g *gen, ports []string, pos, dir string) bool {
+	dir, ok := map[string]string{
+		"shortest":         "shortest path",
+		"clockwise":        "clockwise",
+		"counterclockwise": "counterclockwise",
+	}[dir]
+	if !ok {
+		return false
+	}
+	// run_to_position doesn't return until the motor gets there, so the
+	// motors move one at a time.
+	for _, p := range ports {
+		g.line("motor(%q).run_to_position(%s, %q, motor_speed(%q))", p, pos, dir, p)
+	}
+	return true
+}
+
+func (spikePython) motorsToRelativePosition(g *gen, ports []string, pos, speed string) {
+	for _, p := range ports {
+		g.line("motor(%q).run_to_degrees_counted(%s, %s)", p, pos, speed)
+	}
+}
+
+func (spikePython) setMovementPair(g *gen, left, right string) {
+	g.line(`movement["pair"] = (%q, %q)`, left, right)
+}
+
+func (spikePython) startMove(g *gen, steering, speed string) {
+	g.line("motor_pair().start(%s, %s)", steering, speed)
+}
+
+func (spikePython) startTank(g *gen, left, right string) {
+	g.line("motor_pair().start_tank(%s, %s)", left, right)
+}
+
+func (spikePython) stopMove(g *gen) {
+	g.line("motor_pair().stop()")
+}
+
+func (s spikePython) moveFor(g *gen, block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID, steering, speed string) bool {
+	return s.moveWith(g, block, input, fmt.Sprintf("pair.start(%s, %s)", steering, speed))
+}
+
+func (s spikePython) moveTankFor(g *gen, block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID, left, right string) bool {
+	return s.moveWith(g, block, input, fmt.Sprintf("pair.start_tank(%s, %s)", left, right))
+}
+
+// moveWith writes a movement block that moves for a distance, and returns
+// false if the unit isn't supported. start is the call that starts the motor
+// pair.
+func (spikePython) moveWith(g *gen, block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID, start string) bool {
+	unit := g.field(block, "UNIT")
+	switch unit {
+	case "rotations", "degrees", "cm", "in", "seconds":
+	default:
+		return false
+	}
+	g.line("await move_for(%s, %q, lambda pair: %s)", g.input(block, input), unit, start)
+	return true
+}
+
+func (spikePython) displayOff(g *gen) {
+	g.line("hub.light_matrix.off()")
+}
+
+func (spikePython) writeText(g *gen, text string) {
+	g.line("hub.light_matrix.write(str(%s))", text)
+}
+
+func (spikePython) showPixels(g *gen, pixels string) {
+	g.line("show_pixels(%s)", pixels)
+}
+
+func (spikePython) setPixel(g *gen, x, y, brightness string) {
+	g.line("hub.light_matrix.set_pixel(%s, %s, %s)", x, y, brightness)
+}
+
+func (spikePython) setCenterLight(g *gen, color string) {
+	g.line("hub.status_light.on(LIGHT_COLORS[%s])", intExpr(color))
+}
+
+func (spikePython) lightUpDistanceSensor(g *gen, port, lights string) {
+	g.line("device(DistanceSensor, %q).light_up(%s)", port, lights)
+}
+
+func (s spikePython) beepFor(g *gen, note, ms string) {
+	g.line("hub.speaker.start_beep(%s)", intExpr(note))
+	g.line("%s", s.sleep(ms))
+	g.line("hub.speaker.stop()")
+}
+
+func (spikePython) startBeep(g *gen, note string) {
+	g.line("hub.speaker.start_beep(%s)", intExpr(note))
+}
+
+func (spikePython) stopSound(g *gen) {
+	g.line("hub.speaker.stop()")
+}
+
+func (spikePython) resetYaw(g *gen) {
+	g.line("hub.motion_sensor.reset_yaw_angle()")
+}
+
+func (spikePython) resetTimer(g *gen) {
+	g.line(`timer["start"] = utime.ticks_ms()`)
+}
+
+func (spikePython) absolutePosition() string {
+	return `motor("%s").get_position()`
+}
+
+func (spikePython) currentSpeed() string {
+	return `motor("%s").get_speed()`
+}
+
+func (spikePython) degreesCounted() string {
+	return `motor("%s").get_degrees_counted()`
+}
+
+func (spikePython) color() string {
+	return `color_number(device(ColorSensor, "%s").get_color())`
+}
+
+func (spikePython) reflection() string {
+	return `device(ColorSensor, "%s").get_reflected_light()`
+}
+
+func (spikePython) distance(unit string) (string, bool) {
+	method, ok := map[string]string{"cm": "get_distance_cm", "in": "get_distance_inches", "%": "get_distance_percentage"}[unit]
+	if !ok {
+		return "", false
+	}
+	return `device(DistanceSensor, "%s").` + method + "()", true
+}
+
+func (spikePython) force(unit string) (string, bool) {
+	switch unit {
+	case "newton":
+		return `device(ForceSensor, "%s").get_force_newton()`, true
+	case "%":
+		return `device(ForceSensor, "%s").get_force_percentage()`, true
+	}
+	return "", false
+}
+
+func (spikePython) forcePressed() string {
+	return `device(ForceSensor, "%s").is_pressed()`
+}
+
+func (spikePython) buttonPressed(button string, pressed bool) (string, bool) {
+	b, ok := map[string]string{"left": "hub.left_button", "right": "hub.right_button"}[button]
+	if !ok {
+		return "", false
+	}
+	if pressed {
+		return fmt.Sprintf("%s.is_pressed()", b), true
+	}
+	return fmt.Sprintf("(not %s.is_pressed())", b), true
+}
+
+func (spikePython) axisAngle(axis string) (string, bool) {
+	switch axis {
+	case "yaw", "pitch", "roll":
+		return fmt.Sprintf("hub.motion_sensor.get_%s_angle()", axis), true
+	}
+	return "", false
+}
+
+func (spikePython) upFace(face string) (string, bool) {
+	switch face {
+	case "front", "back", "up", "down", "leftside", "rightside":
+		return fmt.Sprintf("(hub.motion_sensor.get_orientation() == %q)", face), true
+	}
+	return "", false
+}
+
+func (spikePython) gesture(gesture string) (string, bool) {
+	gesture, ok := map[string]string{
+		"tapped":       "tapped",
+		"doubletapped": "doubletapped",
+		"shake":        "shaken",
+		"freefall":     "falling",
+	}[gesture]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("(hub.motion_sensor.get_gesture() == %q)", gesture), true
+}
+
+func (spikePython) seconds() string {
+	return `(utime.ticks_diff(utime.ticks_ms(), timer["start"]) / 1000)`
+}
@@ -0,0 +1,349 @@
+package transpile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// spike3Python writes python for the SPIKE App 3 hub API, which uses runloop
+// to run async functions.
+//
+// https://spike.legoeducation.com/prime/modal/help/lls-help-python
+type spike3Python struct{}
+
+func (spike3Python) header() string {
+	return `# Translated from blocks by mind-meld.
+from hub import button, light, light_matrix, motion_sensor, port, sound
+import color_sensor
+import distance_sensor
+import force_sensor
+import math
+import motor
+import motor_pair
+import random
+import runloop
+import time
+
+
+# Blocks use percent for speeds, but the hub uses degrees per second.
+def velocity(percent):
+    return int(percent * 10)
+
+
+def note_frequency(note):
+    return int(440 * 2 ** ((note - 69) / 12))
+
+
+motor_speeds = {}
+movement = {"speed": 50, "cm_per_rotation": 17.5}
+timer = {"start": time.ticks_ms()}
+`
+}
+
+func (spike3Python) names() []string {
+	return []string{
+		"button", "light", "light_matrix", "motion_sensor", "port", "sound",
+		"color_sensor", "distance_sensor", "force_sensor", "math", "motor",
+		"motor_pair", "random", "runloop", "time",
+		"velocity", "note_frequency", "motor_speeds", "movement", "timer",
+	}
+}
+
+func (spike3Python) sleep(ms string) string {
+	return fmt.Sprintf("await runloop.sleep_ms(%s)", ms)
+}
+
+func (spike3Python) waitUntil(g *gen, cond string) {
+	g.line("await runloop.until(lambda: %s)", cond)
+}
+
+func (spike3Python) run(g *gen, scripts []string) {
+	calls := make([]string, 0, len(scripts))
+	for _, s := range scripts {
+		calls = append(calls, s+"()")
+	}
+	g.line("runloop.run(%s)", strings.Join(calls, ", "))
+}
+
+func (s spike3Python) statement(g *gen, block *lmsp.ProjectBlockObject) bool {
+	return g.spikeStatement(s, block)
+}
+
+func (s spike3Python) expression(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	return g.spikeExpression(s, block)
+}
+
+func (s spike3Python) hatCondition(g *gen, block *lmsp.ProjectBlockObject) (string, bool) {
+	return g.spikeHatCondition(s, block)
+}
+
+func (spike3Python) motorSpeed(port string) string {
+	return motorVelocity(port)
+}
+
+func (spike3Python) velocity(percent string) string {
+	return fmt.Sprintf("velocity(%s)", percent)
+}
+
+func (spike3Python) setMotorSpeed(g *gen, port, speed string) {
+	g.line("motor_speeds[port.%s] = %s", port, speed)
+}
+
+func (spike3Python) startMotor(g *gen, port, speed string) {
+	g.line("motor.run(port.%s, %s)", port, speed)
+}
+
+func (spike3Python) startMotorAtPower(g *gen, port, power string) {
+	g.line("motor.set_duty_cycle(port.%s, %s)", port, intExpr(scale(power, 100)))
+}
+
+func (spike3Python) stopMotor(g *gen, port string) {
+	g.line("motor.stop(port.%s)", port)
+}
+
+func (spike3Python) setDegreesCounted(g *gen, port, degrees string) {
+	g.line("motor.reset_relative_position(port.%s, %s)", port, degrees)
+}
+
+// motorRunFor starts all of the motors together, and waits for the last one.
+func (spike3Python) motorRunFor(g *gen, block *lmsp.ProjectBlockObject, ports []string, speed func(port string) string) bool {
+	value := g.input(block, "VALUE")
+	var fn, amount string
+	switch g.field(block, "UNIT") {
+	case "rotations":
+		fn, amount = "run_for_degrees", intExpr(scale(value, 360))
+	case "degrees":
+		fn, amount = "run_for_degrees", intExpr(value)
+	case "seconds":
+		fn, amount = "run_for_time", millis(value)
+	default:
+		return false
+	}
+	for i, p := range ports {
+		g.line("%smotor.%s(port.%s, %s, %s)", await(i, ports), fn, p, amount, speed(p))
+	}
+	return true
+}
+
+func (spike3Python) motorsToPosition(g *gen, ports []string, pos, dir string) bool {
+	dir, ok := map[string]string{
+		"shortest":         "motor.SHORTEST_PATH",
+		"clockwise":        "motor.CLOCKWISE",
+		"counterclockwise": "motor.COUNTERCLOCKWISE",
+	}[dir]
+	if !ok {
+		return false
+	}
+	for i, p := range ports {
+		g.line("%smotor.run_to_absolute_position(port.%s, %s, %s, direction=%s)", await(i, ports), p, pos, motorVelocity(p), dir)
+	}
+	return true
+}
+
+func (spike3Python) motorsToRelativePosition(g *gen, ports []string, pos, speed string) {
+	for i, p := range ports {
+		g.line("%smotor.run_to_relative_position(port.%s, %s, %s)", await(i, ports), p, pos, speed)
+	}
+}
+
+func (spike3Python) setMovementPair(g *gen, left, right string) {
+	g.line("motor_pair.pair(motor_pair.PAIR_1, port.%s, port.%s)", left, right)
+}
+
+func (spike3Python) startMove(g *gen, steering, speed string) {
+	g.line("motor_pair.move(motor_pair.PAIR_1, %s, velocity=%s)", steering, speed)
+}
+
+func (spike3Python) startTank(g *gen, left, right string) {
+	g.line("motor_pair.move_tank(motor_pair.PAIR_1, %s, %s)", left, right)
+}
+
+func (spike3Python) stopMove(g *gen) {
+	g.line("motor_pair.stop(motor_pair.PAIR_1)")
+}
+
+func (s spike3Python) moveFor(g *gen, block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID, steering, speed string) bool {
+	return s.moveWith(g, block, input, "move", fmt.Sprintf("%s, velocity=%s", steering, speed))
+}
+
+func (s spike3Python) moveTankFor(g *gen, block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID, left, right string) bool {
+	return s.moveWith(g, block, input, "move_tank", fmt.Sprintf("%s, %s", left, right))
+}
+
+// moveWith writes a movement block that moves for a distance with
+// motor_pair's fn, and returns false if the unit isn't supported. args are the
+// arguments after the amount.
+func (spike3Python) moveWith(g *gen, block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID, fn, args string) bool {
+	value := g.input(block, input)
+	var amount string
+	switch g.field(block, "UNIT") {
+	case "rotations":
+		amount = intExpr(scale(value, 360))
+	case "degrees":
+		amount = intExpr(value)
+	case "cm":
+		amount = fmt.Sprintf(`int(%s * 360 / movement["cm_per_rotation"])`, atom(value))
+	case "in":
+		amount = fmt.Sprintf(`int(%s * 360 / movement["cm_per_rotation"])`, atom(scale(value, 2.54)))
+	case "seconds":
+		g.line("await motor_pair.%s_for_time(motor_pair.PAIR_1, %s, %s)", fn, millis(value), args)
+		return true
+	default:
+		return false
+	}
+	g.line("await motor_pair.%s_for_degrees(motor_pair.PAIR_1, %s, %s)", fn, amount, args)
+	return true
+}
+
+func (spike3Python) displayOff(g *gen) {
+	g.line("light_matrix.clear()")
+}
+
+func (spike3Python) writeText(g *gen, text string) {
+	g.line("await light_matrix.write(str(%s))", text)
+}
+
+func (spike3Python) showPixels(g *gen, pixels string) {
+	g.line("light_matrix.show(%s)", pixels)
+}
+
+func (spike3Python) setPixel(g *gen, x, y, brightness string) {
+	g.line("light_matrix.set_pixel(%s, %s, %s)", x, y, brightness)
+}
+
+func (spike3Python) setCenterLight(g *gen, color string) {
+	g.line("light.color(light.POWER, %s)", color)
+}
+
+func (spike3Python) lightUpDistanceSensor(g *gen, port, lights string) {
+	g.line("distance_sensor.show(port.%s, [%s])", port, lights)
+}
+
+func (spike3Python) beepFor(g *gen, note, ms string) {
+	g.line("await sound.beep(note_frequency(%s), %s)", note, ms)
+}
+
+func (spike3Python) startBeep(g *gen, note string) {
+	g.line("sound.beep(note_frequency(%s), 60000)", note)
+}
+
+func (spike3Python) stopSound(g *gen) {
+	g.line("sound.stop()")
+}
+
+func (spike3Python) resetYaw(g *gen) {
+	g.line("motion_sensor.reset_yaw(0)")
+}
+
+func (spike3Python) resetTimer(g *gen) {
+	g.line(`timer["start"] = time.ticks_ms()`)
+}
+
+func (spike3Python) absolutePosition() string {
+	return "motor.absolute_position(port.%s)"
+}
+
+func (spike3Python) currentSpeed() string {
+	return "(motor.velocity(port.%s) // 10)"
+}
+
+func (spike3Python) degreesCounted() string {
+	return "motor.relative_position(port.%s)"
+}
+
+func (spike3Python) color() string {
+	return "color_sensor.color(port.%s)"
+}
+
+func (spike3Python) reflection() string {
+	return "color_sensor.reflection(port.%s)"
+}
+
+func (spike3Python) distance(unit string) (string, bool) {
+	divisor, ok := map[string]string{"cm": "10", "in": "25.4", "%": "20"}[unit]
+	if !ok {
+		return "", false
+	}
+	return "(distance_sensor.distance(port.%s) / " + divisor + ")", true
+}
+
+func (spike3Python) force(unit string) (string, bool) {
+	switch unit {
+	case "newton":
+		return "(force_sensor.force(port.%s) / 10)", true
+	case "%":
+		return "force_sensor.force(port.%s)", true
+	}
+	return "", false
+}
+
+func (spike3Python) forcePressed() string {
+	return "force_sensor.pressed(port.%s)"
+}
+
+func (spike3Python) buttonPressed(button string, pressed bool) (string, bool) {
+	b, ok := map[string]string{"left": "button.LEFT", "right": "button.RIGHT"}[button]
+	if !ok {
+		return "", false
+	}
+	if pressed {
+		return fmt.Sprintf("(button.pressed(%s) > 0)", b), true
+	}
+	return fmt.Sprintf("(button.pressed(%s) == 0)", b), true
+}
+
+func (spike3Python) axisAngle(axis string) (string, bool) {
+	i, ok := map[string]int{"yaw": 0, "pitch": 1, "roll": 2}[axis]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("(motion_sensor.tilt_angles()[%d] / 10)", i), true
+}
+
+func (spike3Python) upFace(face string) (string, bool) {
+	face, ok := map[string]string{
+		"front":     "motion_sensor.FRONT",
+		"back":      "motion_sensor.BACK",
+		"up":        "motion_sensor.TOP",
+		"down":      "motion_sensor.BOTTOM",
+		"leftside":  "motion_sensor.LEFT",
+		"rightside": "motion_sensor.RIGHT",
+	}[face]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("(motion_sensor.up_face() == %s)", face), true
+}
+
+func (spike3Python) gesture(gesture string) (string, bool) {
+	gesture, ok := map[string]string{
+		"tapped":       "motion_sensor.TAPPED",
+		"doubletapped": "motion_sensor.DOUBLE_TAPPED",
+		"shake":        "motion_sensor.SHAKEN",
+		"freefall":     "motion_sensor.FALLING",
+	}[gesture]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("(motion_sensor.gesture() == %s)", gesture), true
+}
+
+func (spike3Python) seconds() string {
+	return `(time.ticks_diff(time.ticks_ms(), timer["start"]) / 1000)`
+}
+
+// motorVelocity is the velocity that a motor was set to with "set speed".
+func motorVelocity(port string) string {
+	return fmt.Sprintf("velocity(motor_speeds.get(port.%s, 75))", port)
+}
+
+// await starts all of the motors in a block without waiting, except for the
+// last one, so that they all run at the same time.
+func await(i int, ports []string) string {
+	if i == len(ports)-1 {
+		return "await "
+	}
+	return ""
+}
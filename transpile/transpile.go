@@ -0,0 +1,1342 @@
+// Package transpile turns block programs into python programs that can run on
+// a hub.
+//
+// The parts that are the same for every kind of hub (control blocks,
+// operators, variables, broadcasts, and custom blocks) are translated here. A
+// backend translates the hardware blocks, like motors and sensors, into the
+// python API for one kind of hub. Blocks that a backend can't translate are
+// written as TODO stubs, using the same rendering as lmsdump, so that nothing
+// is silently left out.
+package transpile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spraints/mind-meld/lmsdump"
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+// backend translates hardware blocks for one kind of hub.
+type backend interface {
+	// header is written at the top of the program. It has the imports and
+	// any state or helpers that the translated blocks use.
+	header() string
+	// names are the names defined in header, which generated functions
+	// must not use.
+	names() []string
+
+	// statement writes a stack block. It returns false if the block isn't
+	// supported.
+	statement(g *gen, block *lmsp.ProjectBlockObject) bool
+	// expression translates a reporter or boolean block. It returns false
+	// if the block isn't supported.
+	expression(g *gen, block *lmsp.ProjectBlockObject) (string, bool)
+	// hatCondition returns the condition that starts a script whose hat
+	// block is block. It returns false if the hat isn't supported.
+	hatCondition(g *gen, block *lmsp.ProjectBlockObject) (string, bool)
+
+	// sleep returns a statement that waits for ms milliseconds.
+	sleep(ms string) string
+	// waitUntil writes statements that wait until cond is true.
+	waitUntil(g *gen, cond string)
+	// run writes the statements that start all of the scripts.
+	run(g *gen, scripts []string)
+}
+
+var backends = map[string]backend{
+	"pybricks":      pybricks{},
+	"spike-python":  spikePython{},
+	"spike3-python": spike3Python{},
+}
+
+// Targets returns the names of the kinds of python that Transpile can write.
+func Targets() []string {
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Transpile writes a python version of proj to w. target is one of Targets.
+func Transpile(w io.Writer, proj lmsp.Project, target string) error {
+	b, ok := backends[target]
+	if !ok {
+		return fmt.Errorf("unknown target %q (expected one of %s)", target, strings.Join(Targets(), ", "))
+	}
+
+	g := &gen{
+		b:      b,
+		used:   map[string]bool{},
+		procs:  map[string]string{},
+		params: map[string]string{},
+	}
+	for _, name := range b.names() {
+		g.used[name] = true
+	}
+	for _, name := range coreNames {
+		g.used[name] = true
+	}
+	g.project(proj)
+
+	var out bytes.Buffer
+	out.WriteString(b.header())
+	out.WriteString("\n")
+	g.writeState(&out, proj)
+	out.Write(g.out.Bytes())
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// coreNames are defined by writeState.
+var coreNames = []string{"broadcast", "broadcasts", "lists", "todo", "variables"}
+
+// gen holds the state of one translation.
+type gen struct {
+	b   backend
+	out bytes.Buffer
+
+	// target is the target whose scripts are being translated.
+	target lmsp.ProjectTarget
+
+	indent int
+	// code counts the lines of code (not comments) that have been written.
+	code int
+
+	// used is every top-level name in the program.
+	used map[string]bool
+	// procs maps a custom block's proccode to its function name.
+	procs map[string]string
+	// params maps the argument names of the custom block that is being
+	// translated to their parameter names.
+	params map[string]string
+	// scripts are the functions that need to be started.
+	scripts []string
+	// usesTodo is set when the todo helper is needed.
+	usesTodo bool
+}
+
+func (g *gen) project(proj lmsp.Project) {
+	for _, target := range proj.Targets {
+		for _, id := range sortedBlockIDs(target.Blocks) {
+			block, ok := target.Blocks[id].(*lmsp.ProjectBlockObject)
+			if !ok || block.Opcode != "procedures_prototype" || block.Mutation == nil {
+				continue
+			}
+			if _, ok := g.procs[block.Mutation.ProcCode]; !ok {
+				g.procs[block.Mutation.ProcCode] = g.unique(procName(block.Mutation.ProcCode))
+			}
+		}
+	}
+
+	for _, target := range proj.Targets {
+		g.target = target
+		for _, id := range scriptIDs(target) {
+			g.script(target.Blocks[id].(*lmsp.ProjectBlockObject), id)
+		}
+	}
+
+	g.line("")
+	g.line("")
+	if len(g.scripts) == 0 {
+		g.line("# There aren't any scripts to start.")
+		return
+	}
+	g.b.run(g, g.scripts)
+}
+
+// writeState writes the variables, lists, and broadcasts that all of the
+// targets share, and helpers that the core translation uses.
+func (g *gen) writeState(out *bytes.Buffer, proj lmsp.Project) {
+	variables := map[string]string{}
+	lists := map[string]string{}
+	messages := map[string]string{}
+	for _, target := range proj.Targets {
+		for _, v := range target.Variables {
+			variables[v.Name] = literal(v.Value)
+		}
+		for _, l := range target.Lists {
+			var vals []string
+			for _, v := range l.Values {
+				vals = append(vals, literal(v))
+			}
+			lists[l.Name] = "[" + strings.Join(vals, ", ") + "]"
+		}
+		for _, b := range target.Broadcasts {
+			messages[string(b)] = "0"
+		}
+	}
+
+	writeDict(out, "variables", variables)
+	writeDict(out, "lists", lists)
+	writeDict(out, "broadcasts", messages)
+	out.WriteString("\n\n")
+	out.WriteString("def broadcast(message):\n")
+	out.WriteString("    broadcasts[message] = broadcasts.get(message, 0) + 1\n")
+	if g.usesTodo {
+		out.WriteString("\n\n")
+		out.WriteString("def todo(block):\n")
+		out.WriteString("    raise NotImplementedError(block)\n")
+	}
+}
+
+func writeDict(out *bytes.Buffer, name string, vals map[string]string) {
+	if len(vals) == 0 {
+		fmt.Fprintf(out, "%s = {}\n", name)
+		return
+	}
+	var keys []string
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(out, "%s = {\n", name)
+	for _, k := range keys {
+		fmt.Fprintf(out, "    %s: %s,\n", pyString(k), vals[k])
+	}
+	out.WriteString("}\n")
+}
+
+// script writes one script as an async function.
+func (g *gen) script(block *lmsp.ProjectBlockObject, id lmsp.ProjectBlockID) {
+	g.line("")
+	g.line("")
+
+	switch block.Opcode {
+	case "procedures_definition":
+		g.comment(block)
+		g.procedure(block)
+		return
+
+	case "flipperevents_whenProgramStarts":
+		g.comment(block)
+		name := g.unique("when_program_starts")
+		g.scripts = append(g.scripts, name)
+		g.def(name, "")
+		g.stack(block.Next)
+		g.indent--
+		return
+
+	case "event_whenbroadcastreceived":
+		g.comment(block)
+		message := pyString(g.field(block, "BROADCAST_OPTION"))
+		name := g.unique("when_i_receive_" + identifier(g.field(block, "BROADCAST_OPTION")))
+		g.scripts = append(g.scripts, name)
+		g.def(name, "")
+		g.line("seen = broadcasts.get(%s, 0)", message)
+		g.line("while True:")
+		g.indent++
+		g.b.waitUntil(g, fmt.Sprintf("broadcasts.get(%s, 0) != seen", message))
+		g.line("seen = broadcasts.get(%s, 0)", message)
+		g.stack(block.Next)
+		g.indent -= 2
+		return
+	}
+
+	if cond, ok := g.b.hatCondition(g, block); ok {
+		g.comment(block)
+		name := g.unique(hatName(block.Opcode))
+		g.scripts = append(g.scripts, name)
+		g.def(name, "")
+		g.line("while True:")
+		g.indent++
+		g.b.waitUntil(g, cond)
+		g.stack(block.Next)
+		g.b.waitUntil(g, "not ("+cond+")")
+		g.indent -= 2
+		return
+	}
+
+	// Nothing will start this script, but write it anyway so that it's
+	// easy to hook up by hand.
+	g.line("# TODO: nothing starts this script.")
+	g.def(g.unique("script"), "")
+	g.stack(&id)
+	g.indent--
+}
+
+func (g *gen) procedure(block *lmsp.ProjectBlockObject) {
+	proto := g.inputBlock(block, "custom_block")
+	if proto == nil || proto.Mutation == nil {
+		g.line("# TODO: custom block without a definition.")
+		g.def(g.unique("procedure"), "")
+		g.stack(block.Next)
+		g.indent--
+		return
+	}
+
+	g.params = map[string]string{}
+	used := map[string]bool{}
+	var params []string
+	for _, name := range proto.Mutation.ArgumentNameList() {
+		param := identifier(name)
+		for used[param] || g.used[param] {
+			param += "_"
+		}
+		used[param] = true
+		g.params[name] = param
+		params = append(params, param)
+	}
+
+	g.def(g.procs[proto.Mutation.ProcCode], strings.Join(params, ", "))
+	g.stack(block.Next)
+	g.indent--
+	g.params = map[string]string{}
+}
+
+func (g *gen) def(name, params string) {
+	g.line("async def %s(%s):", name, params)
+	g.indent++
+}
+
+// stack writes a stack of blocks, starting with id. It writes 'pass' if
+// there isn't any code in the stack.
+func (g *gen) stack(id *lmsp.ProjectBlockID) {
+	start := g.code
+	for id != nil {
+		block, ok := g.target.Blocks[*id].(*lmsp.ProjectBlockObject)
+		if !ok {
+			// The rest of the stack can't be found without the
+			// block's next ID.
+			if b := g.target.Blocks[*id]; b != nil {
+				g.line("# TODO: %s", b.Description())
+			} else {
+				g.line("# TODO: missing block %s", *id)
+			}
+			break
+		}
+		g.comment(block)
+		g.statement(block, *id)
+		id = block.Next
+	}
+	if g.code == start {
+		g.line("pass")
+	}
+}
+
+// substack writes the blocks inside of a C block.
+func (g *gen) substack(block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID) {
+	var first *lmsp.ProjectBlockID
+	if input := block.Inputs[input]; input != nil {
+		first = input.Value.Block
+	}
+	g.indent++
+	g.stack(first)
+	g.indent--
+}
+
+func (g *gen) statement(block *lmsp.ProjectBlockObject, id lmsp.ProjectBlockID) {
+	switch block.Opcode {
+	case "control_forever":
+		g.line("while True:")
+		g.substack(block, "SUBSTACK")
+		g.loopYield()
+	case "control_repeat":
+		g.line("for _ in range(%s):", intExpr(g.input(block, "TIMES")))
+		g.substack(block, "SUBSTACK")
+		g.loopYield()
+	case "control_repeat_until":
+		g.line("while not (%s):", g.input(block, "CONDITION"))
+		g.substack(block, "SUBSTACK")
+		g.loopYield()
+	case "control_if":
+		g.line("if %s:", g.input(block, "CONDITION"))
+		g.substack(block, "SUBSTACK")
+	case "control_if_else":
+		g.line("if %s:", g.input(block, "CONDITION"))
+		g.substack(block, "SUBSTACK")
+		g.line("else:")
+		g.substack(block, "SUBSTACK2")
+	case "control_wait":
+		g.line("%s", g.b.sleep(millis(g.input(block, "DURATION"))))
+	case "control_wait_until":
+		g.b.waitUntil(g, g.input(block, "CONDITION"))
+
+	case "flippercontrol_stop":
+		switch g.field(block, "STOP_OPTION") {
+		case "all":
+			g.line("raise SystemExit")
+		case "this script":
+			g.line("return")
+		default:
+			g.todoStatement(id)
+		}
+
+	case "data_setvariableto":
+		g.line("variables[%s] = %s", pyString(g.field(block, "VARIABLE")), g.input(block, "VALUE"))
+	case "data_changevariableby":
+		g.line("variables[%s] += %s", pyString(g.field(block, "VARIABLE")), g.input(block, "VALUE"))
+
+	case "event_broadcast":
+		g.line("broadcast(%s)", g.input(block, "BROADCAST_INPUT"))
+	case "event_broadcastandwait":
+		g.line("# TODO: this doesn't wait for the scripts that receive the message.")
+		g.line("broadcast(%s)", g.input(block, "BROADCAST_INPUT"))
+
+	case "procedures_call":
+		g.line("await %s", g.procedureCall(block))
+
+	default:
+		if !g.b.statement(g, block) {
+			g.todoStatement(id)
+		}
+	}
+}
+
+// loopYield lets the other scripts run after each time through a loop.
+func (g *gen) loopYield() {
+	g.indent++
+	g.line("%s", g.b.sleep("0"))
+	g.indent--
+}
+
+func (g *gen) procedureCall(block *lmsp.ProjectBlockObject) string {
+	if block.Mutation == nil {
+		g.usesTodo = true
+		return fmt.Sprintf("todo(%s)", pyString("custom block"))
+	}
+	name, ok := g.procs[block.Mutation.ProcCode]
+	if !ok {
+		g.usesTodo = true
+		return fmt.Sprintf("todo(%s)", pyString("custom block "+block.Mutation.ProcCode))
+	}
+	var args []string
+	for _, id := range block.Mutation.ArgumentIDList() {
+		args = append(args, g.input(block, id))
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+}
+
+// expression translates a reporter or boolean block.
+func (g *gen) expression(id lmsp.ProjectBlockID) string {
+	block, ok := g.target.Blocks[id].(*lmsp.ProjectBlockObject)
+	if !ok {
+		if g.target.Blocks[id] != nil {
+			return g.todoExpression(id)
+		}
+		return "None"
+	}
+
+	switch block.Opcode {
+	case "operator_add":
+		return g.binary(block, "+", "NUM1", "NUM2")
+	case "operator_subtract":
+		return g.binary(block, "-", "NUM1", "NUM2")
+	case "operator_multiply":
+		return g.binary(block, "*", "NUM1", "NUM2")
+	case "operator_divide":
+		return g.binary(block, "/", "NUM1", "NUM2")
+	case "operator_mod":
+		return g.binary(block, "%", "NUM1", "NUM2")
+	case "operator_lt":
+		return g.binary(block, "<", "OPERAND1", "OPERAND2")
+	case "operator_gt":
+		return g.binary(block, ">", "OPERAND1", "OPERAND2")
+	case "operator_equals":
+		return g.binary(block, "==", "OPERAND1", "OPERAND2")
+	case "operator_and":
+		return g.binary(block, "and", "OPERAND1", "OPERAND2")
+	case "operator_or":
+		return g.binary(block, "or", "OPERAND1", "OPERAND2")
+	case "operator_not":
+		return fmt.Sprintf("(not %s)", g.input(block, "OPERAND"))
+	case "operator_random":
+		return fmt.Sprintf("random.randint(%s, %s)", intExpr(g.input(block, "FROM")), intExpr(g.input(block, "TO")))
+	case "operator_round":
+		return fmt.Sprintf("round(%s)", g.input(block, "NUM"))
+	case "operator_join":
+		return fmt.Sprintf("(str(%s) + str(%s))", g.input(block, "STRING1"), g.input(block, "STRING2"))
+	case "operator_length":
+		return fmt.Sprintf("len(str(%s))", g.input(block, "STRING"))
+	case "operator_letter_of":
+		return fmt.Sprintf("str(%s)[%s]", g.input(block, "STRING"), addConst(intExpr(g.input(block, "LETTER")), -1))
+	case "operator_contains":
+		return fmt.Sprintf("(str(%s).lower() in str(%s).lower())", g.input(block, "STRING2"), g.input(block, "STRING1"))
+	case "operator_mathop":
+		if expr, ok := mathOp(g.field(block, "OPERATOR"), g.input(block, "NUM")); ok {
+			return expr
+		}
+	case "flipperoperator_isInBetween":
+		return fmt.Sprintf("(%s <= %s <= %s)", g.input(block, "LOW"), g.input(block, "VALUE"), g.input(block, "HIGH"))
+
+	case "argument_reporter_string_number", "argument_reporter_boolean":
+		if param, ok := g.params[g.field(block, "VALUE")]; ok {
+			return param
+		}
+		return "None"
+
+	default:
+		if expr, ok := g.b.expression(g, block); ok {
+			return expr
+		}
+		if v, ok := g.selector(block); ok {
+			return literal(v)
+		}
+	}
+	return g.todoExpression(id)
+}
+
+func (g *gen) binary(block *lmsp.ProjectBlockObject, op string, a, b lmsp.ProjectInputID) string {
+	return fmt.Sprintf("(%s %s %s)", g.input(block, a), op, g.input(block, b))
+}
+
+func mathOp(op, arg string) (string, bool) {
+	switch op {
+	case "abs":
+		return fmt.Sprintf("abs(%s)", arg), true
+	case "floor":
+		return fmt.Sprintf("math.floor(%s)", arg), true
+	case "ceiling":
+		return fmt.Sprintf("math.ceil(%s)", arg), true
+	case "sqrt":
+		return fmt.Sprintf("math.sqrt(%s)", arg), true
+	case "sin", "cos", "tan":
+		return fmt.Sprintf("math.%s(math.radians(%s))", op, arg), true
+	case "asin", "acos", "atan":
+		return fmt.Sprintf("math.degrees(math.%s(%s))", op, arg), true
+	case "ln":
+		return fmt.Sprintf("math.log(%s)", arg), true
+	case "log":
+		return fmt.Sprintf("math.log10(%s)", arg), true
+	case "e ^":
+		return fmt.Sprintf("math.exp(%s)", arg), true
+	case "10 ^":
+		return fmt.Sprintf("(10 ** %s)", arg), true
+	}
+	return "", false
+}
+
+// todoStatement writes a comment in place of a block that can't be
+// translated.
+// spikeAPI writes the hardware blocks for one of the SPIKE hub APIs. The
+// SPIKE backends have the same blocks with the same meanings, so
+// spikeStatement, spikeExpression, and spikeHatCondition read the blocks, and
+// a spikeAPI only knows how to say each thing in its own python.
+//
+// The methods that return formats fill in a port with %s.
+type spikeAPI interface {
+	// motorSpeed is the speed that a motor was set to with "set speed".
+	motorSpeed(port string) string
+	// velocity converts a speed in percent to what the motor methods take.
+	velocity(percent string) string
+
+	setMotorSpeed(g *gen, port, speed string)
+	startMotor(g *gen, port, speed string)
+	startMotorAtPower(g *gen, port, power string)
+	stopMotor(g *gen, port string)
+	setDegreesCounted(g *gen, port, degrees string)
+	// motorRunFor writes a block that runs motors for some rotations,
+	// degrees, or seconds, and returns false if the unit isn't supported.
+	motorRunFor(g *gen, block *lmsp.ProjectBlockObject, ports []string, speed func(port string) string) bool
+	// motorsToPosition turns the motors to pos, going in dir, which is
+	// "shortest", "clockwise", or "counterclockwise".
+	motorsToPosition(g *gen, ports []string, pos, dir string) bool
+	motorsToRelativePosition(g *gen, ports []string, pos, speed string)
+
+	setMovementPair(g *gen, left, right string)
+	startMove(g *gen, steering, speed string)
+	startTank(g *gen, left, right string)
+	stopMove(g *gen)
+	// moveFor and moveTankFor write movement blocks that move for the
+	// amount in input, and return false if the unit isn't supported.
+	moveFor(g *gen, block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID, steering, speed string) bool
+	moveTankFor(g *gen, block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID, left, right string) bool
+
+	displayOff(g *gen)
+	writeText(g *gen, text string)
+	// showPixels shows a list of 25 brightnesses, from 0 to 100.
+	showPixels(g *gen, pixels string)
+	setPixel(g *gen, x, y, brightness string)
+	setCenterLight(g *gen, color string)
+	lightUpDistanceSensor(g *gen, port, lights string)
+
+	beepFor(g *gen, note, ms string)
+	startBeep(g *gen, note string)
+	stopSound(g *gen)
+
+	resetYaw(g *gen)
+	resetTimer(g *gen)
+
+	absolutePosition() string
+	currentSpeed() string
+	degreesCounted() string
+	color() string
+	reflection() string
+	distance(unit string) (string, bool)
+	force(unit string) (string, bool)
+	forcePressed() string
+	// buttonPressed is true when button, "left" or "right", is pressed, or
+	// when it's released if pressed is false.
+	buttonPressed(button string, pressed bool) (string, bool)
+	axisAngle(axis string) (string, bool)
+	upFace(face string) (string, bool)
+	gesture(gesture string) (string, bool)
+	// seconds is the time since the timer was reset.
+	seconds() string
+}
+
+// spikeStatement writes a SPIKE stack block with api. It returns false if the
+// block isn't supported.
+func (g *gen) spikeStatement(api spikeAPI, block *lmsp.ProjectBlockObject) bool {
+	switch block.Opcode {
+	case "flippermotor_motorSetSpeed":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		for _, p := range ports {
+			api.setMotorSpeed(g, p, g.input(block, "SPEED"))
+		}
+		return true
+
+	case "flippermotor_motorStartDirection":
+		ports, ok := g.ports(block, "PORT")
+		dir, dirOK := g.menu(block, "DIRECTION")
+		if !ok || !dirOK {
+			return false
+		}
+		for _, p := range ports {
+			api.startMotor(g, p, direction(api.motorSpeed(p), dir))
+		}
+		return true
+
+	case "flippermotor_motorStop":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		for _, p := range ports {
+			api.stopMotor(g, p)
+		}
+		return true
+
+	case "flippermotor_motorTurnForDirection":
+		ports, ok := g.ports(block, "PORT")
+		dir, dirOK := g.menu(block, "DIRECTION")
+		if !ok || !dirOK {
+			return false
+		}
+		return api.motorRunFor(g, block, ports, func(p string) string {
+			return direction(api.motorSpeed(p), dir)
+		})
+
+	case "flippermotor_motorGoDirectionToPosition":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		return api.motorsToPosition(g, ports, intExpr(g.input(block, "POSITION")), g.field(block, "DIRECTION"))
+
+	case "flippermoremotor_motorStartSpeed":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		for _, p := range ports {
+			api.startMotor(g, p, api.velocity(g.input(block, "SPEED")))
+		}
+		return true
+
+	case "flippermoremotor_motorStartPower":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		for _, p := range ports {
+			api.startMotorAtPower(g, p, g.input(block, "POWER"))
+		}
+		return true
+
+	case "flippermoremotor_motorTurnForSpeed":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		speed := api.velocity(g.input(block, "SPEED"))
+		return api.motorRunFor(g, block, ports, func(string) string { return speed })
+
+	case "flippermoremotor_motorGoToRelativePosition":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		api.motorsToRelativePosition(g, ports, intExpr(g.input(block, "POSITION")), api.velocity(g.input(block, "SPEED")))
+		return true
+
+	case "flippermoremotor_motorSetDegreeCounted":
+		ports, ok := g.ports(block, "PORT")
+		if !ok {
+			return false
+		}
+		for _, p := range ports {
+			api.setDegreesCounted(g, p, intExpr(g.input(block, "VALUE")))
+		}
+		return true
+
+	case "flippermove_setMovementPair":
+		ports, ok := g.ports(block, "PAIR")
+		if !ok || len(ports) != 2 {
+			return false
+		}
+		api.setMovementPair(g, ports[0], ports[1])
+		return true
+
+	case "flippermove_movementSpeed":
+		g.line(`movement["speed"] = %s`, g.input(block, "SPEED"))
+		return true
+
+	case "flippermove_setDistance":
+		dist := g.input(block, "DISTANCE")
+		switch g.field(block, "UNIT") {
+		case "cm":
+		case "in":
+			dist = scale(dist, 2.54)
+		default:
+			return false
+		}
+		g.line(`movement["cm_per_rotation"] = %s`, dist)
+		return true
+
+	case "flippermove_move":
+		dir, ok := g.menu(block, "DIRECTION")
+		if !ok {
+			return false
+		}
+		speed := api.velocity(`movement["speed"]`)
+		steering := "0"
+		switch dir {
+		case "forward":
+		case "back":
+			speed = negate(speed)
+		case "clockwise":
+			steering = "100"
+		case "counterclockwise":
+			steering = "-100"
+		default:
+			return false
+		}
+		return api.moveFor(g, block, "VALUE", steering, speed)
+
+	case "flippermove_steer":
+		return api.moveFor(g, block, "VALUE", intExpr(g.input(block, "STEERING")), api.velocity(`movement["speed"]`))
+
+	case "flippermove_startSteer":
+		api.startMove(g, intExpr(g.input(block, "STEERING")), api.velocity(`movement["speed"]`))
+		return true
+
+	case "flippermove_stopMove":
+		api.stopMove(g)
+		return true
+
+	case "flippermoremove_startDualSpeed":
+		api.startTank(g, api.velocity(g.input(block, "LEFT")), api.velocity(g.input(block, "RIGHT")))
+		return true
+
+	case "flippermoremove_startSteerAtSpeed":
+		api.startMove(g, intExpr(g.input(block, "STEERING")), api.velocity(g.input(block, "SPEED")))
+		return true
+
+	case "flippermoremove_steerDistanceAtSpeed":
+		return api.moveFor(g, block, "DISTANCE", intExpr(g.input(block, "STEERING")), api.velocity(g.input(block, "SPEED")))
+
+	case "flippermoremove_moveDistanceAtSpeed":
+		return api.moveTankFor(g, block, "DISTANCE", api.velocity(g.input(block, "LEFT")), api.velocity(g.input(block, "RIGHT")))
+
+	case "flipperdisplay_displayOff":
+		api.displayOff(g)
+		return true
+
+	case "flipperdisplay_ledText":
+		api.writeText(g, g.input(block, "TEXT"))
+		return true
+
+	case "flipperdisplay_ledImage":
+		pixels, ok := g.pixels(block)
+		if !ok {
+			return false
+		}
+		api.showPixels(g, pixels)
+		return true
+
+	case "flipperdisplay_ledImageFor":
+		pixels, ok := g.pixels(block)
+		if !ok {
+			return false
+		}
+		api.showPixels(g, pixels)
+		g.line("%s", g.b.sleep(millis(g.input(block, "VALUE"))))
+		api.displayOff(g)
+		return true
+
+	case "flipperdisplay_ledOn":
+		api.setPixel(g,
+			addConst(intExpr(g.input(block, "X")), -1),
+			addConst(intExpr(g.input(block, "Y")), -1),
+			intExpr(g.input(block, "BRIGHTNESS")))
+		return true
+
+	case "flipperdisplay_centerButtonLight":
+		api.setCenterLight(g, g.input(block, "COLOR"))
+		return true
+
+	case "flipperdisplay_ultrasonicLightUp":
+		ports, ok := g.ports(block, "PORT")
+		lights, lightsOK := g.menu(block, "VALUE")
+		if !ok || !lightsOK {
+			return false
+		}
+		for _, p := range ports {
+			api.lightUpDistanceSensor(g, p, strings.Join(strings.Fields(lights), ", "))
+		}
+		return true
+
+	case "flippersound_beepForTime":
+		api.beepFor(g, g.input(block, "NOTE"), millis(g.input(block, "DURATION")))
+		return true
+
+	case "flippersound_beep":
+		api.startBeep(g, g.input(block, "NOTE"))
+		return true
+
+	case "flippersound_stopSound":
+		api.stopSound(g)
+		return true
+
+	case "flippersensors_resetYaw":
+		api.resetYaw(g)
+		return true
+
+	case "flippersensors_resetTimer":
+		api.resetTimer(g)
+		return true
+	}
+	return false
+}
+
+// spikeExpression translates a SPIKE reporter or boolean block with api. It
+// returns false if the block isn't supported.
+func (g *gen) spikeExpression(api spikeAPI, block *lmsp.ProjectBlockObject) (string, bool) {
+	switch block.Opcode {
+	case "flippermotor_absolutePosition":
+		return onePort(g, block, api.absolutePosition())
+	case "flippermotor_speed":
+		return onePort(g, block, api.currentSpeed())
+	case "flippermoremotor_position":
+		return onePort(g, block, api.degreesCounted())
+
+	case "flippersensors_color":
+		return onePort(g, block, api.color())
+	case "flippersensors_isColor":
+		return g.spikeIsColor(api, block, "VALUE")
+	case "flippersensors_reflectivity":
+		return onePort(g, block, api.reflection())
+	case "flippersensors_isReflectivity":
+		reflection, ok := onePort(g, block, api.reflection())
+		if !ok {
+			return "", false
+		}
+		return compare(reflection, g.field(block, "COMPARATOR"), g.input(block, "VALUE"))
+	case "flippersensors_distance":
+		return g.spikeDistance(api, block)
+	case "flippersensors_isDistance":
+		return g.spikeIsDistance(api, block)
+
+	case "flippersensors_buttonIsPressed":
+		return g.spikeButton(api, block)
+	case "flippersensors_orientationAxis":
+		return api.axisAngle(g.field(block, "AXIS"))
+	case "flippersensors_isorientation":
+		return api.upFace(g.field(block, "ORIENTATION"))
+	case "flippersensors_ismotion":
+		return api.gesture(g.field(block, "MOTION"))
+	case "flippersensors_timer":
+		return api.seconds(), true
+
+	case "flippermoresensors_force":
+		format, ok := api.force(g.field(block, "UNIT"))
+		if !ok {
+			return "", false
+		}
+		return onePort(g, block, format)
+	case "flippermoresensors_isPressed":
+		return g.spikeIsPressed(api, block)
+	}
+	return "", false
+}
+
+// spikeHatCondition returns the condition that starts a script whose hat
+// block is block, with api. It returns false if the hat isn't supported.
+func (g *gen) spikeHatCondition(api spikeAPI, block *lmsp.ProjectBlockObject) (string, bool) {
+	switch block.Opcode {
+	case "flipperevents_whenButton":
+		return g.spikeButton(api, block)
+	case "flipperevents_whenColor":
+		return g.spikeIsColor(api, block, "OPTION")
+	case "flipperevents_whenCondition":
+		return g.input(block, "CONDITION"), true
+	case "flipperevents_whenDistance":
+		return g.spikeIsDistance(api, block)
+	case "flipperevents_whenGesture":
+		return api.gesture(g.field(block, "EVENT"))
+	case "flipperevents_whenOrientation":
+		return api.upFace(g.field(block, "VALUE"))
+	case "flipperevents_whenPressed":
+		return g.spikeIsPressed(api, block)
+	case "flipperevents_whenTimer":
+		return fmt.Sprintf("%s > %s", api.seconds(), g.input(block, "VALUE")), true
+	}
+	return "", false
+}
+
+func (g *gen) spikeIsColor(api spikeAPI, block *lmsp.ProjectBlockObject, input lmsp.ProjectInputID) (string, bool) {
+	color, ok := onePort(g, block, api.color())
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("(%s == %s)", color, g.input(block, input)), true
+}
+
+func (g *gen) spikeDistance(api spikeAPI, block *lmsp.ProjectBlockObject) (string, bool) {
+	format, ok := api.distance(g.field(block, "UNIT"))
+	if !ok {
+		return "", false
+	}
+	return onePort(g, block, format)
+}
+
+func (g *gen) spikeIsDistance(api spikeAPI, block *lmsp.ProjectBlockObject) (string, bool) {
+	distance, ok := g.spikeDistance(api, block)
+	if !ok {
+		return "", false
+	}
+	return compare(distance, g.field(block, "COMPARATOR"), g.input(block, "VALUE"))
+}
+
+func (g *gen) spikeButton(api spikeAPI, block *lmsp.ProjectBlockObject) (string, bool) {
+	switch g.field(block, "EVENT") {
+	case "pressed":
+		return api.buttonPressed(g.field(block, "BUTTON"), true)
+	case "released":
+		return api.buttonPressed(g.field(block, "BUTTON"), false)
+	}
+	return "", false
+}
+
+func (g *gen) spikeIsPressed(api spikeAPI, block *lmsp.ProjectBlockObject) (string, bool) {
+	switch g.field(block, "OPTION") {
+	case "pressed":
+		return onePort(g, block, api.forcePressed())
+	case "released":
+		return onePort(g, block, "(not "+api.forcePressed()+")")
+	}
+	return "", false
+}
+
+// pixels converts the image in a MATRIX input, like "9909...", to a list of
+// 25 brightnesses, from 0 to 100.
+func (g *gen) pixels(block *lmsp.ProjectBlockObject) (string, bool) {
+	matrix, ok := g.menu(block, "MATRIX")
+	if !ok || len(matrix) != 25 {
+		return "", false
+	}
+	pixels := make([]string, 0, len(matrix))
+	for _, r := range matrix {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+		pixels = append(pixels, fmt.Sprint((int(r-'0')*100+4)/9))
+	}
+	return "[" + strings.Join(pixels, ", ") + "]", true
+}
+
+// onePort fills in the port from block's PORT input. It returns false if the
+// input isn't a single port.
+func onePort(g *gen, block *lmsp.ProjectBlockObject, format string) (string, bool) {
+	ports, ok := g.ports(block, "PORT")
+	if !ok || len(ports) != 1 {
+		return "", false
+	}
+	return fmt.Sprintf(format, ports[0]), true
+}
+
+func compare(a, op, b string) (string, bool) {
+	switch op {
+	case "<", ">":
+	case "=":
+		op = "=="
+	default:
+		return "", false
+	}
+	return fmt.Sprintf("(%s %s %s)", a, op, b), true
+}
+
+// direction makes speed negative for counterclockwise.
+func direction(speed, dir string) string {
+	if dir == "counterclockwise" {
+		return negate(speed)
+	}
+	return speed
+}
+
+func (g *gen) todoStatement(id lmsp.ProjectBlockID) {
+	block := g.target.Blocks[id].(*lmsp.ProjectBlockObject)
+	g.line("# TODO %s: %s", block.Opcode, g.describe(id))
+}
+
+// todoExpression returns a call that fails at runtime in place of a block that
+// can't be translated.
+func (g *gen) todoExpression(id lmsp.ProjectBlockID) string {
+	g.usesTodo = true
+	return fmt.Sprintf("todo(%s)", pyString(g.describe(id)))
+}
+
+// describe renders a block the same way lmsdump does, on one line.
+func (g *gen) describe(id lmsp.ProjectBlockID) string {
+	var buf bytes.Buffer
+	lmsdump.Block(&buf, g.target, id)
+	res := []rune(strings.Join(strings.Fields(buf.String()), " "))
+	if len(res) > maxDescription {
+		return string(res[:maxDescription]) + "..."
+	}
+	return string(res)
+}
+
+// maxDescription is the most runes in a description. It keeps blocks with big
+// values, like animations, from making huge TODOs.
+const maxDescription = 100
+
+// input translates one of block's inputs into an expression.
+func (g *gen) input(block *lmsp.ProjectBlockObject, name lmsp.ProjectInputID) string {
+	input := block.Inputs[name]
+	switch {
+	case input == nil:
+		return "None"
+	case input.Value.Block != nil:
+		return g.expression(*input.Value.Block)
+	case input.Value.Primitive != nil:
+		return g.primitive(input.Value.Primitive)
+	}
+	return "None"
+}
+
+// inputBlock returns the block in one of block's inputs.
+func (g *gen) inputBlock(block *lmsp.ProjectBlockObject, name lmsp.ProjectInputID) *lmsp.ProjectBlockObject {
+	id, ok := block.Inputs[name].BlockID()
+	if !ok {
+		return nil
+	}
+	b, _ := g.target.Blocks[id].(*lmsp.ProjectBlockObject)
+	return b
+}
+
+func (g *gen) primitive(val *lmsp.ProjectPrimitive) string {
+	s := val.Value
+	switch val.Kind {
+	case lmsp.PrimitiveNumber, lmsp.PrimitivePositiveNumber, lmsp.PrimitivePositiveInteger,
+		lmsp.PrimitiveInteger, lmsp.PrimitiveAngle:
+		if s == "" {
+			return "0"
+		}
+		return literal(s)
+	case lmsp.PrimitiveString:
+		return literal(s)
+	case lmsp.PrimitiveBroadcast:
+		return pyString(s)
+	case lmsp.PrimitiveVariable:
+		return fmt.Sprintf("variables[%s]", pyString(s))
+	case lmsp.PrimitiveList:
+		return fmt.Sprintf("lists[%s]", pyString(s))
+	}
+	return pyString(s)
+}
+
+// menu returns the value chosen in a menu or selector input, like a port or a
+// direction. It returns false if the input is a reporter block.
+func (g *gen) menu(block *lmsp.ProjectBlockObject, name lmsp.ProjectInputID) (string, bool) {
+	b := g.inputBlock(block, name)
+	if b == nil {
+		return "", false
+	}
+	return g.selector(b)
+}
+
+// selector returns the value of a shadow block with one field.
+func (g *gen) selector(block *lmsp.ProjectBlockObject) (string, bool) {
+	if !block.Shadow || len(block.Inputs) != 0 || len(block.Fields) != 1 {
+		return "", false
+	}
+	for name := range block.Fields {
+		return g.field(block, name), true
+	}
+	return "", false
+}
+
+func (g *gen) field(block *lmsp.ProjectBlockObject, name lmsp.ProjectFieldName) string {
+	return block.FieldValue(name)
+}
+
+// ports returns the ports chosen in a port selector, like ["A", "B"].
+func (g *gen) ports(block *lmsp.ProjectBlockObject, name lmsp.ProjectInputID) ([]string, bool) {
+	v, ok := g.menu(block, name)
+	if !ok || v == "" {
+		return nil, false
+	}
+	var ports []string
+	for _, r := range v {
+		if r < 'A' || r > 'F' {
+			return nil, false
+		}
+		ports = append(ports, string(r))
+	}
+	return ports, true
+}
+
+// comment writes the comment that's attached to a block.
+func (g *gen) comment(block *lmsp.ProjectBlockObject) {
+	if block.Comment == "" {
+		return
+	}
+	for _, line := range strings.Split(g.target.Comments[block.Comment].Text, "\n") {
+		g.line("# %s", line)
+	}
+}
+
+func (g *gen) line(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	if line == "" {
+		g.out.WriteString("\n")
+		return
+	}
+	g.out.WriteString(strings.Repeat("    ", g.indent))
+	g.out.WriteString(line)
+	g.out.WriteString("\n")
+	if !strings.HasPrefix(line, "#") {
+		g.code++
+	}
+}
+
+// unique returns name, or a variation of it that hasn't been used yet.
+func (g *gen) unique(name string) string {
+	res := name
+	for i := 2; g.used[res] || pyKeywords[res]; i++ {
+		res = fmt.Sprintf("%s_%d", name, i)
+	}
+	g.used[res] = true
+	return res
+}
+
+// scriptIDs returns the first block of each script. Custom block definitions
+// come first, so that they're defined before the scripts that use them, and
+// then the scripts are ordered by where they are on the canvas.
+func scriptIDs(target lmsp.ProjectTarget) []lmsp.ProjectBlockID {
+	ids := target.GetRootBlockIDs()
+	rank := func(b *lmsp.ProjectBlockObject) int {
+		if b.Opcode == "procedures_definition" {
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		a := target.Blocks[ids[i]].(*lmsp.ProjectBlockObject)
+		b := target.Blocks[ids[j]].(*lmsp.ProjectBlockObject)
+		if rank(a) != rank(b) {
+			return rank(a) < rank(b)
+		}
+		if ay, by := coord(a.Y), coord(b.Y); ay != by {
+			return ay < by
+		}
+		return coord(a.X) < coord(b.X)
+	})
+	return ids
+}
+
+func sortedBlockIDs(blocks lmsp.ProjectBlocks) []lmsp.ProjectBlockID {
+	ids := make([]lmsp.ProjectBlockID, 0, len(blocks))
+	for id := range blocks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func coord(c *int) int {
+	if c == nil {
+		return 0
+	}
+	return *c
+}
+
+// procName makes a function name from the words in a custom block's
+// proccode, e.g. "drive %s cm" becomes "drive_cm".
+func procName(procCode string) string {
+	var words []string
+	for _, word := range strings.Fields(procCode) {
+		if word != "%s" && word != "%b" {
+			words = append(words, word)
+		}
+	}
+	return identifier(strings.Join(words, " "))
+}
+
+// hatName makes a function name from a hat block's opcode, e.g.
+// "flipperevents_whenColor" becomes "when_color".
+func hatName(opcode lmsp.ProjectOpcode) string {
+	name := string(opcode)
+	if i := strings.Index(name, "_"); i >= 0 {
+		name = name[i+1:]
+	}
+	var words strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			words.WriteByte(' ')
+		}
+		words.WriteRune(r)
+	}
+	return identifier(words.String())
+}
+
+// identifier turns a name from the program into a python identifier.
+func identifier(name string) string {
+	var res strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if underscore && res.Len() > 0 {
+				res.WriteByte('_')
+			}
+			underscore = false
+			res.WriteRune(r)
+		} else {
+			underscore = true
+		}
+	}
+	s := res.String()
+	switch {
+	case s == "":
+		return "x"
+	case s[0] >= '0' && s[0] <= '9':
+		return "_" + s
+	case pyKeywords[s]:
+		return s + "_"
+	}
+	return s
+}
+
+var pyKeywords = map[string]bool{
+	"and": true, "as": true, "assert": true, "async": true, "await": true,
+	"break": true, "class": true, "continue": true, "def": true, "del": true,
+	"elif": true, "else": true, "except": true, "finally": true, "for": true,
+	"from": true, "global": true, "if": true, "import": true, "in": true,
+	"is": true, "lambda": true, "nonlocal": true, "not": true, "or": true,
+	"pass": true, "raise": true, "return": true, "try": true, "while": true,
+	"with": true, "yield": true, "None": true, "True": true, "False": true,
+}
+
+// literal returns a python literal for a value from the program. Scratch
+// treats text that looks like a number as a number, so that's done here too.
+func literal(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return formatNumber(v)
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case string:
+		if n, ok := parseNumber(v); ok {
+			return formatNumber(n)
+		}
+		return pyString(v)
+	}
+	return "None"
+}
+
+func pyString(s string) string {
+	return strconv.Quote(s)
+}
+
+func parseNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s, "xXnN_") {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	return n, err == nil
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// scale multiplies expr by factor. Numbers are multiplied right away.
+func scale(expr string, factor float64) string {
+	if factor == 1 {
+		return expr
+	}
+	if n, ok := parseNumber(expr); ok {
+		return formatNumber(n * factor)
+	}
+	return fmt.Sprintf("%s * %s", atom(expr), formatNumber(factor))
+}
+
+// addConst adds n to expr. Numbers are added right away.
+func addConst(expr string, n float64) string {
+	if v, ok := parseNumber(expr); ok {
+		return formatNumber(v + n)
+	}
+	if n < 0 {
+		return fmt.Sprintf("%s - %s", atom(expr), formatNumber(-n))
+	}
+	return fmt.Sprintf("%s + %s", atom(expr), formatNumber(n))
+}
+
+// intExpr converts expr to an int.
+func intExpr(expr string) string {
+	if n, ok := parseNumber(expr); ok {
+		return strconv.Itoa(int(n))
+	}
+	return fmt.Sprintf("int(%s)", expr)
+}
+
+// negate flips the sign of expr.
+func negate(expr string) string {
+	if n, ok := parseNumber(expr); ok {
+		return formatNumber(-n)
+	}
+	return "-" + atom(expr)
+}
+
+// atom puts parentheses around expr if it has operators outside of any
+// brackets or strings, so that it can be combined with other operators.
+func atom(expr string) string {
+	depth := 0
+	quoted := false
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == ' ' && depth == 0:
+			return "(" + expr + ")"
+		}
+	}
+	return expr
+}
+
+// millis converts an expression in seconds to an int number of milliseconds.
+func millis(seconds string) string {
+	return intExpr(scale(seconds, 1000))
+}
@@ -0,0 +1,304 @@
+package transpile
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spraints/mind-meld/lmsp"
+)
+
+const testProject = `{"targets": [
+  {"isStage": true, "name": "Stage", "blocks": {},
+   "variables": {"v1": ["count", 0]},
+   "broadcasts": {"b1": "go"}},
+  {"isStage": false, "name": "robot", "blocks": {
+    "start": {"opcode": "flipperevents_whenProgramStarts", "next": "turn", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+    "turn": {"opcode": "flippermotor_motorTurnForDirection", "next": "count", "parent": "start", "inputs": {"PORT": [1, "ports"], "DIRECTION": [1, "dir"], "VALUE": [1, [4, "2"]]}, "fields": {"UNIT": ["rotations", null]}, "shadow": false, "topLevel": false},
+    "ports": {"opcode": "flippermotor_multiple-port-selector", "next": null, "parent": "turn", "inputs": {}, "fields": {"field_flippermotor_multiple-port-selector": ["AB", null]}, "shadow": true, "topLevel": false},
+    "dir": {"opcode": "flippermotor_custom-icon-direction", "next": null, "parent": "turn", "inputs": {}, "fields": {"field_flippermotor_custom-icon-direction": ["counterclockwise", null]}, "shadow": true, "topLevel": false},
+    "count": {"opcode": "data_changevariableby", "next": "call", "parent": "turn", "inputs": {"VALUE": [1, [4, "1"]]}, "fields": {"VARIABLE": ["count", "v1"]}, "shadow": false, "topLevel": false},
+    "call": {"opcode": "procedures_call", "next": "send", "parent": "count", "inputs": {"arg1": [1, [4, "30"]]}, "fields": {}, "shadow": false, "topLevel": false,
+      "mutation": {"tagName": "mutation", "children": [], "proccode": "drive %s", "argumentids": "[\"arg1\"]", "warp": "false"}},
+    "send": {"opcode": "event_broadcast", "next": null, "parent": "call", "inputs": {"BROADCAST_INPUT": [1, [11, "go", "b1"]]}, "fields": {}, "shadow": false, "topLevel": false},
+
+    "def": {"opcode": "procedures_definition", "next": "tank", "parent": null, "inputs": {"custom_block": [1, "proto"]}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 400},
+    "proto": {"opcode": "procedures_prototype", "next": null, "parent": "def", "inputs": {"arg1": [1, "argshadow"]}, "fields": {}, "shadow": true, "topLevel": false,
+      "mutation": {"tagName": "mutation", "children": [], "proccode": "drive %s", "argumentids": "[\"arg1\"]", "argumentnames": "[\"speed\"]", "argumentdefaults": "[\"\"]", "warp": "false"}},
+    "argshadow": {"opcode": "argument_reporter_string_number", "next": null, "parent": "proto", "inputs": {}, "fields": {"VALUE": ["speed", null]}, "shadow": true, "topLevel": false},
+    "tank": {"opcode": "flippermoremove_startDualSpeed", "next": null, "parent": "def", "inputs": {"LEFT": [3, "speedarg", [4, "50"]], "RIGHT": [1, [4, "50"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "speedarg": {"opcode": "argument_reporter_string_number", "next": null, "parent": "tank", "inputs": {}, "fields": {"VALUE": ["speed", null]}, "shadow": false, "topLevel": false},
+
+    "recv": {"opcode": "event_whenbroadcastreceived", "next": "loop", "parent": null, "inputs": {}, "fields": {"BROADCAST_OPTION": ["go", "b1"]}, "shadow": false, "topLevel": true, "x": 400, "y": 0},
+    "loop": {"opcode": "control_forever", "next": null, "parent": "recv", "inputs": {"SUBSTACK": [2, "sound"]}, "fields": {}, "shadow": false, "topLevel": false},
+    "sound": {"opcode": "flippersound_playSound", "next": null, "parent": "loop", "inputs": {"SOUND": [1, "soundmenu"]}, "fields": {}, "shadow": false, "topLevel": false},
+    "soundmenu": {"opcode": "flippersound_sound-selector", "next": null, "parent": "sound", "inputs": {}, "fields": {"field_flippersound_sound-selector": ["Cat Meow 1", null]}, "shadow": true, "topLevel": false},
+
+    "shake": {"opcode": "flipperevents_whenGesture", "next": "show", "parent": null, "inputs": {}, "fields": {"EVENT": ["shake", null]}, "shadow": false, "topLevel": true, "x": 400, "y": 400},
+    "show": {"opcode": "flipperdisplay_ledText", "next": null, "parent": "shake", "inputs": {"TEXT": [3, "pos", [10, "Hello"]]}, "fields": {}, "shadow": false, "topLevel": false},
+    "pos": {"opcode": "flippermotor_absolutePosition", "next": null, "parent": "show", "inputs": {"PORT": [1, "pos-port"]}, "fields": {}, "shadow": false, "topLevel": false},
+    "pos-port": {"opcode": "flippermotor_single-motor-selector", "next": null, "parent": "pos", "inputs": {}, "fields": {"field_flippermotor_single-motor-selector": ["C", null]}, "shadow": true, "topLevel": false}
+  }}
+]}`
+
+func TestTranspileSpikePython(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(testProject), &proj))
+
+	var buf bytes.Buffer
+	require.NoError(t, Transpile(&buf, proj, "spike-python"))
+
+	out := buf.String()
+	require.True(t, strings.HasPrefix(out, spikePython{}.header()))
+	assert.Contains(t, out, "    from spike import ")
+	assert.Contains(t, out, "    from mindstorms import MSHub as PrimeHub\n")
+	assert.Equal(t, `
+variables = {
+    "count": 0,
+}
+lists = {}
+broadcasts = {
+    "go": 0,
+}
+
+
+def broadcast(message):
+    broadcasts[message] = broadcasts.get(message, 0) + 1
+
+
+async def drive(speed):
+    motor_pair().start_tank(int(speed), 50)
+
+
+async def when_program_starts():
+    await run_for_degrees([(motor("A"), -motor_speed("A")), (motor("B"), -motor_speed("B"))], 720)
+    variables["count"] += 1
+    await drive(30)
+    broadcast("go")
+
+
+async def when_i_receive_go():
+    seen = broadcasts.get("go", 0)
+    while True:
+        await until(lambda: broadcasts.get("go", 0) != seen)
+        seen = broadcasts.get("go", 0)
+        while True:
+            # TODO flippersound_playSound: playSound(sound: Cat Meow 1)
+            pass
+            await sleep_ms(0)
+
+
+async def when_gesture():
+    while True:
+        await until(lambda: (hub.motion_sensor.get_gesture() == "shaken"))
+        hub.light_matrix.write(str(motor("C").get_position()))
+        await until(lambda: not ((hub.motion_sensor.get_gesture() == "shaken")))
+
+
+run(when_program_starts(), when_i_receive_go(), when_gesture())
+`, strings.TrimPrefix(out, spikePython{}.header()))
+}
+
+func TestTranspileSpike3Python(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(testProject), &proj))
+
+	var buf bytes.Buffer
+	require.NoError(t, Transpile(&buf, proj, "spike3-python"))
+
+	out := buf.String()
+	require.True(t, strings.HasPrefix(out, spike3Python{}.header()))
+	assert.Equal(t, `
+variables = {
+    "count": 0,
+}
+lists = {}
+broadcasts = {
+    "go": 0,
+}
+
+
+def broadcast(message):
+    broadcasts[message] = broadcasts.get(message, 0) + 1
+
+
+async def drive(speed):
+    motor_pair.move_tank(motor_pair.PAIR_1, velocity(speed), velocity(50))
+
+
+async def when_program_starts():
+    motor.run_for_degrees(port.A, 720, -velocity(motor_speeds.get(port.A, 75)))
+    await motor.run_for_degrees(port.B, 720, -velocity(motor_speeds.get(port.B, 75)))
+    variables["count"] += 1
+    await drive(30)
+    broadcast("go")
+
+
+async def when_i_receive_go():
+    seen = broadcasts.get("go", 0)
+    while True:
+        await runloop.until(lambda: broadcasts.get("go", 0) != seen)
+        seen = broadcasts.get("go", 0)
+        while True:
+            # TODO flippersound_playSound: playSound(sound: Cat Meow 1)
+            pass
+            await runloop.sleep_ms(0)
+
+
+async def when_gesture():
+    while True:
+        await runloop.until(lambda: (motion_sensor.gesture() == motion_sensor.SHAKEN))
+        await light_matrix.write(str(motor.absolute_position(port.C)))
+        await runloop.until(lambda: not ((motion_sensor.gesture() == motion_sensor.SHAKEN)))
+
+
+runloop.run(when_program_starts(), when_i_receive_go(), when_gesture())
+`, strings.TrimPrefix(out, spike3Python{}.header()))
+}
+
+// TestTranspileCallWithoutMutation makes sure that a custom block call that's
+// missing its mutation becomes a call to todo().
+func TestTranspileCallWithoutMutation(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(`{"targets": [
+  {"isStage": false, "name": "robot", "blocks": {
+    "start": {"opcode": "flipperevents_whenProgramStarts", "next": "call", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+    "call": {"opcode": "procedures_call", "next": null, "parent": "start", "inputs": {}, "fields": {}, "shadow": false, "topLevel": false}
+  }}
+]}`), &proj))
+
+	var buf bytes.Buffer
+	require.NoError(t, Transpile(&buf, proj, "spike-python"))
+	assert.Contains(t, buf.String(), `    await todo("custom block")`)
+}
+
+func TestTranspilePybricks(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(testProject), &proj))
+
+	var buf bytes.Buffer
+	require.NoError(t, Transpile(&buf, proj, "pybricks"))
+
+	out := buf.String()
+	require.True(t, strings.HasPrefix(out, pybricks{}.header()))
+	assert.Equal(t, `
+variables = {
+    "count": 0,
+}
+lists = {}
+broadcasts = {
+    "go": 0,
+}
+
+
+def broadcast(message):
+    broadcasts[message] = broadcasts.get(message, 0) + 1
+
+
+async def drive(speed):
+    # TODO flippermoremove_startDualSpeed: startMovingAtSpeed(left: speed, right: 50)
+    pass
+
+
+async def when_program_starts():
+    device(Motor, Port.A).run_angle(-velocity(motor_speeds.get(Port.A, 75)), 720, wait=False)
+    await device(Motor, Port.B).run_angle(-velocity(motor_speeds.get(Port.B, 75)), 720)
+    variables["count"] += 1
+    await drive(30)
+    broadcast("go")
+
+
+async def when_i_receive_go():
+    seen = broadcasts.get("go", 0)
+    while True:
+        while not (broadcasts.get("go", 0) != seen):
+            await wait(10)
+        seen = broadcasts.get("go", 0)
+        while True:
+            # TODO flippersound_playSound: playSound(sound: Cat Meow 1)
+            pass
+            await wait(0)
+
+
+# TODO: nothing starts this script.
+async def script():
+    # TODO flipperevents_whenGesture: when gesture "shake" occurs:
+    await hub.display.text(str((device(Motor, Port.C).angle() % 360)))
+
+
+run_task(multitask(when_program_starts(), when_i_receive_go()))
+`, strings.TrimPrefix(out, pybricks{}.header()))
+}
+
+// TestTranspileCoverage makes sure that every target can translate the
+// lmsdump test project, which uses most of the opcodes that lmsdump knows.
+func TestTranspileCoverage(t *testing.T) {
+	f, err := os.Open("../lmsdump/testdata/project.lms")
+	require.NoError(t, err)
+	defer f.Close()
+
+	r, err := lmsp.ReadFile(f)
+	require.NoError(t, err)
+	proj, err := r.Project()
+	require.NoError(t, err)
+
+	for _, target := range Targets() {
+		t.Run(target, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Transpile(&buf, proj, target))
+			assert.NotContains(t, buf.String(), "%!")
+		})
+	}
+}
+
+// TestTranspileMissingBlock makes sure that the end of a script that can't
+// be found is marked, instead of being left out without a trace.
+func TestTranspileMissingBlock(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(`{"targets": [
+  {"isStage": false, "name": "robot", "blocks": {
+    "start": {"opcode": "flipperevents_whenProgramStarts", "next": "gone", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0}
+  }}
+]}`), &proj))
+
+	var buf bytes.Buffer
+	require.NoError(t, Transpile(&buf, proj, "spike-python"))
+	assert.Contains(t, buf.String(), "async def when_program_starts():\n    # TODO: missing block gone\n    pass\n")
+}
+
+// TestTranspileLongDescription makes sure that a long TODO is cut between
+// characters, not in the middle of one.
+func TestTranspileLongDescription(t *testing.T) {
+	var proj lmsp.Project
+	require.NoError(t, json.Unmarshal([]byte(`{"targets": [
+  {"isStage": false, "name": "robot", "blocks": {
+    "start": {"opcode": "flipperevents_whenProgramStarts", "next": "say", "parent": null, "inputs": {}, "fields": {}, "shadow": false, "topLevel": true, "x": 0, "y": 0},
+    "say": {"opcode": "ev3display_say", "next": null, "parent": "start", "inputs": {}, "fields": {"TEXT": ["`+strings.Repeat("é", 200)+`", null]}, "shadow": false, "topLevel": false}
+  }}
+]}`), &proj))
+
+	var buf bytes.Buffer
+	require.NoError(t, Transpile(&buf, proj, "spike-python"))
+	out := buf.String()
+	assert.True(t, utf8.ValidString(out))
+	assert.Contains(t, out, "# TODO ev3display_say: ev3display_say(text: "+strings.Repeat("é", 79)+"...\n")
+}
+
+func TestTranspileUnknownTarget(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Error(t, Transpile(&buf, lmsp.Project{}, "basic"))
+}
+
+func TestIdentifier(t *testing.T) {
+	assert.Equal(t, "drive_cm", procName("drive %s cm"))
+	assert.Equal(t, "when_color", hatName("flipperevents_whenColor"))
+	assert.Equal(t, "my_variable", identifier("My Variable!"))
+	assert.Equal(t, "_2nd", identifier("2nd"))
+	assert.Equal(t, "if_", identifier("if"))
+}
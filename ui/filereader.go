@@ -34,7 +34,7 @@ func (f fileReader) read() tea.Msg {
 	f.data = programs
 
 	var dumped bytes.Buffer
-	if err := lmsdump.Dump(&dumped, programs.Project); err != nil {
+	if err := (lmsdump.Options{Manifest: programs.Manifest}).Dump(&dumped, programs.Project); err != nil {
 		return err
 	}
 	f.dumpLines = strings.Split(dumped.String(), "\n")